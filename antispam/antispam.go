@@ -0,0 +1,288 @@
+// Package antispam 防刷屏：一个人发得太快、同一句话发太多遍、图片发太多时先不理他，
+// 屡教不改就在群里禁言；整个群消息太多时 bot 先安静一会儿。
+// 要放在记录消息和群管后面、其他模块前面，拦下的消息其他模块就看不到了
+package antispam
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	groupsettings "github.com/doylecnn/qqbot/group_settings"
+	"github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// setting 可以用 /antispam 修改的设置：群设置里的键和取值范围
+type setting struct {
+	key      string
+	max      int
+	field    func(l *limits) *int
+	describe string
+}
+
+var settingNames = map[string]setting{
+	"messages":   {"antispam.messages", 100, func(l *limits) *int { return &l.Messages }, "最多 %d 条"},
+	"duplicates": {"antispam.duplicates", 100, func(l *limits) *int { return &l.Duplicates }, "同一句话最多 %d 遍"},
+	"images":     {"antispam.images", 100, func(l *limits) *int { return &l.Images }, "图片最多 %d 张"},
+}
+
+var settingOrder = []string{"messages", "duplicates", "images"}
+
+var (
+	defaults       = limits{Messages: 8, Duplicates: 3, Images: 4}
+	defaultOptions = options{
+		Window:        10 * time.Second,
+		GroupMessages: 40,
+		Ignore:        time.Minute,
+		Mute:          []int{5, 30, 120},
+		Forget:        time.Hour,
+	}
+	users = newTracker(defaultOptions)
+)
+
+// groupLimits 群设置里没有的用配置文件里的默认值，私聊都用默认值
+func groupLimits(groupID int64) limits {
+	l := defaults
+	if groupID == 0 {
+		return l
+	}
+	for _, def := range settingNames {
+		if v, err := strconv.Atoi(groupsettings.Get(groupID, def.key, "")); err == nil {
+			*def.field(&l) = v
+		}
+	}
+	return l
+}
+
+// Plugin 防刷屏
+type Plugin struct{}
+
+func (Plugin) Name() string { return "antispam" }
+
+func (Plugin) Description() string {
+	return "防刷屏：刷屏的人先不理，再犯禁言；群里消息太多时 bot 先安静"
+}
+
+func (Plugin) Init(config *toml.Tree, db *sqlx.DB) error {
+	opts := defaultOptions
+	if config == nil {
+		users = newTracker(opts)
+		return nil
+	}
+	for name, def := range settingNames {
+		if v, ok := config.Get("antispam." + name).(int64); ok {
+			if v < 0 || int(v) > def.max {
+				return fmt.Errorf("antispam.%s 要在 0 到 %d 之间", name, def.max)
+			}
+			*def.field(&defaults) = int(v)
+		}
+	}
+	for name, d := range map[string]*time.Duration{"window": &opts.Window, "ignore": &opts.Ignore, "forget": &opts.Forget} {
+		if s, ok := config.Get("antispam." + name).(string); ok {
+			v, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("antispam.%s：%w", name, err)
+			}
+			*d = v
+		}
+	}
+	if opts.Window <= 0 {
+		return fmt.Errorf("antispam.window 要大于 0")
+	}
+	if v, ok := config.Get("antispam.group_messages").(int64); ok {
+		if v < 0 {
+			return fmt.Errorf("antispam.group_messages 不能小于 0")
+		}
+		opts.GroupMessages = int(v)
+	}
+	if v, ok := config.Get("antispam.mute").([]interface{}); ok {
+		opts.Mute = nil
+		for _, m := range v {
+			minutes, ok := m.(int64)
+			if !ok || minutes < 1 || minutes > 30*24*60 {
+				return fmt.Errorf("antispam.mute 要是 1 到 %d 之间的分钟数", 30*24*60)
+			}
+			opts.Mute = append(opts.Mute, int(minutes))
+		}
+	}
+	users = newTracker(opts)
+	return nil
+}
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "防刷屏", Usage: "（自动）", Description: "刷屏的人 bot 先不理，再犯会被禁言；群里消息太多时 bot 先安静一会儿"},
+		{Name: "antispam", Usage: "/antispam [messages|duplicates|images 数量]", Description: "查看或者修改本群的刷屏限制，0 表示不限", Examples: []string{"/antispam", "/antispam images 6"}, Permission: plugin.Admin, GroupOnly: true},
+		{Name: "antispam pardon", Usage: "/antispam pardon @某人|QQ号", Description: "不再忽略某人，刷屏次数清零", Permission: plugin.Admin, GroupOnly: true},
+	}
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnCommand("antispam", zero.OnlyGroup, zero.AdminPermission).Handle(Command)
+	engine.OnMessage().Handle(onMessage)
+}
+
+func (Plugin) Shutdown() {}
+
+func images(m message.Message) (n int) {
+	for _, seg := range m {
+		if seg.Type == "image" {
+			n++
+		}
+	}
+	return
+}
+
+// formatDuration 几小时、几分钟或者几秒，不满的往上取整
+func formatDuration(d time.Duration) string {
+	seconds := int64((d + time.Second - 1) / time.Second)
+	if seconds < 60 {
+		return fmt.Sprintf("%d 秒", seconds)
+	}
+	minutes := (seconds + 59) / 60
+	if minutes%60 == 0 {
+		return fmt.Sprintf("%d 小时", minutes/60)
+	}
+	return fmt.Sprintf("%d 分钟", minutes)
+}
+
+func name(ctx *zero.Ctx, qq int64) string {
+	if n := ctx.CardOrNickName(qq); n != "" {
+		return n
+	}
+	return strconv.FormatInt(qq, 10)
+}
+
+// onMessage 刷屏的消息拦下来，不再给后面的模块
+func onMessage(ctx *zero.Ctx) {
+	groupID, qq := ctx.Event.GroupID, ctx.Event.UserID
+	v := users.observe(groupID, qq, ctx.MessageString(), images(ctx.Event.Message),
+		groupLimits(groupID), plugin.GroupAdmin(ctx), time.Now())
+	if !v.Block {
+		return
+	}
+	ctx.Block()
+	if v.Quiet {
+		log.Log.WithFields(logrus.Fields{
+			"event":     "Anti Spam",
+			"QQGroupId": groupID,
+		}).Infoln("群里消息太多，暂停回应")
+		ctx.Send(message.Text(fmt.Sprintf("群里消息太多了，bot 先安静 %s", formatDuration(users.opts.Ignore))))
+	}
+	if v.Reason == "" {
+		return
+	}
+	log.Log.WithFields(logrus.Fields{
+		"event":     "Anti Spam",
+		"Reason":    v.Reason,
+		"Level":     v.Level,
+		"QQGroupId": groupID,
+		"QQ":        qq,
+	}).Infoln("刷屏")
+	if v.Mute > 0 {
+		ctx.SetGroupBan(groupID, qq, int64(v.Mute)*60)
+		ctx.Send(message.Text(fmt.Sprintf("%s %s，禁言 %d 分钟", name(ctx, qq), v.Reason, v.Mute)))
+		return
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("%s，%s内不再回应你", v.Reason, formatDuration(v.Ignore)))))
+}
+
+func reply(ctx *zero.Ctx, text string) {
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(text)))
+}
+
+func limitsText(l limits) string {
+	parts := []string{}
+	for _, n := range settingOrder {
+		def := settingNames[n]
+		if v := *def.field(&l); v > 0 {
+			parts = append(parts, fmt.Sprintf(def.describe, v))
+		}
+	}
+	if len(parts) == 0 {
+		return "本群不限制刷屏"
+	}
+	return fmt.Sprintf("刷屏限制：每人 %s内%s", formatDuration(users.opts.Window), strings.Join(parts, "、"))
+}
+
+// target 指令里 @ 的人，没有 @ 就用写的 QQ 号
+func target(ctx *zero.Ctx, fields []string) (int64, bool) {
+	for _, seg := range ctx.Event.Message {
+		if seg.Type != "at" {
+			continue
+		}
+		if qq, err := strconv.ParseInt(seg.Data["qq"], 10, 64); err == nil {
+			return qq, true
+		}
+	}
+	if len(fields) == 1 {
+		if qq, err := strconv.ParseInt(fields[0], 10, 64); err == nil && qq > 0 {
+			return qq, true
+		}
+	}
+	return 0, false
+}
+
+// Command 查看或修改本群的刷屏限制：/antispam [messages|duplicates|images 数量|pardon @某人]
+func Command(ctx *zero.Ctx) {
+	defer ctx.Block()
+	args, _ := ctx.State["args"].(string)
+	fields := strings.Fields(strings.ToLower(args))
+	groupID := ctx.Event.GroupID
+	if len(fields) == 0 {
+		text := limitsText(groupLimits(groupID))
+		now := time.Now()
+		ignored := users.ignored(groupID, now)
+		qqs := make([]int64, 0, len(ignored))
+		for qq := range ignored {
+			qqs = append(qqs, qq)
+		}
+		sort.Slice(qqs, func(i, j int) bool { return qqs[i] < qqs[j] })
+		for _, qq := range qqs {
+			text += fmt.Sprintf("\n%s 还要忽略 %s", name(ctx, qq), formatDuration(ignored[qq].Sub(now)))
+		}
+		reply(ctx, text)
+		return
+	}
+	if fields[0] == "pardon" {
+		qq, ok := target(ctx, fields[1:])
+		if !ok {
+			reply(ctx, "用法：/antispam pardon @某人|QQ号")
+			return
+		}
+		if users.pardon(groupID, qq) {
+			reply(ctx, "好的，不再忽略 "+name(ctx, qq))
+		} else {
+			reply(ctx, name(ctx, qq)+" 没有刷屏记录")
+		}
+		return
+	}
+	def, exists := settingNames[fields[0]]
+	if !exists || len(fields) != 2 {
+		reply(ctx, "用法：/antispam [messages|duplicates|images 数量|pardon @某人]")
+		return
+	}
+	v, err := strconv.Atoi(fields[1])
+	if err != nil || v < 0 || v > def.max {
+		reply(ctx, fmt.Sprintf("%s 要在 0 到 %d 之间", fields[0], def.max))
+		return
+	}
+	if err := groupsettings.Set(groupID, def.key, strconv.Itoa(v)); err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event":     "Anti Spam",
+			"err":       err,
+			"QQGroupId": groupID,
+		}).Warningln("保存刷屏设置失败")
+		reply(ctx, "修改失败了，稍后再试试")
+		return
+	}
+	reply(ctx, limitsText(groupLimits(groupID)))
+}
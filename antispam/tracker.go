@@ -0,0 +1,238 @@
+package antispam
+
+import (
+	"sync"
+	"time"
+)
+
+// 刷屏的原因
+const (
+	tooFast       = "说话太快了"
+	tooRepetitive = "同一句话发太多遍了"
+	tooManyImages = "图片发太多了"
+)
+
+// maxIgnore 再怎么升级也只忽略这么久
+const maxIgnore = 24 * time.Hour
+
+// limits 一个人在 window 内最多发几条、同一句话几遍、几张图片，0 表示不限
+type limits struct {
+	Messages   int
+	Duplicates int
+	Images     int
+}
+
+// options 配置文件里的设置，各群只能改 limits
+type options struct {
+	Window time.Duration
+	// GroupMessages 整个群 window 内超过这么多条，bot 安静 Ignore 这么久
+	GroupMessages int
+	// Ignore 第一次刷屏不理这个人多久，之后每次翻倍
+	Ignore time.Duration
+	// Mute 第二次起在群里禁言几分钟，用完了一直用最后一个
+	Mute []int
+	// Forget 这么久没再刷屏，升级从头算
+	Forget time.Duration
+}
+
+type post struct {
+	at      time.Time
+	content string
+	images  int
+}
+
+// offender 刷过屏的人
+type offender struct {
+	level int
+	last  time.Time
+	until time.Time
+}
+
+type userKey struct {
+	group, user int64
+}
+
+type groupState struct {
+	times      []time.Time
+	quietUntil time.Time
+}
+
+// verdict observe 的结果，Reason 不为空表示这条消息刚刚触发了刷屏
+type verdict struct {
+	Block  bool
+	Quiet  bool
+	Reason string
+	Level  int
+	Ignore time.Duration
+	Mute   int
+}
+
+type tracker struct {
+	opts      options
+	posts     map[userKey][]post
+	offenders map[userKey]*offender
+	groups    map[int64]*groupState
+	lastSweep time.Time
+	mux       sync.Mutex
+}
+
+func newTracker(opts options) *tracker {
+	return &tracker{
+		opts:      opts,
+		posts:     make(map[userKey][]post),
+		offenders: make(map[userKey]*offender),
+		groups:    make(map[int64]*groupState),
+	}
+}
+
+// recent 去掉 window 之前的
+func recent(posts []post, since time.Time) []post {
+	i := 0
+	for i < len(posts) && posts[i].at.Before(since) {
+		i++
+	}
+	return posts[i:]
+}
+
+// check 最近的消息有没有刷屏
+func check(posts []post, l limits) string {
+	if l.Messages > 0 && len(posts) > l.Messages {
+		return tooFast
+	}
+	last := posts[len(posts)-1]
+	same, images := 0, 0
+	for _, p := range posts {
+		if p.content == last.content {
+			same++
+		}
+		images += p.images
+	}
+	if l.Duplicates > 0 && same > l.Duplicates {
+		return tooRepetitive
+	}
+	if l.Images > 0 && images > l.Images {
+		return tooManyImages
+	}
+	return ""
+}
+
+// ignoreFor 第 level 次刷屏不理多久
+func (t *tracker) ignoreFor(level int) time.Duration {
+	d := t.opts.Ignore
+	for i := 1; i < level && d < maxIgnore; i++ {
+		d *= 2
+	}
+	if d > maxIgnore {
+		d = maxIgnore
+	}
+	return d
+}
+
+// observe 记下一条消息；groupID 为 0 是私聊，exempt 的人只算进整个群的消息数
+func (t *tracker) observe(groupID, userID int64, content string, images int, l limits, exempt bool, now time.Time) (v verdict) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.sweep(now)
+	since := now.Add(-t.opts.Window)
+	if groupID != 0 {
+		g, exists := t.groups[groupID]
+		if !exists {
+			g = &groupState{}
+			t.groups[groupID] = g
+		}
+		if now.Before(g.quietUntil) {
+			v.Block = true
+		} else {
+			g.times = append(g.times, now)
+			for len(g.times) > 0 && g.times[0].Before(since) {
+				g.times = g.times[1:]
+			}
+			if t.opts.GroupMessages > 0 && len(g.times) > t.opts.GroupMessages {
+				g.times = nil
+				g.quietUntil = now.Add(t.opts.Ignore)
+				v.Block, v.Quiet = true, true
+			}
+		}
+	}
+	if exempt {
+		return
+	}
+	key := userKey{groupID, userID}
+	o := t.offenders[key]
+	if o != nil && now.Before(o.until) {
+		v.Block = true
+		return
+	}
+	posts := recent(append(t.posts[key], post{now, content, images}), since)
+	t.posts[key] = posts
+	reason := check(posts, l)
+	if reason == "" {
+		return
+	}
+	delete(t.posts, key)
+	if o == nil || now.Sub(o.last) > t.opts.Forget {
+		o = &offender{}
+		t.offenders[key] = o
+	}
+	o.level++
+	o.last = now
+	v.Block, v.Reason, v.Level = true, reason, o.level
+	v.Ignore = t.ignoreFor(o.level)
+	if groupID != 0 && o.level > 1 && len(t.opts.Mute) > 0 {
+		i := o.level - 2
+		if i >= len(t.opts.Mute) {
+			i = len(t.opts.Mute) - 1
+		}
+		v.Mute = t.opts.Mute[i]
+	}
+	o.until = now.Add(v.Ignore)
+	return
+}
+
+// sweep 每分钟清一次过期的记录
+func (t *tracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < time.Minute {
+		return
+	}
+	t.lastSweep = now
+	since := now.Add(-t.opts.Window)
+	for key, posts := range t.posts {
+		if len(recent(posts, since)) == 0 {
+			delete(t.posts, key)
+		}
+	}
+	for key, o := range t.offenders {
+		if now.After(o.until) && now.Sub(o.last) > t.opts.Forget {
+			delete(t.offenders, key)
+		}
+	}
+	for groupID, g := range t.groups {
+		if now.After(g.quietUntil) && (len(g.times) == 0 || g.times[len(g.times)-1].Before(since)) {
+			delete(t.groups, groupID)
+		}
+	}
+}
+
+// ignored 本群现在不理的人和到什么时候
+func (t *tracker) ignored(groupID int64, now time.Time) map[int64]time.Time {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	users := make(map[int64]time.Time)
+	for key, o := range t.offenders {
+		if key.group == groupID && now.Before(o.until) {
+			users[key.user] = o.until
+		}
+	}
+	return users
+}
+
+// pardon 不再忽略，升级也清零
+func (t *tracker) pardon(groupID, userID int64) bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	key := userKey{groupID, userID}
+	_, exists := t.offenders[key]
+	delete(t.offenders, key)
+	delete(t.posts, key)
+	return exists
+}
@@ -0,0 +1,120 @@
+package antispam
+
+import (
+	"testing"
+	"time"
+)
+
+var testOptions = options{
+	Window:        10 * time.Second,
+	GroupMessages: 5,
+	Ignore:        time.Minute,
+	Mute:          []int{5, 30},
+	Forget:        time.Hour,
+}
+
+func TestCheck(t *testing.T) {
+	l := limits{Messages: 3, Duplicates: 2, Images: 2}
+	now := time.Now()
+	tests := []struct {
+		posts []post
+		want  string
+	}{
+		{[]post{{now, "a", 0}, {now, "b", 0}, {now, "c", 0}}, ""},
+		{[]post{{now, "a", 0}, {now, "b", 0}, {now, "c", 0}, {now, "d", 0}}, tooFast},
+		{[]post{{now, "a", 0}, {now, "a", 0}, {now, "a", 0}}, tooRepetitive},
+		{[]post{{now, "a", 0}, {now, "a", 0}, {now, "b", 0}}, ""},
+		{[]post{{now, "[图]", 1}, {now, "[图][图]", 2}}, tooManyImages},
+	}
+	for i, tt := range tests {
+		if got := check(tt.posts, l); got != tt.want {
+			t.Errorf("#%d check = %q, want %q", i, got, tt.want)
+		}
+	}
+	// 0 表示不限
+	if got := check(tests[1].posts, limits{}); got != "" {
+		t.Errorf("check without limits = %q", got)
+	}
+}
+
+func TestEscalation(t *testing.T) {
+	tr := newTracker(testOptions)
+	l := limits{Messages: 2}
+	now := time.Now()
+	flood := func(groupID int64, at time.Time) verdict {
+		var v verdict
+		for i := 0; i < 3; i++ {
+			v = tr.observe(groupID, 1, string(rune('a'+i)), 0, l, false, at.Add(time.Duration(i)*time.Second))
+		}
+		return v
+	}
+	v := flood(1, now)
+	if v.Reason != tooFast || v.Level != 1 || v.Ignore != time.Minute || v.Mute != 0 {
+		t.Fatalf("first flood = %+v", v)
+	}
+	// 忽略期间的消息直接拦下
+	if v := tr.observe(1, 1, "x", 0, l, false, now.Add(30*time.Second)); !v.Block || v.Reason != "" {
+		t.Errorf("while ignored = %+v", v)
+	}
+	// 别的群、私聊不受影响
+	if v := tr.observe(2, 1, "x", 0, l, false, now.Add(30*time.Second)); v.Block {
+		t.Errorf("another group = %+v", v)
+	}
+	v = flood(1, now.Add(2*time.Minute))
+	if v.Level != 2 || v.Ignore != 2*time.Minute || v.Mute != 5 {
+		t.Errorf("second flood = %+v", v)
+	}
+	v = flood(1, now.Add(10*time.Minute))
+	if v.Level != 3 || v.Ignore != 4*time.Minute || v.Mute != 30 {
+		t.Errorf("third flood = %+v", v)
+	}
+	v = flood(1, now.Add(20*time.Minute))
+	if v.Level != 4 || v.Mute != 30 {
+		t.Errorf("fourth flood = %+v", v)
+	}
+	// 私聊只忽略不禁言
+	flood(0, now)
+	if v := flood(0, now.Add(2*time.Minute)); v.Level != 2 || v.Mute != 0 {
+		t.Errorf("private second flood = %+v", v)
+	}
+	// 很久没刷屏，从头算
+	if v := flood(1, now.Add(3*time.Hour)); v.Level != 1 {
+		t.Errorf("flood after forget = %+v", v)
+	}
+	if !tr.pardon(1, 1) || tr.pardon(1, 1) {
+		t.Error("pardon")
+	}
+}
+
+func TestGroupQuiet(t *testing.T) {
+	tr := newTracker(testOptions)
+	now := time.Now()
+	var v verdict
+	for i := 0; i < 6; i++ {
+		// 管理员不算刷屏，但算进整个群的消息数
+		v = tr.observe(1, int64(i%2), "hi", 0, limits{}, i%2 == 0, now)
+	}
+	if !v.Quiet || !v.Block {
+		t.Fatalf("6th message = %+v", v)
+	}
+	if v := tr.observe(1, 9, "hi", 0, limits{}, false, now.Add(30*time.Second)); v.Quiet || !v.Block {
+		t.Errorf("while quiet = %+v", v)
+	}
+	if v := tr.observe(1, 9, "hi", 0, limits{}, false, now.Add(2*time.Minute)); v.Block {
+		t.Errorf("after quiet = %+v", v)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		10 * time.Second:                  "10 秒",
+		time.Minute:                       "1 分钟",
+		90 * time.Second:                  "2 分钟",
+		59*time.Second + time.Millisecond: "1 分钟",
+		2 * time.Hour:                     "2 小时",
+	} {
+		if got := formatDuration(d); got != want {
+			t.Errorf("formatDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
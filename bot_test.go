@@ -0,0 +1,642 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	fakeonebot "github.com/doylecnn/qqbot/fake_onebot"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/doylecnn/qqbot/render"
+	sendlimit "github.com/doylecnn/qqbot/send_limit"
+	"github.com/pelletier/go-toml"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/driver"
+)
+
+const (
+	testSelfID    = 10000
+	testSuperUser = 99999
+	// replyTimeout 汉兜第一次开局要加载词典，给多一点时间
+	replyTimeout = 10 * time.Second
+	// silence 等这么久没有回复就当作不回复
+	silence = 300 * time.Millisecond
+)
+
+// testConfig 群 6 关掉了骰子
+const testConfig = `
+[robirt]
+groupcdtime = "19s"
+
+[plugins.group_disabled]
+"6" = ["dice"]
+`
+
+var bot *fakeonebot.Server
+
+// TestMain 用内存数据库和假的 OneBot 服务端把整个 bot 跑起来
+func TestMain(m *testing.M) {
+	if err := setupBot(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func setupBot() error {
+	var err error
+	if db, err = openDB(":memory:"); err != nil {
+		return err
+	}
+	// 内存数据库每个连接都是独立的
+	db.SetMaxOpenConns(1)
+	schema, err := os.ReadFile("db.schema")
+	if err != nil {
+		return err
+	}
+	if _, err = db.Exec(string(schema)); err != nil {
+		return err
+	}
+	if config, err = toml.Load(testConfig); err != nil {
+		return err
+	}
+	// 找不到字体时各处都改发文字，方便检查回复
+	render.HanFont = "没有这个字体.ttf"
+	registerPlugins()
+	plugin.Load(config, db)
+
+	bot = fakeonebot.NewServer(testSelfID)
+	zero.Run(zero.Config{
+		NickName:      []string{"bot"},
+		CommandPrefix: "/",
+		SuperUsers:    []int64{testSuperUser},
+		Driver: []zero.Driver{
+			sendlimit.Wrap(driver.NewWebSocketClient(bot.URL, "")),
+		},
+	})
+	return bot.WaitConnected(5 * time.Second)
+}
+
+// groupSay 以普通群员的身份在群里发一条消息，返回 bot 的回复
+func groupSay(t *testing.T, m fakeonebot.Message) string {
+	t.Helper()
+	if _, err := bot.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	var call fakeonebot.Call
+	var ok bool
+	if m.GroupID != 0 {
+		call, ok = bot.WaitGroupReply(m.GroupID, replyTimeout)
+	} else {
+		call, ok = bot.WaitPrivateReply(m.UserID, replyTimeout)
+	}
+	if !ok {
+		t.Fatalf("%q: no reply", m.Text)
+	}
+	return call.Text()
+}
+
+// expectSilence 发一条消息，bot 不应该在这个聊天里回复
+func expectSilence(t *testing.T, m fakeonebot.Message) {
+	t.Helper()
+	if _, err := bot.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	if call, ok := bot.Wait(silence, func(c fakeonebot.Call) bool {
+		return c.IsSend() && c.GroupID() == m.GroupID && (m.GroupID != 0 || c.UserID() == m.UserID)
+	}); ok {
+		t.Errorf("%q: unexpected reply %q", m.Text, call.Text())
+	}
+}
+
+func TestDice(t *testing.T) {
+	reply := groupSay(t, fakeonebot.Message{GroupID: 1, UserID: 1, Text: "2d6"})
+	matched := regexp.MustCompile(`^\[2d6\] = (\d+)$`).FindStringSubmatch(reply)
+	if matched == nil {
+		t.Fatalf("reply = %q", reply)
+	}
+	if n, _ := strconv.Atoi(matched[1]); n < 2 || n > 12 {
+		t.Errorf("2d6 = %d", n)
+	}
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 1, UserID: 1, Text: "/roll"}); !regexp.MustCompile(`^\[1d6\] = [1-6]$`).MatchString(reply) {
+		t.Errorf("/roll reply = %q", reply)
+	}
+	// /roll 只在群里用
+	expectSilence(t, fakeonebot.Message{UserID: 1, Text: "/roll"})
+}
+
+func TestKeywordReplies(t *testing.T) {
+	for text, want := range map[string]string{
+		"sb老王": "老王确实大sb",
+		"lj小明": "小明确实太lj了",
+		"伞兵小张": "小张确实大伞兵",
+	} {
+		if reply := groupSay(t, fakeonebot.Message{GroupID: 2, UserID: 2, Text: text}); reply != want {
+			t.Errorf("%q: reply = %q, want %q", text, reply, want)
+		}
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	member := fakeonebot.Message{GroupID: 3, UserID: 3, Text: "/handle theme dark"}
+	if reply := groupSay(t, member); reply != "只有管理员可以切换配色" {
+		t.Errorf("member: reply = %q", reply)
+	}
+	admin := member
+	admin.Role = "admin"
+	if reply := groupSay(t, admin); reply != "配色已切换为：dark" {
+		t.Errorf("admin: reply = %q", reply)
+	}
+	admin.Text = "/settings"
+	if reply := groupSay(t, admin); !strings.Contains(reply, "wordle.theme = dark") {
+		t.Errorf("/settings: reply = %q", reply)
+	}
+	// 普通群员没有权限重启，指令直接忽略
+	expectSilence(t, fakeonebot.Message{GroupID: 3, UserID: 3, Text: "/restart"})
+}
+
+// TestRestartPermission 重启会打断所有群的游戏，只有超级用户可以
+func TestRestartPermission(t *testing.T) {
+	m := fakeonebot.Message{GroupID: 18, UserID: 181, Text: "/handle"}
+	if reply := groupSay(t, m); !strings.Contains(reply, "开始") {
+		t.Fatalf("/handle: reply = %q", reply)
+	}
+	// 重启的话会在群里说游戏已保存
+	expectSilence(t, fakeonebot.Message{GroupID: 18, UserID: 181, Role: "admin", Text: "/restart"})
+	expectSilence(t, fakeonebot.Message{GroupID: 18, UserID: 181, Role: "owner", Text: "/restart"})
+	// 私聊时发送者没有群身份，也不能当成管理员
+	if _, err := bot.Send(fakeonebot.Message{UserID: 181, Text: "/restart"}); err != nil {
+		t.Fatal(err)
+	}
+	if call, ok := bot.WaitGroupReply(18, silence); ok {
+		t.Errorf("private /restart: unexpected reply %q", call.Text())
+	}
+	m.Text = "放弃"
+	if reply := groupSay(t, m); !strings.Contains(reply, "本轮终止") {
+		t.Errorf("stop: reply = %q", reply)
+	}
+}
+
+func TestWordleGroupFlow(t *testing.T) {
+	m := fakeonebot.Message{GroupID: 4, UserID: 4}
+	m.Text = "/handle"
+	if reply := groupSay(t, m); !strings.Contains(reply, "游戏开始啦") {
+		t.Fatalf("/handle: reply = %q", reply)
+	}
+	m.Text = "/handle"
+	if reply := groupSay(t, m); reply != "已经开始啦" {
+		t.Errorf("second /handle: reply = %q", reply)
+	}
+	// 别的游戏开不了
+	m.Text = "/chain"
+	if reply := groupSay(t, m); !strings.Contains(reply, "正在玩汉兜") {
+		t.Errorf("/chain during wordle: reply = %q", reply)
+	}
+	// 第一次猜测决定长度，太短太长的不算，换个人发免得算刷屏
+	for _, text := range []string{"好", "一二三四五六七八九十"} {
+		if reply := groupSay(t, fakeonebot.Message{GroupID: 4, UserID: 40, Text: text}); reply != "词的长度要在 2 到 9 个字之间" {
+			t.Errorf("%q as first guess: reply = %q", text, reply)
+		}
+	}
+	m.Text = "一目了然"
+	reply := groupSay(t, m)
+	if strings.Contains(reply, "猜对啦") {
+		return
+	}
+	if !strings.Contains(reply, "第 1 次") {
+		t.Fatalf("first guess: reply = %q", reply)
+	}
+	m.Text = "一目了然"
+	if reply := groupSay(t, m); reply != "这个词已经猜过啦" {
+		t.Errorf("repeated guess: reply = %q", reply)
+	}
+	m.Text = "放弃"
+	if reply := groupSay(t, m); !strings.Contains(reply, "本轮终止") || !strings.Contains(reply, "答案是：") {
+		t.Errorf("stop: reply = %q", reply)
+	}
+	// 结束之后的中文消息不再当作猜测
+	expectSilence(t, fakeonebot.Message{GroupID: 4, UserID: 4, Text: "一帆风顺"})
+}
+
+func TestStopWordsOnlyStopWordle(t *testing.T) {
+	m := fakeonebot.Message{GroupID: 20, UserID: 200, Text: "/chain"}
+	if reply := groupSay(t, m); reply == "" {
+		t.Fatalf("/chain: no reply")
+	}
+	// 汉兜的“放弃”和 /stop 不管成语接龙
+	for _, text := range []string{"放弃", "/stop"} {
+		expectSilence(t, fakeonebot.Message{GroupID: 20, UserID: 200, Text: text})
+	}
+	m.Text = "/chain stop"
+	if reply := groupSay(t, m); !strings.Contains(reply, "一共接了") {
+		t.Errorf("/chain stop: reply = %q", reply)
+	}
+}
+
+func TestWordlePrivateFlow(t *testing.T) {
+	m := fakeonebot.Message{UserID: 5, Text: "/handle 一目了然"}
+	reply := groupSay(t, m)
+	if strings.Contains(reply, "猜对啦") {
+		return
+	}
+	if !strings.Contains(reply, "第 1 次") {
+		t.Fatalf("/handle with guess: reply = %q", reply)
+	}
+	// 私聊的游戏和群里的互不影响
+	expectSilence(t, fakeonebot.Message{GroupID: 5, UserID: 5, Text: "一帆风顺"})
+	m.Text = "太难了"
+	if reply := groupSay(t, m); !strings.Contains(reply, "本轮终止") {
+		t.Errorf("stop: reply = %q", reply)
+	}
+}
+
+func TestWordleDaily(t *testing.T) {
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 17, UserID: 170, Text: "/handle daily"}); !strings.Contains(reply, "私聊") {
+		t.Fatalf("/handle daily in group: reply = %q", reply)
+	}
+	// 每日汉兜的答案大家都一样，不在群里猜
+	expectSilence(t, fakeonebot.Message{GroupID: 17, UserID: 170, Text: "一目了然"})
+	m := fakeonebot.Message{UserID: 170, Text: "一目了然"}
+	reply := groupSay(t, m)
+	if strings.Contains(reply, "猜对啦") {
+		return
+	}
+	if !strings.Contains(reply, "每日汉兜 第 1 次") {
+		t.Fatalf("private guess: reply = %q", reply)
+	}
+	m.Text = "/handle daily"
+	if reply := groupSay(t, m); !strings.Contains(reply, "还没猜完") {
+		t.Errorf("second /handle daily: reply = %q", reply)
+	}
+	m.Text = "放弃"
+	if reply := groupSay(t, m); !strings.Contains(reply, "每日汉兜结束") {
+		t.Errorf("stop: reply = %q", reply)
+	}
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 17, UserID: 170, Text: "/handle daily"}); !strings.Contains(reply, "已经玩过") {
+		t.Errorf("/handle daily again: reply = %q", reply)
+	}
+}
+
+// TestPrivatePermissions 私聊时发送者没有群身份，管理指令不能当成管理员放行
+func TestPrivatePermissions(t *testing.T) {
+	for text, want := range map[string]string{
+		"/handle block 一目了然": "只有管理员可以修改屏蔽词",
+		"/handle theme dark": "只有管理员可以切换配色",
+		"/handle style text": "只有管理员可以切换棋盘样式",
+		"/handle reports":    "只有管理员可以审核举报",
+	} {
+		if reply := groupSay(t, fakeonebot.Message{UserID: 180, Text: text}); reply != want {
+			t.Errorf("%q: reply = %q, want %q", text, reply, want)
+		}
+	}
+	if reply := groupSay(t, fakeonebot.Message{UserID: 180, Text: "/handle pinyin 银行 yin2 xing2"}); strings.Contains(reply, "记住啦") {
+		t.Errorf("/handle pinyin: reply = %q", reply)
+	}
+	// 超级用户私聊照样能管
+	if reply := groupSay(t, fakeonebot.Message{UserID: testSuperUser, Text: "/handle theme dark"}); strings.HasPrefix(reply, "只有") {
+		t.Errorf("/handle theme from superuser: reply = %q", reply)
+	}
+}
+
+func TestPinYinReport(t *testing.T) {
+	member := fakeonebot.Message{GroupID: 19, UserID: 190, Text: "/handle pinyin 银行 yin2 xing2"}
+	if reply := groupSay(t, member); reply != "收到，超级用户审核后会改成这个读音" {
+		t.Fatalf("report: reply = %q", reply)
+	}
+	member.Text = "/handle pinyin 银行 yin2"
+	if reply := groupSay(t, member); strings.HasPrefix(reply, "收到") {
+		t.Errorf("report with wrong syllables: reply = %q", reply)
+	}
+	// 读音对所有群都生效，群管理员改也只是反馈，也看不到读音反馈
+	admin := fakeonebot.Message{GroupID: 19, UserID: 191, Role: "admin", Text: "/handle pinyin 银行 yin2 xing2"}
+	if reply := groupSay(t, admin); !strings.HasPrefix(reply, "收到") {
+		t.Errorf("report from admin: reply = %q", reply)
+	}
+	admin.Text = "/handle reports"
+	if reply := groupSay(t, admin); strings.Contains(reply, "应读作") {
+		t.Errorf("/handle reports as admin: reply = %q", reply)
+	}
+	superUser := fakeonebot.Message{GroupID: 19, UserID: testSuperUser, Text: "/handle reports"}
+	reply := groupSay(t, superUser)
+	matched := regexp.MustCompile(`#(\d+) 银行 应读作 yin2 xing2`).FindStringSubmatch(reply)
+	if matched == nil {
+		t.Fatalf("/handle reports: reply = %q", reply)
+	}
+	admin.Text = "/handle reports approve " + matched[1]
+	if reply := groupSay(t, admin); reply != "没有这个待审核的举报" {
+		t.Errorf("approve as admin: reply = %q", reply)
+	}
+	superUser.Text = "/handle reports approve " + matched[1]
+	if reply := groupSay(t, superUser); !strings.Contains(reply, "已处理") {
+		t.Fatalf("approve: reply = %q", reply)
+	}
+	member.Text = "/handle pinyin 银行"
+	if reply := groupSay(t, member); reply != "银行 现在读作：yin2 xing2" {
+		t.Errorf("after approve: reply = %q", reply)
+	}
+}
+
+func TestPlugins(t *testing.T) {
+	admin := fakeonebot.Message{GroupID: 6, UserID: 6, Role: "admin", Text: "/plugins"}
+	reply := groupSay(t, admin)
+	for _, want := range []string{"dice（本群关闭）", "wordle（开启）", "keyword（开启）"} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("/plugins: reply = %q, want %q", reply, want)
+		}
+	}
+	// 普通群员看不了，私聊也看不了
+	expectSilence(t, fakeonebot.Message{GroupID: 6, UserID: 6, Text: "/plugins"})
+	expectSilence(t, fakeonebot.Message{UserID: 6, Text: "/plugins"})
+	// 本群关了骰子，别的群照常
+	expectSilence(t, fakeonebot.Message{GroupID: 6, UserID: 6, Text: "2d6"})
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 7, UserID: 7, Text: "2d6"}); !strings.HasPrefix(reply, "[2d6] = ") {
+		t.Errorf("2d6 in group 7: reply = %q", reply)
+	}
+}
+
+func TestGroupToggles(t *testing.T) {
+	admin := fakeonebot.Message{GroupID: 8, UserID: 8, Role: "admin"}
+	admin.Text = "/disable taunt"
+	if reply := groupSay(t, admin); reply != "本群已关闭 taunt" {
+		t.Errorf("/disable: reply = %q", reply)
+	}
+	expectSilence(t, fakeonebot.Message{GroupID: 8, UserID: 8, Text: "sb老王"})
+	// 别的群不受影响
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 9, UserID: 9, Text: "sb老王"}); reply != "老王确实大sb" {
+		t.Errorf("group 9: reply = %q", reply)
+	}
+	admin.Text = "/settings"
+	if reply := groupSay(t, admin); !strings.Contains(reply, "taunt：本群关闭（本群设置）") || !strings.Contains(reply, "dice：开启（默认）") {
+		t.Errorf("/settings: reply = %q", reply)
+	}
+	admin.Text = "/enable nothing"
+	if reply := groupSay(t, admin); !strings.HasPrefix(reply, "没有这个模块") {
+		t.Errorf("/enable nothing: reply = %q", reply)
+	}
+	// 普通群员改不了
+	expectSilence(t, fakeonebot.Message{GroupID: 8, UserID: 8, Text: "/enable taunt"})
+	admin.Text = "/enable taunt"
+	if reply := groupSay(t, admin); reply != "本群已开启 taunt" {
+		t.Errorf("/enable: reply = %q", reply)
+	}
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 8, UserID: 8, Text: "sb老王"}); reply != "老王确实大sb" {
+		t.Errorf("after /enable: reply = %q", reply)
+	}
+}
+
+func TestHelp(t *testing.T) {
+	reply := groupSay(t, fakeonebot.Message{GroupID: 10, UserID: 10, Text: "/help"})
+	for _, want := range []string{"/roll", "/handle", "/help [指令]"} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("/help: reply = %q, want %q", reply, want)
+		}
+	}
+	// 普通群员看不到管理指令
+	for _, hidden := range []string{"/plugins", "/frp start", "/handle theme"} {
+		if strings.Contains(reply, hidden) {
+			t.Errorf("/help: member sees %q", hidden)
+		}
+	}
+	admin := fakeonebot.Message{GroupID: 10, UserID: 10, Role: "admin", Text: "/help"}
+	if reply := groupSay(t, admin); !strings.Contains(reply, "/plugins") || strings.Contains(reply, "/frp start") {
+		t.Errorf("/help as admin: reply = %q", reply)
+	}
+	// 群 6 关了骰子
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 6, UserID: 6, Text: "/help"}); strings.Contains(reply, "/roll") {
+		t.Errorf("/help in group 6: reply = %q", reply)
+	}
+	// 私聊看不到只能在群里用的指令，也看不到管理指令
+	if reply := groupSay(t, fakeonebot.Message{UserID: 10, Text: "/help"}); strings.Contains(reply, "/roll") || strings.Contains(reply, "/plugins") || strings.Contains(reply, "/handle theme") || !strings.Contains(reply, "/handle suggest") {
+		t.Errorf("private /help: reply = %q", reply)
+	}
+	reply = groupSay(t, fakeonebot.Message{GroupID: 10, UserID: 10, Text: "/help NdM"})
+	if !strings.Contains(reply, "用法：NdM") || !strings.Contains(reply, "2d6") {
+		t.Errorf("/help NdM: reply = %q", reply)
+	}
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 10, UserID: 10, Text: "/help plugins"}); !strings.HasPrefix(reply, "没有这个指令") {
+		t.Errorf("/help plugins as member: reply = %q", reply)
+	}
+}
+
+func TestStats(t *testing.T) {
+	for _, qq := range []int64{11, 11, 12} {
+		groupSay(t, fakeonebot.Message{GroupID: 11, UserID: qq, Text: "2d6"})
+	}
+	// /stats 本身也会被记下来
+	reply := groupSay(t, fakeonebot.Message{GroupID: 11, UserID: 11, Text: "/stats"})
+	if want := "今天发言排行：\n1. user11 3 条\n2. user12 1 条"; reply != want {
+		t.Errorf("/stats: reply = %q, want %q", reply, want)
+	}
+	reply = groupSay(t, fakeonebot.Message{GroupID: 11, UserID: 12, Text: "/stats me"})
+	if !strings.HasPrefix(reply, "user12 的发言：今天 2 条") || !strings.Contains(reply, "近 30 天排第 2") {
+		t.Errorf("/stats me: reply = %q", reply)
+	}
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 11, UserID: 12, Text: "/stats hours"}); !strings.HasPrefix(reply, "近 30 天各时段发言：") {
+		t.Errorf("/stats hours: reply = %q", reply)
+	}
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 11, UserID: 12, Text: "/stats year"}); !strings.HasPrefix(reply, "用法") {
+		t.Errorf("/stats year: reply = %q", reply)
+	}
+	// 私聊没有统计
+	expectSilence(t, fakeonebot.Message{UserID: 11, Text: "/stats"})
+}
+
+func TestSearch(t *testing.T) {
+	id, err := bot.Send(fakeonebot.Message{GroupID: 12, UserID: 13, Text: "sb老王"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bot.WaitGroupReply(12, replyTimeout); !ok {
+		t.Fatal("sb老王: no reply")
+	}
+	if _, err := bot.Send(fakeonebot.Message{GroupID: 12, UserID: 14, Text: "/search 老王"}); err != nil {
+		t.Fatal(err)
+	}
+	call, ok := bot.WaitGroupReply(12, replyTimeout)
+	if !ok {
+		t.Fatal("/search: no reply")
+	}
+	if text := call.Text(); !strings.HasPrefix(text, "user13 ") || !strings.HasSuffix(text, "：sb老王") {
+		t.Errorf("/search: reply = %q", text)
+	}
+	// 引用原消息
+	if replies := call.Segments("reply"); len(replies) != 1 || replies[0].Get("data.id").String() != strconv.FormatInt(id, 10) {
+		t.Errorf("/search: reply segments = %v, want id %d", replies, id)
+	}
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 12, UserID: 14, Text: "/who-said 老王"}); !strings.HasPrefix(reply, "说“老王”最多的：user13 1 次") {
+		t.Errorf("/who-said: reply = %q", reply)
+	}
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 12, UserID: 13, Text: "/search optout"}); reply != "好的，你在本群说的话不会再被搜到" {
+		t.Errorf("/search optout: reply = %q", reply)
+	}
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 12, UserID: 14, Text: "/search 老王"}); reply != "没有找到" {
+		t.Errorf("/search after optout: reply = %q", reply)
+	}
+}
+
+func TestLearnQueue(t *testing.T) {
+	// 有回复的消息才能确定已经记下来了
+	for i := 0; i < 3; i++ {
+		groupSay(t, fakeonebot.Message{GroupID: 13, UserID: 20, Text: "sb老王"})
+		groupSay(t, fakeonebot.Message{GroupID: 13, UserID: 21, Text: "lj老王"})
+	}
+	admin := fakeonebot.Message{GroupID: 13, UserID: 22, Role: "admin"}
+	admin.Text = "/learn-queue mine"
+	if reply := groupSay(t, admin); reply != "找到 1 条新的候选回复" {
+		t.Fatalf("/learn-queue mine: reply = %q", reply)
+	}
+	admin.Text = "/learn-queue"
+	reply := groupSay(t, admin)
+	matched := regexp.MustCompile(`#(\d+) sb老王 → lj老王（3 次）`).FindStringSubmatch(reply)
+	if matched == nil {
+		t.Fatalf("/learn-queue: reply = %q", reply)
+	}
+	// 普通群员不能审核
+	expectSilence(t, fakeonebot.Message{GroupID: 13, UserID: 20, Text: "/learn-queue approve " + matched[1]})
+	admin.Text = "/learn-queue approve " + matched[1]
+	if reply := groupSay(t, admin); !strings.HasSuffix(reply, "sb老王 → lj老王：已加入") {
+		t.Errorf("/learn-queue approve: reply = %q", reply)
+	}
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM replies WHERE group_number=13 AND keyword='sb老王' AND reply='lj老王'`); err != nil || count != 1 {
+		t.Errorf("replies count = %d, %v", count, err)
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	admin := fakeonebot.Message{GroupID: 14, UserID: 30, Role: "admin"}
+	admin.Text = "/repeat threshold 2"
+	groupSay(t, admin)
+	admin.Text = "/repeat chance 100"
+	if reply := groupSay(t, admin); reply != "复读设置：2 个人发同一句话时有 100% 的概率跟一次，不打断" {
+		t.Errorf("/repeat: reply = %q", reply)
+	}
+	admin.Text = "/repeat chance 200"
+	if reply := groupSay(t, admin); reply != "chance 要在 0 到 100 之间" {
+		t.Errorf("/repeat chance 200: reply = %q", reply)
+	}
+	// 一个人自己重复不算复读
+	if _, err := bot.Send(fakeonebot.Message{GroupID: 14, UserID: 31, Text: "+1"}); err != nil {
+		t.Fatal(err)
+	}
+	expectSilence(t, fakeonebot.Message{GroupID: 14, UserID: 31, Text: "+1"})
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 14, UserID: 32, Text: "+1"}); reply != "+1" {
+		t.Errorf("repeat: reply = %q", reply)
+	}
+	// 只跟一次
+	expectSilence(t, fakeonebot.Message{GroupID: 14, UserID: 33, Text: "+1"})
+}
+
+// waitAction 等 bot 调用某个 API
+func waitAction(t *testing.T, action string) fakeonebot.Call {
+	t.Helper()
+	call, ok := bot.Wait(replyTimeout, func(c fakeonebot.Call) bool { return c.Action == action })
+	if !ok {
+		t.Fatalf("no %s", action)
+	}
+	return call
+}
+
+func TestModeration(t *testing.T) {
+	admin := fakeonebot.Message{GroupID: 15, UserID: 40, Role: "admin"}
+	for _, step := range []struct{ text, want string }{
+		{"/mod add plain 广告 recall", "已添加 #1 [plain] 广告 → 撤回"},
+		{"/mod add fuzzy 代开发票 mute 30", "已添加 #2 [fuzzy] 代开发票 → 禁言 30 分钟"},
+		{"/mod add regex ( warn", "正则表达式有误：error parsing regexp: missing closing ): `(`"},
+		{"/mod add plain 广告 mute 999999", "禁言时长要在 1 到 43200 分钟之间"},
+		{"/mod kick 2", "好的，违规 2 次踢出本群"},
+	} {
+		admin.Text = step.text
+		if reply := groupSay(t, admin); reply != step.want {
+			t.Errorf("%s: reply = %q, want %q", step.text, reply, step.want)
+		}
+	}
+	// 管理员不受规则限制
+	expectSilence(t, fakeonebot.Message{GroupID: 15, UserID: 40, Role: "admin", Text: "广告"})
+
+	msgID, err := bot.Send(fakeonebot.Message{GroupID: 15, UserID: 41, Text: "看广告"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if call := waitAction(t, "delete_msg"); call.Params.Get("message_id").Int() != msgID {
+		t.Errorf("delete_msg: message_id = %s, want %d", call.Params.Get("message_id"), msgID)
+	}
+	if call, _ := bot.WaitGroupReply(15, replyTimeout); call.Text() != "user41 的消息违反了本群规则，已撤回（第 1 次违规）" {
+		t.Errorf("recall: reply = %q", call.Text())
+	}
+
+	// 第二次违规：撤回、禁言，够次数踢出
+	if _, err := bot.Send(fakeonebot.Message{GroupID: 15, UserID: 41, Text: "代 开 发 票"}); err != nil {
+		t.Fatal(err)
+	}
+	if call := waitAction(t, "set_group_ban"); call.Params.Get("duration").Int() != 1800 {
+		t.Errorf("set_group_ban: duration = %s", call.Params.Get("duration"))
+	}
+	if call := waitAction(t, "set_group_kick"); call.UserID() != 41 {
+		t.Errorf("set_group_kick: user_id = %d", call.UserID())
+	}
+	if call, _ := bot.WaitGroupReply(15, replyTimeout); call.Text() != "user41 违规 2 次，已移出本群" {
+		t.Errorf("kick: reply = %q", call.Text())
+	}
+
+	admin.Text = "/mod strikes 41"
+	if reply := groupSay(t, admin); reply != "user41 目前违规 0 次，2 次踢出" {
+		t.Errorf("/mod strikes: reply = %q", reply)
+	}
+	admin.Text = "/mod log"
+	if reply := groupSay(t, admin); !strings.Contains(reply, "user41 踢出 规则#2：代 开 发 票") || !strings.Contains(reply, "user41 撤回 规则#1：看广告") {
+		t.Errorf("/mod log: reply = %q", reply)
+	}
+	admin.Text = "/mod del 1"
+	if reply := groupSay(t, admin); reply != "已删除 #1" {
+		t.Errorf("/mod del: reply = %q", reply)
+	}
+	expectSilence(t, fakeonebot.Message{GroupID: 15, UserID: 42, Text: "看广告"})
+	// 普通群友不能用 /mod
+	expectSilence(t, fakeonebot.Message{GroupID: 15, UserID: 42, Text: "/mod kick 0"})
+}
+
+func TestAntiSpam(t *testing.T) {
+	admin := fakeonebot.Message{GroupID: 16, UserID: 50, Role: "admin"}
+	admin.Text = "/antispam messages 3"
+	if reply := groupSay(t, admin); reply != "刷屏限制：每人 10 秒内最多 3 条、同一句话最多 3 遍、图片最多 4 张" {
+		t.Errorf("/antispam messages 3: reply = %q", reply)
+	}
+	admin.Text = "/antispam images 200"
+	if reply := groupSay(t, admin); reply != "images 要在 0 到 100 之间" {
+		t.Errorf("/antispam images 200: reply = %q", reply)
+	}
+	for _, text := range []string{"一", "二", "三"} {
+		expectSilence(t, fakeonebot.Message{GroupID: 16, UserID: 51, Text: text})
+	}
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 16, UserID: 51, Text: "四"}); reply != "说话太快了，1 分钟内不再回应你" {
+		t.Errorf("flood: reply = %q", reply)
+	}
+	expectSilence(t, fakeonebot.Message{GroupID: 16, UserID: 51, Text: "2d6"})
+	// 别人照常
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 16, UserID: 52, Text: "2d6"}); !strings.HasPrefix(reply, "[2d6] = ") {
+		t.Errorf("2d6 from another member: reply = %q", reply)
+	}
+	admin.Text = "/antispam"
+	if reply := groupSay(t, admin); !strings.Contains(reply, "user51 还要忽略 1 分钟") {
+		t.Errorf("/antispam: reply = %q", reply)
+	}
+	admin.Text = "/antispam pardon 51"
+	if reply := groupSay(t, admin); reply != "好的，不再忽略 user51" {
+		t.Errorf("/antispam pardon: reply = %q", reply)
+	}
+	if reply := groupSay(t, fakeonebot.Message{GroupID: 16, UserID: 51, Text: "2d6"}); !strings.HasPrefix(reply, "[2d6] = ") {
+		t.Errorf("2d6 after pardon: reply = %q", reply)
+	}
+	// 私聊里谁都不是管理员，照样限制
+	for i := 1; i <= 8; i++ {
+		expectSilence(t, fakeonebot.Message{UserID: 53, Text: fmt.Sprintf("私聊 %d", i)})
+	}
+	if reply := groupSay(t, fakeonebot.Message{UserID: 53, Text: "私聊 9"}); reply != "说话太快了，1 分钟内不再回应你" {
+		t.Errorf("private flood: reply = %q", reply)
+	}
+}
@@ -0,0 +1,57 @@
+// Package chatlog 把群消息记到 group_messages 表里，统计和搜索都用这张表
+package chatlog
+
+import (
+	"time"
+
+	"github.com/doylecnn/qqbot/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+)
+
+var db *sqlx.DB
+
+// Plugin 记录群消息，要注册在最前面，不然被其他模块拦下的消息就记不到了
+type Plugin struct{}
+
+func (Plugin) Name() string { return "chatlog" }
+
+func (Plugin) Description() string {
+	return "记录群消息，给 /stats 统计用，关掉后本群不再记录"
+}
+
+func (Plugin) Init(config *toml.Tree, database *sqlx.DB) error {
+	db = database
+	return nil
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnMessage(zero.OnlyGroup).Handle(Record)
+}
+
+func (Plugin) Shutdown() {}
+
+// Record 保存一条群消息，group_id 是 groups 表里的编号，没有登记过的群为 0
+func Record(ctx *zero.Ctx) {
+	if db == nil {
+		return
+	}
+	msgID, _ := ctx.Event.MessageID.(int64)
+	t := ctx.Event.Time
+	if t == 0 {
+		t = time.Now().Unix()
+	}
+	_, err := db.Exec(`INSERT INTO group_messages(msg_id, group_id, group_number, qq_number, message, time)
+	VALUES (?, COALESCE((SELECT id FROM groups WHERE number=?), 0), ?, ?, ?, ?)`,
+		msgID, ctx.Event.GroupID, ctx.Event.GroupID, ctx.Event.UserID, ctx.MessageString(), t)
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event":     "Chat Log",
+			"call":      "Exec",
+			"err":       err,
+			"QQGroupId": ctx.Event.GroupID,
+		}).Warningln("记录群消息失败")
+	}
+}
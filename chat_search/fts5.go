@@ -0,0 +1,57 @@
+package chatsearch
+
+import (
+	"github.com/doylecnn/qqbot/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// setupFTS 建 group_messages 的全文索引，用触发器跟着原表更新，触发器是新建的时候把旧消息也加进去。
+// go-sqlite3 要用 -tags sqlite_fts5 编译才有 FTS5，没有的话启动时提示并改用 LIKE 搜索
+func setupFTS(db *sqlx.DB) {
+	var enabled int
+	if err := db.Get(&enabled, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`); err == nil && enabled == 0 {
+		// 以前用 FTS5 建过的触发器会让写聊天记录失败，先删掉，再用 FTS5 启动时会重建索引
+		_, err = db.Exec(`DROP TRIGGER IF EXISTS group_messages_fts_insert;
+DROP TRIGGER IF EXISTS group_messages_fts_delete;
+DROP TRIGGER IF EXISTS group_messages_fts_update;`)
+		log.Log.WithFields(logrus.Fields{
+			"event": "Chat Search",
+			"err":   err,
+		}).Warningln("编译时没有加 -tags sqlite_fts5，改用 LIKE 搜索")
+		return
+	}
+	var exists int
+	if err := db.Get(&exists, `SELECT COUNT(*) FROM sqlite_master WHERE type='trigger' AND name='group_messages_fts_insert'`); err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Chat Search",
+			"err":   err,
+		}).Warningln("检查全文索引失败，改用 LIKE 搜索")
+		return
+	}
+	_, err := db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS group_messages_fts USING fts5(message, content='group_messages', content_rowid='id', tokenize='trigram');
+CREATE TRIGGER IF NOT EXISTS group_messages_fts_insert AFTER INSERT ON group_messages BEGIN
+	INSERT INTO group_messages_fts(rowid, message) VALUES (new.id, new.message);
+END;
+CREATE TRIGGER IF NOT EXISTS group_messages_fts_delete AFTER DELETE ON group_messages BEGIN
+	INSERT INTO group_messages_fts(group_messages_fts, rowid, message) VALUES ('delete', old.id, old.message);
+END;
+CREATE TRIGGER IF NOT EXISTS group_messages_fts_update AFTER UPDATE OF message ON group_messages BEGIN
+	INSERT INTO group_messages_fts(group_messages_fts, rowid, message) VALUES ('delete', old.id, old.message);
+	INSERT INTO group_messages_fts(rowid, message) VALUES (new.id, new.message);
+END;`)
+	if err == nil && exists == 0 {
+		_, err = db.Exec(`INSERT INTO group_messages_fts(group_messages_fts) VALUES ('rebuild')`)
+	}
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Chat Search",
+			"err":   err,
+		}).Warningln("建全文索引失败，改用 LIKE 搜索")
+		return
+	}
+	ftsReady = true
+	log.Log.WithFields(logrus.Fields{
+		"event": "Chat Search",
+	}).Infoln("使用 FTS5 全文索引搜索")
+}
@@ -0,0 +1,37 @@
+package chatsearch
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// ftsMinLength trigram 分词至少要三个字，更短的关键词用 LIKE
+const ftsMinLength = 3
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func likeClause(keyword string) (string, interface{}) {
+	return `message LIKE ? ESCAPE '\'`, "%" + escapeLike(keyword) + "%"
+}
+
+// matchClause 所有关键词都要出现，能用全文索引的用全文索引
+func matchClause(keywords []string) (string, []interface{}) {
+	var clauses, fts []string
+	var params []interface{}
+	for _, k := range keywords {
+		if ftsReady && utf8.RuneCountInString(k) >= ftsMinLength {
+			fts = append(fts, `"`+strings.ReplaceAll(k, `"`, `""`)+`"`)
+			continue
+		}
+		clause, param := likeClause(k)
+		clauses = append(clauses, clause)
+		params = append(params, param)
+	}
+	if len(fts) > 0 {
+		clauses = append(clauses, `id IN (SELECT rowid FROM group_messages_fts WHERE group_messages_fts MATCH ?)`)
+		params = append(params, strings.Join(fts, " "))
+	}
+	return strings.Join(clauses, " AND "), params
+}
@@ -0,0 +1,252 @@
+// Package chatsearch 在本群的聊天记录里搜索：/search、/who-said。
+// 用 go build -tags sqlite_fts5 编译时走 FTS5 全文索引，否则启动时提示并改用 LIKE
+package chatsearch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	groupsettings "github.com/doylecnn/qqbot/group_settings"
+	"github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	resultLimit = 3
+	whoLimit    = 5
+	// optOutPrefix 群设置里不让别人搜到自己的人，后面跟 QQ 号
+	optOutPrefix = "search.optout."
+)
+
+var (
+	db *sqlx.DB
+	// ftsReady 全文索引建好了
+	ftsReady bool
+)
+
+// Plugin 聊天记录搜索，消息由 chatlog 模块记录
+type Plugin struct{}
+
+func (Plugin) Name() string { return "search" }
+
+func (Plugin) Description() string { return "聊天记录搜索：/search、/who-said" }
+
+func (Plugin) Init(config *toml.Tree, database *sqlx.DB) error {
+	db = database
+	ftsReady = false
+	if db != nil {
+		setupFTS(db)
+	}
+	return nil
+}
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "search", Usage: "/search 关键词...", Description: "在本群聊天记录里搜索，引用最近几条", Examples: []string{"/search 汉兜", "/search 周末 吃饭"}, GroupOnly: true},
+		{Name: "search optout", Usage: "/search optout|optin", Description: "自己在本群说的话不让别人搜到，optin 恢复", GroupOnly: true},
+		{Name: "who-said", Usage: "/who-said 一句话", Description: "谁说这句话最多，第一次是谁说的", Examples: []string{"/who-said 确实"}, GroupOnly: true},
+	}
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnCommand("search", zero.OnlyGroup).Handle(SearchCommand)
+	engine.OnCommand("who-said", zero.OnlyGroup).Handle(WhoSaidCommand)
+}
+
+func (Plugin) Shutdown() {}
+
+type record struct {
+	MsgID int64  `db:"msg_id"`
+	QQ    int64  `db:"qq_number"`
+	Text  string `db:"message"`
+	Time  int64  `db:"time"`
+}
+
+// optedOut 本群不让别人搜到自己的人
+func optedOut(groupID int64) (qqs []int64) {
+	for _, key := range groupsettings.Keys(groupID) {
+		if !strings.HasPrefix(key, optOutPrefix) || groupsettings.Get(groupID, key, "") != "on" {
+			continue
+		}
+		if qq, err := strconv.ParseInt(strings.TrimPrefix(key, optOutPrefix), 10, 64); err == nil {
+			qqs = append(qqs, qq)
+		}
+	}
+	return
+}
+
+// where 本群、包含所有关键词、不是指令、发言人没有退出搜索
+func where(groupID int64, keywords []string) (string, []interface{}, error) {
+	clause, params := matchClause(keywords)
+	query := `group_number=? AND message NOT LIKE '/%' AND ` + clause
+	params = append([]interface{}{groupID}, params...)
+	if qqs := optedOut(groupID); len(qqs) > 0 {
+		in, args, err := sqlx.In(` AND qq_number NOT IN (?)`, qqs)
+		if err != nil {
+			return "", nil, err
+		}
+		query += in
+		params = append(params, args...)
+	}
+	return query, params, nil
+}
+
+// search 最近的几条匹配的消息
+func search(groupID int64, keywords []string, limit int) (records []record, err error) {
+	clause, params, err := where(groupID, keywords)
+	if err != nil {
+		return
+	}
+	err = db.Select(&records, `SELECT msg_id, qq_number, message, time FROM group_messages WHERE `+clause+` ORDER BY id DESC LIMIT ?`, append(params, limit)...)
+	return
+}
+
+type speaker struct {
+	QQ    int64 `db:"qq_number"`
+	Count int   `db:"n"`
+}
+
+// whoSaid 说这句话最多的人和第一次说的记录
+func whoSaid(groupID int64, phrase string, limit int) (speakers []speaker, first record, err error) {
+	clause, params, err := where(groupID, []string{phrase})
+	if err != nil {
+		return
+	}
+	if err = db.Select(&speakers, `SELECT qq_number, COUNT(*) AS n FROM group_messages WHERE `+clause+`
+	GROUP BY qq_number ORDER BY n DESC, qq_number LIMIT ?`, append(params, limit)...); err != nil || len(speakers) == 0 {
+		return
+	}
+	err = db.Get(&first, `SELECT msg_id, qq_number, message, time FROM group_messages WHERE `+clause+` ORDER BY id LIMIT 1`, params...)
+	return
+}
+
+var (
+	reImage  = regexp.MustCompile(`\[CQ:image,[^\]]*\]`)
+	reCQCode = regexp.MustCompile(`\[CQ:[^\]]*\]`)
+)
+
+// plainText 图片换成 [图片]，其他 CQ 码去掉
+func plainText(s string) string {
+	return strings.TrimSpace(reCQCode.ReplaceAllString(reImage.ReplaceAllString(s, "[图片]"), ""))
+}
+
+func formatTime(t int64, now time.Time) string {
+	tm := time.Unix(t, 0)
+	if tm.Year() != now.Year() {
+		return tm.Format("2006-01-02 15:04")
+	}
+	return tm.Format("01-02 15:04")
+}
+
+func name(ctx *zero.Ctx, qq int64) string {
+	if n := ctx.CardOrNickName(qq); n != "" {
+		return n
+	}
+	return strconv.FormatInt(qq, 10)
+}
+
+func logError(ctx *zero.Ctx, call string, err error) {
+	log.Log.WithFields(logrus.Fields{
+		"event":     "Chat Search",
+		"call":      call,
+		"err":       err,
+		"QQGroupId": ctx.Event.GroupID,
+	}).Warningln("搜索失败")
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("搜索失败了，稍后再试试")))
+}
+
+func setOptOut(ctx *zero.Ctx, optOut bool) {
+	value := "off"
+	if optOut {
+		value = "on"
+	}
+	key := optOutPrefix + strconv.FormatInt(ctx.Event.UserID, 10)
+	if err := groupsettings.Set(ctx.Event.GroupID, key, value); err != nil {
+		logError(ctx, "Set", err)
+		return
+	}
+	if optOut {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("好的，你在本群说的话不会再被搜到")))
+	} else {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("好的，你在本群说的话又可以被搜到了")))
+	}
+}
+
+// SearchCommand /search 关键词...，每条结果引用原消息，可以点回去看上下文
+func SearchCommand(ctx *zero.Ctx) {
+	defer ctx.Block()
+	if db == nil {
+		return
+	}
+	args, _ := ctx.State["args"].(string)
+	keywords := strings.Fields(args)
+	if len(keywords) == 1 {
+		switch strings.ToLower(keywords[0]) {
+		case "optout":
+			setOptOut(ctx, true)
+			return
+		case "optin":
+			setOptOut(ctx, false)
+			return
+		}
+	}
+	if len(keywords) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("用法：/search 关键词...")))
+		return
+	}
+	records, err := search(ctx.Event.GroupID, keywords, resultLimit)
+	if err != nil {
+		logError(ctx, "search", err)
+		return
+	}
+	if len(records) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("没有找到")))
+		return
+	}
+	now := time.Now()
+	for _, r := range records {
+		text := message.Text(fmt.Sprintf("%s %s：%s", name(ctx, r.QQ), formatTime(r.Time, now), plainText(r.Text)))
+		if r.MsgID == 0 {
+			ctx.Send(text)
+		} else {
+			ctx.Send(message.ReplyWithMessage(r.MsgID, text))
+		}
+	}
+}
+
+// WhoSaidCommand /who-said 一句话
+func WhoSaidCommand(ctx *zero.Ctx) {
+	defer ctx.Block()
+	if db == nil {
+		return
+	}
+	args, _ := ctx.State["args"].(string)
+	phrase := strings.TrimSpace(args)
+	if phrase == "" {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("用法：/who-said 一句话")))
+		return
+	}
+	speakers, first, err := whoSaid(ctx.Event.GroupID, phrase, whoLimit)
+	if err != nil {
+		logError(ctx, "whoSaid", err)
+		return
+	}
+	if len(speakers) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("没有人说过“"+phrase+"”")))
+		return
+	}
+	parts := make([]string, len(speakers))
+	for i, s := range speakers {
+		parts[i] = fmt.Sprintf("%s %d 次", name(ctx, s.QQ), s.Count)
+	}
+	text := fmt.Sprintf("说“%s”最多的：%s\n第一次是 %s 在 %s 说的", phrase, strings.Join(parts, "、"), name(ctx, first.QQ), formatTime(first.Time, time.Now()))
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(text)))
+}
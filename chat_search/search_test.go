@@ -0,0 +1,90 @@
+package chatsearch
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	groupsettings "github.com/doylecnn/qqbot/group_settings"
+	testdb "github.com/doylecnn/qqbot/test_db"
+	"github.com/jmoiron/sqlx"
+)
+
+// useTestDB 换成内存数据库，用 -tags sqlite_fts5 测试时也会建全文索引
+func useTestDB(t *testing.T) {
+	database := testdb.New(t)
+	// 建索引之前的消息也要能搜到
+	insert(database, 1, 100, 1, "很早以前说过汉兜真好玩")
+	Plugin{}.Init(nil, database)
+	groupsettings.Init(database)
+	t.Cleanup(func() {
+		groupsettings.Init(nil)
+		db = nil
+	})
+}
+
+func insert(database *sqlx.DB, groupID, qq, msgID int64, text string) {
+	database.MustExec(`INSERT INTO group_messages(msg_id, group_id, group_number, qq_number, message, time) VALUES (?, 0, ?, ?, ?, ?)`,
+		msgID, groupID, qq, text, time.Now().Unix())
+}
+
+func msgIDs(records []record) (ids []int64) {
+	for _, r := range records {
+		ids = append(ids, r.MsgID)
+	}
+	return
+}
+
+func TestSearch(t *testing.T) {
+	useTestDB(t)
+	t.Logf("ftsReady = %v", ftsReady)
+	insert(db, 1, 200, 2, "今天汉兜真难")
+	insert(db, 1, 100, 3, "汉兜真好玩，周末再来")
+	insert(db, 1, 300, 4, "/search 汉兜真好玩")
+	insert(db, 2, 100, 5, "别的群：汉兜真好玩")
+	insert(db, 1, 200, 6, "100%_的把握")
+
+	for _, c := range []struct {
+		keywords []string
+		want     []int64
+	}{
+		{[]string{"汉兜真好玩"}, []int64{3, 1}},
+		{[]string{"汉兜", "周末"}, []int64{3}},
+		{[]string{"汉兜"}, []int64{3, 2, 1}},
+		{[]string{"%_"}, []int64{6}},
+		{[]string{"没有的话"}, nil},
+	} {
+		records, err := search(1, c.keywords, resultLimit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := msgIDs(records); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("search(%q) = %v, want %v", c.keywords, got, c.want)
+		}
+	}
+
+	speakers, first, err := whoSaid(1, "汉兜", whoLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(speakers) != 2 || speakers[0].QQ != 100 || speakers[0].Count != 2 || first.MsgID != 1 {
+		t.Errorf("whoSaid = %v, %v", speakers, first)
+	}
+
+	// 退出搜索之后别人搜不到
+	if err := groupsettings.Set(1, optOutPrefix+"100", "on"); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := search(1, []string{"汉兜"}, resultLimit); len(records) != 1 || records[0].QQ != 200 {
+		t.Errorf("after optout: %v", records)
+	}
+	if speakers, _, _ := whoSaid(1, "汉兜", whoLimit); len(speakers) != 1 {
+		t.Errorf("after optout whoSaid = %v", speakers)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	if s := plainText("看[CQ:image,file=abc.jpg]这个[CQ:face,id=1]"); s != "看[图片]这个" {
+		t.Errorf("plainText = %q", s)
+	}
+}
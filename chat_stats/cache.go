@@ -0,0 +1,46 @@
+package chatstats
+
+import (
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// ttlCache 统计结果缓存一会儿，同一个群连着查不用每次都扫表
+type ttlCache struct {
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	mux     sync.Mutex
+}
+
+func newCache(ttl time.Duration) *ttlCache {
+	return &ttlCache{ttl: ttl, entries: make(map[string]cacheEntry)}
+}
+
+// get 缓存里没有或者过期了就调用 compute，出错时不缓存
+func (c *ttlCache) get(key string, compute func() (interface{}, error)) (interface{}, error) {
+	now := time.Now()
+	c.mux.Lock()
+	if e, exists := c.entries[key]; exists && now.Before(e.expires) {
+		c.mux.Unlock()
+		return e.value, nil
+	}
+	c.mux.Unlock()
+	value, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(c.ttl)}
+	return value, nil
+}
@@ -0,0 +1,123 @@
+package chatstats
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/doylecnn/qqbot/render"
+	"github.com/fogleman/gg"
+)
+
+const (
+	chartPadding    = 24
+	chartTitleSize  = 26
+	chartLabelSize  = 18
+	barHeight       = 28
+	barGap          = 10
+	barLabelWidth   = 160
+	barMaxWidth     = 400
+	heatCell        = 24
+	heatLabelWidth  = 40
+	chartBackground = "#ffffff"
+	chartText       = "#393e46"
+	chartBar        = "#1d9c9c"
+)
+
+var weekdayNames = []string{"日", "一", "二", "三", "四", "五", "六"}
+
+// drawBarChart 横向柱状图，一行一个标签
+func drawBarChart(title string, labels []string, values []int) (image.Image, error) {
+	titleFace, err := render.LoadFontFace(render.HanFont, nil, chartTitleSize)
+	if err != nil {
+		return nil, err
+	}
+	defer titleFace.Close()
+	labelFace, err := render.LoadFontFace(render.HanFont, nil, chartLabelSize)
+	if err != nil {
+		return nil, err
+	}
+	defer labelFace.Close()
+
+	most := 1
+	for _, v := range values {
+		if v > most {
+			most = v
+		}
+	}
+	top := chartPadding + chartTitleSize*2
+	width := chartPadding*2 + barLabelWidth + barMaxWidth + 80
+	height := top + len(values)*(barHeight+barGap) + chartPadding
+	dc := gg.NewContext(width, height)
+	dc.SetHexColor(chartBackground)
+	dc.Clear()
+	dc.SetFontFace(titleFace)
+	dc.SetHexColor(chartText)
+	dc.DrawStringAnchored(title, float64(chartPadding), float64(chartPadding+chartTitleSize/2), 0, 0.5)
+
+	dc.SetFontFace(labelFace)
+	for i, v := range values {
+		y := float64(top + i*(barHeight+barGap))
+		label := labels[i]
+		for w, _ := dc.MeasureString(label); w > barLabelWidth-8 && len([]rune(label)) > 1; w, _ = dc.MeasureString(label + "…") {
+			label = string([]rune(label)[:len([]rune(label))-1])
+		}
+		if label != labels[i] {
+			label += "…"
+		}
+		dc.SetHexColor(chartText)
+		dc.DrawStringAnchored(label, float64(chartPadding+barLabelWidth-8), y+barHeight/2, 1, 0.5)
+		barWidth := float64(barMaxWidth) * float64(v) / float64(most)
+		dc.SetHexColor(chartBar)
+		dc.DrawRectangle(float64(chartPadding+barLabelWidth), y, barWidth, barHeight)
+		dc.Fill()
+		dc.SetHexColor(chartText)
+		dc.DrawStringAnchored(fmt.Sprint(v), float64(chartPadding+barLabelWidth)+barWidth+8, y+barHeight/2, 0, 0.5)
+	}
+	return dc.Image(), nil
+}
+
+// drawHeatmap 星期 × 小时的热力图，颜色越深发言越多
+func drawHeatmap(title string, h heatmap) (image.Image, error) {
+	titleFace, err := render.LoadFontFace(render.HanFont, nil, chartTitleSize)
+	if err != nil {
+		return nil, err
+	}
+	defer titleFace.Close()
+	labelFace, err := render.LoadFontFace(render.HanFont, nil, chartLabelSize-4)
+	if err != nil {
+		return nil, err
+	}
+	defer labelFace.Close()
+
+	_, _, most := h.busiest()
+	if most == 0 {
+		most = 1
+	}
+	top := chartPadding + chartTitleSize*2 + heatCell
+	left := chartPadding + heatLabelWidth
+	dc := gg.NewContext(left+24*heatCell+chartPadding, top+7*heatCell+chartPadding)
+	dc.SetHexColor(chartBackground)
+	dc.Clear()
+	dc.SetFontFace(titleFace)
+	dc.SetHexColor(chartText)
+	dc.DrawStringAnchored(title, float64(chartPadding), float64(chartPadding+chartTitleSize/2), 0, 0.5)
+
+	dc.SetFontFace(labelFace)
+	for hour := 0; hour < 24; hour += 3 {
+		dc.DrawStringAnchored(fmt.Sprint(hour), float64(left+hour*heatCell+heatCell/2), float64(top-heatCell/2), 0.5, 0.5)
+	}
+	// 从周一排到周日
+	for row := 0; row < 7; row++ {
+		weekday := (row + 1) % 7
+		y := float64(top + row*heatCell)
+		dc.SetHexColor(chartText)
+		dc.DrawStringAnchored("周"+weekdayNames[weekday], float64(left-8), y+heatCell/2, 1, 0.5)
+		for hour := 0; hour < 24; hour++ {
+			alpha := 0.06 + 0.94*float64(h[weekday][hour])/float64(most)
+			dc.SetRGBA(29/255.0, 156/255.0, 156/255.0, alpha)
+			dc.DrawRectangle(float64(left+hour*heatCell)+1, y+1, heatCell-2, heatCell-2)
+			dc.Fill()
+		}
+	}
+	return dc.Image(), nil
+}
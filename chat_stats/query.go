@@ -0,0 +1,195 @@
+package chatstats
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// period 统计的时间范围
+type period struct {
+	Name  string
+	Label string
+	Start func(now time.Time) time.Time
+}
+
+var periods = map[string]period{
+	"today": {"today", "今天", func(now time.Time) time.Time {
+		y, m, d := now.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	}},
+	"week": {"week", "近 7 天", func(now time.Time) time.Time {
+		return now.AddDate(0, 0, -7)
+	}},
+	"month": {"month", "近 30 天", func(now time.Time) time.Time {
+		return now.AddDate(0, 0, -30)
+	}},
+}
+
+var periodAliases = map[string]string{
+	"今天": "today",
+	"本周": "week",
+	"本月": "month",
+}
+
+func parsePeriod(s, defaultName string) (period, bool) {
+	if s == "" {
+		s = defaultName
+	}
+	s = strings.ToLower(s)
+	if alias, exists := periodAliases[s]; exists {
+		s = alias
+	}
+	p, exists := periods[s]
+	return p, exists
+}
+
+type talker struct {
+	QQ    int64 `db:"qq_number"`
+	Count int   `db:"n"`
+}
+
+// topTalkers 发言最多的人
+func topTalkers(groupID int64, since time.Time, limit int) (talkers []talker, err error) {
+	err = db.Select(&talkers, `SELECT qq_number, COUNT(*) AS n FROM group_messages
+	WHERE group_number=? AND time>=? GROUP BY qq_number ORDER BY n DESC, qq_number LIMIT ?`, groupID, since.Unix(), limit)
+	return
+}
+
+// heatmap 星期（0 是周日）× 小时的发言数，qq 为 0 时统计全群
+type heatmap [7][24]int
+
+func hourHeatmap(groupID, qq int64, since time.Time) (h heatmap, err error) {
+	rows := []struct {
+		Weekday int `db:"weekday"`
+		Hour    int `db:"hour"`
+		Count   int `db:"n"`
+	}{}
+	query := `SELECT CAST(strftime('%w', time, 'unixepoch', 'localtime') AS INTEGER) AS weekday,
+	CAST(strftime('%H', time, 'unixepoch', 'localtime') AS INTEGER) AS hour, COUNT(*) AS n
+	FROM group_messages WHERE group_number=? AND time>=?`
+	params := []interface{}{groupID, since.Unix()}
+	if qq != 0 {
+		query += ` AND qq_number=?`
+		params = append(params, qq)
+	}
+	query += ` GROUP BY weekday, hour`
+	if err = db.Select(&rows, query, params...); err != nil {
+		return
+	}
+	for _, r := range rows {
+		if r.Weekday >= 0 && r.Weekday < 7 && r.Hour >= 0 && r.Hour < 24 {
+			h[r.Weekday][r.Hour] = r.Count
+		}
+	}
+	return
+}
+
+// hours 按小时合计
+func (h heatmap) hours() (hours [24]int) {
+	for _, day := range h {
+		for hour, n := range day {
+			hours[hour] += n
+		}
+	}
+	return
+}
+
+// busiest 发言最多的星期和小时
+func (h heatmap) busiest() (weekday, hour, count int) {
+	for w, day := range h {
+		for hr, n := range day {
+			if n > count {
+				weekday, hour, count = w, hr, n
+			}
+		}
+	}
+	return
+}
+
+type wordCount struct {
+	Word  string
+	Count int
+}
+
+// wordsScanLimit 热词只看最近这么多条消息
+const wordsScanLimit = 20000
+
+var reCQCode = regexp.MustCompile(`\[CQ:[^\]]*\]|https?://\S+`)
+
+// stopWords 太常见、没意思的词
+var stopWords = map[string]bool{
+	"我们": true, "你们": true, "他们": true, "这个": true, "那个": true, "什么": true,
+	"怎么": true, "就是": true, "还是": true, "没有": true, "不是": true, "可以": true,
+	"一个": true, "自己": true, "现在": true, "知道": true, "感觉": true, "然后": true,
+	"因为": true, "所以": true, "但是": true, "如果": true, "已经": true, "觉得": true,
+	"时候": true, "这样": true, "那么": true, "的话": true,
+}
+
+// countWords 统计消息里的词，单字、纯数字和停用词不算
+func countWords(messages []string, limit int) (words []wordCount) {
+	counts := make(map[string]int)
+	seg := segmenter()
+	for _, m := range messages {
+		for _, w := range seg.Cut(reCQCode.ReplaceAllString(m, " ")) {
+			if utf8.RuneCountInString(w) < 2 || stopWords[w] || strings.Trim(w, "0123456789") == "" {
+				continue
+			}
+			counts[w]++
+		}
+	}
+	for w, n := range counts {
+		words = append(words, wordCount{w, n})
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if words[i].Count != words[j].Count {
+			return words[i].Count > words[j].Count
+		}
+		return words[i].Word < words[j].Word
+	})
+	if len(words) > limit {
+		words = words[:limit]
+	}
+	return
+}
+
+// topWords 最常说的词，qq 为 0 时统计全群
+func topWords(groupID, qq int64, since time.Time, limit int) ([]wordCount, error) {
+	messages := []string{}
+	query := `SELECT message FROM group_messages WHERE group_number=? AND time>=?`
+	params := []interface{}{groupID, since.Unix()}
+	if qq != 0 {
+		query += ` AND qq_number=?`
+		params = append(params, qq)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	params = append(params, wordsScanLimit)
+	if err := db.Select(&messages, query, params...); err != nil {
+		return nil, err
+	}
+	return countWords(messages, limit), nil
+}
+
+type userSummary struct {
+	Total int `db:"total"`
+	Today int `db:"today"`
+	Week  int `db:"week"`
+	Month int `db:"month"`
+	// Rank 近 30 天在群里的排名，没发过言为 0
+	Rank int
+}
+
+func summarizeUser(groupID, qq int64, now time.Time) (s userSummary, err error) {
+	err = db.Get(&s, `SELECT COUNT(*) AS total,
+	COALESCE(SUM(time>=?), 0) AS today, COALESCE(SUM(time>=?), 0) AS week, COALESCE(SUM(time>=?), 0) AS month
+	FROM group_messages WHERE group_number=? AND qq_number=?`,
+		periods["today"].Start(now).Unix(), periods["week"].Start(now).Unix(), periods["month"].Start(now).Unix(), groupID, qq)
+	if err != nil || s.Month == 0 {
+		return
+	}
+	err = db.Get(&s.Rank, `SELECT COUNT(*) + 1 FROM (SELECT qq_number FROM group_messages
+	WHERE group_number=? AND time>=? GROUP BY qq_number HAVING COUNT(*) > ?)`, groupID, periods["month"].Start(now).Unix(), s.Month)
+	return
+}
@@ -0,0 +1,317 @@
+// Package chatstats 根据 group_messages 里记下的消息做群聊统计：/stats
+package chatstats
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+	"time"
+
+	hanyuwordle "github.com/doylecnn/qqbot/hanyu_wordle"
+	"github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/doylecnn/qqbot/render"
+	"github.com/doylecnn/qqbot/segment"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	defaultCacheTTL = 5 * time.Minute
+	topLimit        = 10
+	wordsLimit      = 20
+)
+
+var (
+	db    *sqlx.DB
+	cache = newCache(defaultCacheTTL)
+
+	segOnce sync.Once
+	seg     *segment.Segmenter
+)
+
+// segmenter 第一次统计热词时才加载词典
+func segmenter() *segment.Segmenter {
+	segOnce.Do(func() {
+		seg = segment.New(hanyuwordle.AllWords())
+	})
+	return seg
+}
+
+// Plugin 群聊统计，消息由 chatlog 模块记录
+type Plugin struct{}
+
+func (Plugin) Name() string { return "stats" }
+
+func (Plugin) Description() string { return "群聊统计：/stats" }
+
+func (Plugin) Init(config *toml.Tree, database *sqlx.DB) error {
+	db = database
+	ttl := defaultCacheTTL
+	if config != nil {
+		if s, ok := config.Get("stats.cache_ttl").(string); ok {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("stats.cache_ttl：%w", err)
+			}
+			ttl = d
+		}
+	}
+	cache = newCache(ttl)
+	return nil
+}
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "stats", Usage: "/stats [today|week|month]", Description: "发言排行，默认看今天", Examples: []string{"/stats", "/stats week"}, GroupOnly: true},
+		{Name: "stats hours", Usage: "/stats hours [today|week|month]", Description: "每周各时段的发言热力图，默认看近 30 天", GroupOnly: true},
+		{Name: "stats words", Usage: "/stats words [today|week|month]", Description: "群里最常说的词，默认看近 7 天", GroupOnly: true},
+		{Name: "stats me", Usage: "/stats me", Description: "自己的发言统计", GroupOnly: true},
+	}
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnCommand("stats", zero.OnlyGroup).Handle(Command)
+}
+
+func (Plugin) Shutdown() {}
+
+// Command /stats [hours|words|me] [today|week|month]
+func Command(ctx *zero.Ctx) {
+	defer ctx.Block()
+	if db == nil {
+		return
+	}
+	fields := []string{}
+	if args, ok := ctx.State["args"].(string); ok {
+		fields = strings.Fields(strings.ToLower(args))
+	}
+	sub, arg := "", ""
+	if len(fields) > 0 {
+		if _, exists := parsePeriod(fields[0], ""); exists {
+			arg = fields[0]
+		} else {
+			sub = fields[0]
+			if len(fields) > 1 {
+				arg = fields[1]
+			}
+		}
+	}
+	var err error
+	switch sub {
+	case "":
+		err = talkersCommand(ctx, arg)
+	case "hours", "时段":
+		err = hoursCommand(ctx, arg)
+	case "words", "热词":
+		err = wordsCommand(ctx, arg)
+	case "me", "我":
+		err = meCommand(ctx)
+	default:
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("用法：/stats [hours|words|me] [today|week|month]")))
+		return
+	}
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event":     "Chat Stats",
+			"Sub":       sub,
+			"err":       err,
+			"QQGroupId": ctx.Event.GroupID,
+		}).Warningln("统计失败")
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("统计失败了，稍后再试试")))
+	}
+}
+
+func periodArg(ctx *zero.Ctx, arg, defaultName string) (period, bool) {
+	p, exists := parsePeriod(arg, defaultName)
+	if !exists {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("时间范围只能是 today、week 或 month")))
+	}
+	return p, exists
+}
+
+// sendChart 发图，没有字体画不出来时发文字
+func sendChart(ctx *zero.Ctx, draw func() (image.Image, error), text string) {
+	img, err := draw()
+	var seg message.MessageSegment
+	if err == nil {
+		seg, err = render.EncodePNG(img)
+	}
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Chat Stats",
+			"err":   err,
+		}).Debugln("画图失败，改发文字")
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(text)))
+		return
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, seg))
+}
+
+func cacheKey(groupID int64, parts ...interface{}) string {
+	return fmt.Sprint(groupID, parts)
+}
+
+func talkersCommand(ctx *zero.Ctx, arg string) error {
+	p, ok := periodArg(ctx, arg, "today")
+	if !ok {
+		return nil
+	}
+	groupID := ctx.Event.GroupID
+	v, err := cache.get(cacheKey(groupID, "talkers", p.Name), func() (interface{}, error) {
+		return topTalkers(groupID, p.Start(time.Now()), topLimit)
+	})
+	if err != nil {
+		return err
+	}
+	talkers := v.([]talker)
+	if len(talkers) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(p.Label+"还没有人说话")))
+		return nil
+	}
+	title := p.Label + "发言排行"
+	labels := make([]string, len(talkers))
+	values := make([]int, len(talkers))
+	var sb strings.Builder
+	sb.WriteString(title + "：")
+	for i, t := range talkers {
+		labels[i] = ctx.CardOrNickName(t.QQ)
+		if labels[i] == "" {
+			labels[i] = fmt.Sprint(t.QQ)
+		}
+		values[i] = t.Count
+		fmt.Fprintf(&sb, "\n%d. %s %d 条", i+1, labels[i], t.Count)
+	}
+	sendChart(ctx, func() (image.Image, error) { return drawBarChart(title, labels, values) }, sb.String())
+	return nil
+}
+
+func heatmapText(title string, h heatmap) string {
+	var sb strings.Builder
+	sb.WriteString(title + "：")
+	for hour, n := range h.hours() {
+		if hour%6 == 0 {
+			sb.WriteString("\n")
+		} else {
+			sb.WriteString("  ")
+		}
+		fmt.Fprintf(&sb, "%02d点 %d", hour, n)
+	}
+	if weekday, hour, count := h.busiest(); count > 0 {
+		fmt.Fprintf(&sb, "\n最热闹的是周%s %d 点，%d 条", weekdayNames[weekday], hour, count)
+	}
+	return sb.String()
+}
+
+func hoursCommand(ctx *zero.Ctx, arg string) error {
+	p, ok := periodArg(ctx, arg, "month")
+	if !ok {
+		return nil
+	}
+	groupID := ctx.Event.GroupID
+	v, err := cache.get(cacheKey(groupID, "hours", p.Name), func() (interface{}, error) {
+		return hourHeatmap(groupID, 0, p.Start(time.Now()))
+	})
+	if err != nil {
+		return err
+	}
+	h := v.(heatmap)
+	title := p.Label + "各时段发言"
+	sendChart(ctx, func() (image.Image, error) { return drawHeatmap(title, h) }, heatmapText(title, h))
+	return nil
+}
+
+func wordsText(title string, words []wordCount) string {
+	parts := make([]string, len(words))
+	for i, w := range words {
+		parts[i] = fmt.Sprintf("%s(%d)", w.Word, w.Count)
+	}
+	return title + "：" + strings.Join(parts, "、")
+}
+
+func wordsCommand(ctx *zero.Ctx, arg string) error {
+	p, ok := periodArg(ctx, arg, "week")
+	if !ok {
+		return nil
+	}
+	groupID := ctx.Event.GroupID
+	v, err := cache.get(cacheKey(groupID, "words", p.Name), func() (interface{}, error) {
+		return topWords(groupID, 0, p.Start(time.Now()), wordsLimit)
+	})
+	if err != nil {
+		return err
+	}
+	words := v.([]wordCount)
+	if len(words) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(p.Label+"还没有什么热词")))
+		return nil
+	}
+	title := p.Label + "热词"
+	labels := make([]string, len(words))
+	values := make([]int, len(words))
+	for i, w := range words {
+		labels[i], values[i] = w.Word, w.Count
+	}
+	sendChart(ctx, func() (image.Image, error) { return drawBarChart(title, labels, values) }, wordsText(title, words))
+	return nil
+}
+
+type meStats struct {
+	Summary userSummary
+	Heatmap heatmap
+	Words   []wordCount
+}
+
+func meCommand(ctx *zero.Ctx) error {
+	groupID, qq := ctx.Event.GroupID, ctx.Event.UserID
+	v, err := cache.get(cacheKey(groupID, "me", qq), func() (interface{}, error) {
+		now := time.Now()
+		var s meStats
+		var err error
+		if s.Summary, err = summarizeUser(groupID, qq, now); err != nil {
+			return nil, err
+		}
+		since := periods["month"].Start(now)
+		if s.Heatmap, err = hourHeatmap(groupID, qq, since); err != nil {
+			return nil, err
+		}
+		s.Words, err = topWords(groupID, qq, since, 5)
+		return s, err
+	})
+	if err != nil {
+		return err
+	}
+	s := v.(meStats)
+	name := ctx.CardOrNickName(qq)
+	if name == "" {
+		name = fmt.Sprint(qq)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s 的发言：今天 %d 条，近 7 天 %d 条，近 30 天 %d 条，一共 %d 条",
+		name, s.Summary.Today, s.Summary.Week, s.Summary.Month, s.Summary.Total)
+	if s.Summary.Rank > 0 {
+		fmt.Fprintf(&sb, "\n近 30 天排第 %d", s.Summary.Rank)
+	}
+	if weekday, hour, count := s.Heatmap.busiest(); count > 0 {
+		fmt.Fprintf(&sb, "\n最常在周%s %d 点说话", weekdayNames[weekday], hour)
+	}
+	if len(s.Words) > 0 {
+		sb.WriteString("\n" + wordsText("常说", s.Words))
+	}
+	text := sb.String()
+	img, err := drawHeatmap(name+" 近 30 天各时段发言", s.Heatmap)
+	var seg message.MessageSegment
+	if err == nil {
+		seg, err = render.EncodePNG(img)
+	}
+	if err != nil || s.Summary.Month == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(text)))
+		return nil
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(text+"\n"), seg))
+	return nil
+}
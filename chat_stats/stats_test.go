@@ -0,0 +1,102 @@
+package chatstats
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/doylecnn/qqbot/segment"
+	testdb "github.com/doylecnn/qqbot/test_db"
+)
+
+func useTestDB(t *testing.T) {
+	db = testdb.New(t)
+	t.Cleanup(func() { db = nil })
+}
+
+func insert(t *testing.T, groupID, qq int64, msg string, at time.Time) {
+	t.Helper()
+	db.MustExec(`INSERT INTO group_messages(msg_id, group_id, group_number, qq_number, message, time) VALUES (0, 0, ?, ?, ?, ?)`, groupID, qq, msg, at.Unix())
+}
+
+func TestQueries(t *testing.T) {
+	useTestDB(t)
+	segOnce.Do(func() {
+		seg = segment.New([]string{"天气", "不错", "下雨"})
+	})
+	now := time.Now()
+	// 2021-03-03 是周三
+	wed := time.Date(2021, 3, 3, 21, 30, 0, 0, time.Local)
+	insert(t, 1, 100, "天气不错", now)
+	insert(t, 1, 100, "天气不错[CQ:face,id=1]", now)
+	insert(t, 1, 200, "要下雨了，天气", now)
+	insert(t, 1, 300, "很久以前", now.AddDate(0, 0, -40))
+	insert(t, 2, 100, "别的群", now)
+	insert(t, 3, 100, "周三晚上", wed)
+	insert(t, 3, 200, "周三晚上", wed.Add(10*time.Minute))
+
+	talkers, err := topTalkers(1, now.AddDate(0, 0, -7), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []talker{{100, 2}, {200, 1}}; !reflect.DeepEqual(talkers, want) {
+		t.Errorf("topTalkers = %v, want %v", talkers, want)
+	}
+
+	h, err := hourHeatmap(3, 0, wed.AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if weekday, hour, count := h.busiest(); weekday != 3 || hour != 21 || count != 2 {
+		t.Errorf("busiest = 周%d %d 点 %d 条", weekday, hour, count)
+	}
+	if h, _ = hourHeatmap(3, 200, wed.AddDate(0, 0, -1)); h.hours()[21] != 1 {
+		t.Errorf("user heatmap = %v", h.hours())
+	}
+
+	words, err := topWords(1, 0, now.AddDate(0, 0, -7), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []wordCount{{"天气", 3}, {"不错", 2}}; !reflect.DeepEqual(words, want) {
+		t.Errorf("topWords = %v, want %v", words, want)
+	}
+
+	s, err := summarizeUser(1, 200, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Today != 1 || s.Month != 1 || s.Total != 1 || s.Rank != 2 {
+		t.Errorf("summarizeUser = %+v", s)
+	}
+	if s, _ = summarizeUser(1, 300, now); s.Month != 0 || s.Total != 1 || s.Rank != 0 {
+		t.Errorf("summarizeUser(300) = %+v", s)
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := newCache(time.Hour)
+	calls := 0
+	compute := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+	for i := 0; i < 3; i++ {
+		if v, _ := c.get("a", compute); v != 1 {
+			t.Errorf("get(a) = %v", v)
+		}
+	}
+	if _, err := c.get("b", func() (interface{}, error) { return nil, errors.New("失败") }); err == nil {
+		t.Error("error not returned")
+	}
+	if v, _ := c.get("b", compute); v != 2 {
+		t.Errorf("failed result should not be cached, got %v", v)
+	}
+
+	c.ttl = 0
+	c.get("c", compute)
+	if v, _ := c.get("c", compute); v != 4 {
+		t.Errorf("expired entry reused, got %v", v)
+	}
+}
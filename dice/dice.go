@@ -0,0 +1,105 @@
+package dice
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+
+	mylog "github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// Plugin 骰子
+type Plugin struct{}
+
+func (Plugin) Name() string { return "dice" }
+
+func (Plugin) Description() string { return "掷骰子：/roll、2d6、摸噗噗" }
+
+func (Plugin) Init(config *toml.Tree, db *sqlx.DB) error { return nil }
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "摸噗噗", Usage: "摸pupu", Description: "和噗噗各掷一把骰子，比大小看能不能得手，动作可以换成贴打撞抱舔亲扑揍扇踢推", Examples: []string{"摸噗噗", "揍pupu"}, GroupOnly: true},
+		{Name: "roll", Usage: "/roll", Description: "掷一个六面骰", GroupOnly: true},
+		{Name: "NdM", Usage: "NdM", Description: "掷 N 个 M 面骰，N 最大 9，M 最大 100", Examples: []string{"2d6", "1d100"}, GroupOnly: true},
+	}
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnRegex(`^([摸贴打撞抱舔亲扑揍扇踢推])(pupu|噗噗)$`, zero.OnlyGroup).Handle(func(ctx *zero.Ctx) {
+		if v, ok := ctx.State["regex_matched"]; ok {
+			a := v.([]string)
+			var dongzuo string = a[1]
+			var chenghu string = a[2]
+			var d11 int = int(rand.Int31n(10)) + 1
+			var d12 int = int(rand.Int31n(100)) + 1
+			if d12 < 6 {
+				d12 = 6
+			}
+			var s1 = roll(d11, d12)
+			reply_msg := fmt.Sprintf("你 roll 了一次 [%dd%d] = %d\n", d11, d12, s1)
+			var d21 int = int(rand.Int31n(10)) + 1
+			var d22 int = int(rand.Int31n(100)) + 1
+			if d22 < 6 {
+				d12 = 6
+			}
+			var s2 = roll(d21, d22)
+			reply_msg += fmt.Sprintf("%s roll 了一次 [%dd%d] = %d\n", chenghu, d21, d22, s2)
+			if s1 < s2 {
+				reply_msg += fmt.Sprintf("你的袭击被%s躲过了", chenghu)
+			} else if s1 == s2 {
+				reply_msg += fmt.Sprintf("你的企图被%s发现了，但为时已晚，%s还是被你%s到了", chenghu, chenghu, dongzuo)
+			} else {
+				reply_msg += fmt.Sprintf("你成功的%s到了%s", dongzuo, chenghu)
+			}
+			ctx.SendGroupMessage(ctx.Event.GroupID, message.ReplyWithMessage(ctx.Event.MessageID, message.Text(reply_msg)))
+		}
+	})
+
+	engine.OnCommand("roll", zero.OnlyGroup).Handle(func(ctx *zero.Ctx) {
+		s := roll(1, 6)
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("[1d6] = %d", s))))
+		ctx.Block()
+	})
+
+	engine.OnRegex(`^(\d)[dD](100|\d{1,2})$`).Handle(func(ctx *zero.Ctx) {
+		if v, ok := ctx.State["regex_matched"]; ok {
+			a := v.([]string)
+			var d1 int = 1
+			var d2 int = 6
+			if td1, err := strconv.ParseInt(a[1], 10, 32); err == nil {
+				d1 = int(td1)
+			} else if err != nil {
+				mylog.Log.Warn(err)
+				return
+			} else if d1 < 1 {
+				return
+			}
+			if td2, err := strconv.ParseInt(a[2], 10, 32); err == nil {
+				d2 = int(td2)
+			} else if err != nil {
+				mylog.Log.Warn(err)
+				return
+			} else if d2 < 6 {
+				return
+			}
+			s := roll(d1, d2)
+			ctx.SendGroupMessage(ctx.Event.GroupID, message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("[%dd%d] = %d", d1, d2, s))))
+			ctx.Block()
+		}
+	})
+}
+
+func (Plugin) Shutdown() {}
+
+func roll(d1, d2 int) (s int32) {
+	for i := 0; i < d1; i++ {
+		s += rand.Int31n(int32(d2)) + 1
+	}
+	return
+}
@@ -0,0 +1,286 @@
+// Package fakeonebot 本地的假 OneBot v11 正向 WebSocket 服务端，用于测试：
+// bot 连上来之后可以注入群聊和私聊消息，再检查 bot 调用了哪些 API
+package fakeonebot
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RomiChan/websocket"
+	"github.com/tidwall/gjson"
+)
+
+// Call bot 调用的一次 API
+type Call struct {
+	Action string
+	Params gjson.Result
+}
+
+// GroupID 群消息的群号，私聊为 0
+func (c Call) GroupID() int64 {
+	return c.Params.Get("group_id").Int()
+}
+
+// UserID 私聊消息的 QQ 号
+func (c Call) UserID() int64 {
+	return c.Params.Get("user_id").Int()
+}
+
+// Segments 发送的消息里某种类型的消息段，比如 text、image
+func (c Call) Segments(segmentType string) []gjson.Result {
+	var result []gjson.Result
+	for _, seg := range c.Params.Get("message").Array() {
+		if seg.Get("type").String() == segmentType {
+			result = append(result, seg)
+		}
+	}
+	return result
+}
+
+// Text 发送的消息里所有文字拼起来
+func (c Call) Text() string {
+	msg := c.Params.Get("message")
+	if msg.Type == gjson.String {
+		return msg.String()
+	}
+	var sb strings.Builder
+	for _, seg := range c.Segments("text") {
+		sb.WriteString(seg.Get("data.text").String())
+	}
+	return sb.String()
+}
+
+// IsSend 是不是发消息的 API
+func (c Call) IsSend() bool {
+	switch c.Action {
+	case "send_msg", "send_group_msg", "send_private_msg":
+		return true
+	}
+	return false
+}
+
+// Message 要注入的消息，GroupID 为 0 表示私聊
+type Message struct {
+	GroupID  int64
+	UserID   int64
+	Text     string
+	Nickname string
+	Card     string
+	// Role 群里的身份：owner、admin 或者 member，不填就是 member；私聊时不用
+	Role string
+}
+
+// Responder 按参数生成 API 返回的 data
+type Responder func(params gjson.Result) interface{}
+
+type Server struct {
+	SelfID int64
+	// URL bot 连接用的地址
+	URL string
+
+	srv        *httptest.Server
+	calls      chan Call
+	responders map[string]Responder
+	conn       *websocket.Conn
+	connected  chan struct{}
+	messageID  int64
+	writeMux   sync.Mutex
+	mux        sync.Mutex
+}
+
+// NewServer 启动服务端，bot 用 driver.NewWebSocketClient(s.URL, "") 连接
+func NewServer(selfID int64) *Server {
+	s := &Server{
+		SelfID:     selfID,
+		calls:      make(chan Call, 256),
+		responders: make(map[string]Responder),
+		connected:  make(chan struct{}),
+	}
+	s.Handle("get_login_info", func(gjson.Result) interface{} {
+		return map[string]interface{}{"user_id": selfID, "nickname": "bot"}
+	})
+	send := func(gjson.Result) interface{} {
+		return map[string]interface{}{"message_id": atomic.AddInt64(&s.messageID, 1)}
+	}
+	s.Handle("send_msg", send)
+	s.Handle("send_group_msg", send)
+	s.Handle("send_private_msg", send)
+	s.Handle("get_group_member_info", func(params gjson.Result) interface{} {
+		return map[string]interface{}{"user_id": params.Get("user_id").Int(), "card": "", "nickname": "user" + params.Get("user_id").String(), "role": "member"}
+	})
+	s.Handle("get_stranger_info", func(params gjson.Result) interface{} {
+		return map[string]interface{}{"user_id": params.Get("user_id").Int(), "nickname": "user" + params.Get("user_id").String()}
+	})
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = "ws" + strings.TrimPrefix(s.srv.URL, "http") + "/"
+	return s
+}
+
+// Handle 设置某个 API 的返回，没有设置的 API 返回空的 data
+func (s *Server) Handle(action string, responder Responder) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.responders[action] = responder
+}
+
+func (s *Server) Close() {
+	s.mux.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.mux.Unlock()
+	s.srv.Close()
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	s.mux.Lock()
+	s.conn = conn
+	s.mux.Unlock()
+	for {
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		req := gjson.ParseBytes(payload)
+		call := Call{Action: req.Get("action").String(), Params: req.Get("params")}
+		s.mux.Lock()
+		responder := s.responders[call.Action]
+		s.mux.Unlock()
+		var data interface{}
+		if responder != nil {
+			data = responder(call.Params)
+		}
+		s.write(map[string]interface{}{"status": "ok", "retcode": 0, "data": data, "echo": req.Get("echo").Uint()})
+		if call.Action == "get_login_info" {
+			// bot 拿到自己的 QQ 号之后才算连上
+			select {
+			case <-s.connected:
+			default:
+				close(s.connected)
+			}
+			continue
+		}
+		select {
+		case s.calls <- call:
+		default:
+			// 测试没在看的调用太多了，丢掉最早的一条
+			<-s.calls
+			s.calls <- call
+		}
+	}
+}
+
+func (s *Server) write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mux.Lock()
+	conn := s.conn
+	s.mux.Unlock()
+	if conn == nil {
+		return errors.New("bot 还没有连上")
+	}
+	s.writeMux.Lock()
+	defer s.writeMux.Unlock()
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// WaitConnected 等 bot 连上
+func (s *Server) WaitConnected(timeout time.Duration) error {
+	select {
+	case <-s.connected:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("bot 没有连上")
+	}
+}
+
+// Send 注入一条消息，返回消息 ID
+func (s *Server) Send(m Message) (int64, error) {
+	id := atomic.AddInt64(&s.messageID, 1)
+	if m.Nickname == "" {
+		m.Nickname = "user" + strconv.FormatInt(m.UserID, 10)
+	}
+	sender := map[string]interface{}{
+		"user_id":  m.UserID,
+		"nickname": m.Nickname,
+		"card":     m.Card,
+	}
+	event := map[string]interface{}{
+		"time":        time.Now().Unix(),
+		"self_id":     s.SelfID,
+		"post_type":   "message",
+		"sub_type":    "normal",
+		"message_id":  id,
+		"user_id":     m.UserID,
+		"message":     m.Text,
+		"raw_message": m.Text,
+		"font":        0,
+		"sender":      sender,
+	}
+	if m.GroupID != 0 {
+		event["message_type"] = "group"
+		event["group_id"] = m.GroupID
+		if m.Role == "" {
+			m.Role = "member"
+		}
+		sender["role"] = m.Role
+	} else {
+		// 私聊的发送者没有群身份，不带 role
+		event["message_type"] = "private"
+		event["sub_type"] = "friend"
+	}
+	return id, s.write(event)
+}
+
+// GroupMessage 注入一条普通群员发的群消息
+func (s *Server) GroupMessage(groupID, userID int64, text string) (int64, error) {
+	return s.Send(Message{GroupID: groupID, UserID: userID, Text: text})
+}
+
+// PrivateMessage 注入一条私聊消息
+func (s *Server) PrivateMessage(userID int64, text string) (int64, error) {
+	return s.Send(Message{UserID: userID, Text: text})
+}
+
+// Wait 等下一个满足 match 的 API 调用，不满足的调用直接跳过
+func (s *Server) Wait(timeout time.Duration, match func(Call) bool) (Call, bool) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case call := <-s.calls:
+			if match == nil || match(call) {
+				return call, true
+			}
+		case <-deadline:
+			return Call{}, false
+		}
+	}
+}
+
+// WaitGroupReply 等 bot 往群里发的下一条消息
+func (s *Server) WaitGroupReply(groupID int64, timeout time.Duration) (Call, bool) {
+	return s.Wait(timeout, func(c Call) bool {
+		return c.IsSend() && c.GroupID() == groupID
+	})
+}
+
+// WaitPrivateReply 等 bot 私聊发给某人的下一条消息
+func (s *Server) WaitPrivateReply(userID int64, timeout time.Duration) (Call, bool) {
+	return s.Wait(timeout, func(c Call) bool {
+		return c.IsSend() && c.GroupID() == 0 && c.UserID() == userID
+	})
+}
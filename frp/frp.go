@@ -0,0 +1,73 @@
+package frp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// Plugin frp
+type Plugin struct{}
+
+func (Plugin) Name() string { return "frp" }
+
+func (Plugin) Description() string { return "超级用户远程启停 frp：/frp start、/frp stop" }
+
+func (Plugin) Init(config *toml.Tree, db *sqlx.DB) error { return nil }
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "frp start", Usage: "/frp start", Description: "启动 frp 客户端", Permission: plugin.SuperUser},
+		{Name: "frp stop", Usage: "/frp stop", Description: "停止 frp 客户端", Permission: plugin.SuperUser},
+	}
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnCommand("frp start", zero.SuperUserPermission).Handle(func(ctx *zero.Ctx) {
+		if _, err := os.Stat("c:\\frp\\frpc.exe"); err != nil && os.IsNotExist(err) {
+			source, err := os.Open("c:\\frp\\frpc.bak")
+			if err != nil {
+				logrus.Println(err)
+				ctx.Send(message.Text(fmt.Sprintf("error:%s", err)))
+			}
+			defer source.Close()
+
+			destination, err := os.Create("c:\\frp\\frpc.exe")
+			if err != nil {
+				logrus.Println(err)
+				ctx.Send(message.Text(fmt.Sprintf("error:%s", err)))
+			}
+			defer destination.Close()
+			_, err = io.Copy(destination, source)
+			if err != nil {
+				logrus.Println(err)
+				ctx.Send(message.Text(fmt.Sprintf("error:%s", err)))
+			}
+		}
+		err := exec.Command("c:\\frp\\frpc.exe", "-c", "c:\\frp\\frpc.ini").Start()
+		if err != nil {
+			ctx.Send(message.Text(fmt.Sprintf("error:%s", err)))
+		} else {
+			ctx.Send(message.Text("success"))
+		}
+	})
+
+	engine.OnCommand("frp stop", zero.SuperUserPermission).Handle(func(ctx *zero.Ctx) {
+		err := exec.Command("pskill", "frpc").Start()
+		if err != nil {
+			ctx.Send(message.Text(fmt.Sprintf("error:%s", err)))
+		} else {
+			ctx.Send(message.Text("success"))
+		}
+	})
+}
+
+func (Plugin) Shutdown() {}
@@ -0,0 +1,199 @@
+// 并发测试，用 go test -race 跑
+
+package gamesession
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+)
+
+// recordGame 记下收到的每条消息，检查顺序和结束之后还有没有消息进来
+type recordGame struct {
+	t *testing.T
+	// seen 每个人最后一条消息的序号，只在事件循环里读写
+	seen    map[int64]int
+	count   int
+	stopped bool
+}
+
+func newRecordGame(t *testing.T) *recordGame {
+	return &recordGame{t: t, seen: make(map[int64]int)}
+}
+
+func (g *recordGame) Start(ctx *zero.Ctx, s *Session) {}
+
+func (g *recordGame) Input(ctx *zero.Ctx, s *Session) bool {
+	if g.stopped {
+		g.t.Error("Input() after Stop()")
+	}
+	seq := ctx.State["seq"].(int)
+	if last, exists := g.seen[ctx.Event.UserID]; exists && seq <= last {
+		g.t.Errorf("user %d: message %d after %d", ctx.Event.UserID, seq, last)
+	}
+	g.seen[ctx.Event.UserID] = seq
+	g.count++
+	return true
+}
+
+func (g *recordGame) Timeout(ctx *zero.Ctx, s *Session) bool {
+	return true
+}
+
+func (g *recordGame) Stop(ctx *zero.Ctx, s *Session) bool {
+	g.stopped = true
+	return true
+}
+
+func (g *recordGame) Persist() ([]byte, error) {
+	return []byte("{}"), nil
+}
+
+func messageCtx(groupID, userID int64, seq int) *zero.Ctx {
+	return &zero.Ctx{Event: &zero.Event{GroupID: groupID, UserID: userID}, State: zero.State{"seq": seq}}
+}
+
+func TestRouteOrder(t *testing.T) {
+	const users, messages = 20, 50
+	r := NewRegistry()
+	game := newRecordGame(t)
+	s, err := r.Start(groupCtx(1), "record", game, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for u := 1; u <= users; u++ {
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+			for i := 0; i < messages; i++ {
+				if !r.Route(messageCtx(1, userID, i)) {
+					t.Errorf("user %d: message %d dropped", userID, i)
+				}
+			}
+		}(int64(u))
+	}
+	wg.Wait()
+	s.View(func() {
+		if game.count != users*messages {
+			t.Errorf("count = %d, want %d", game.count, users*messages)
+		}
+	})
+}
+
+func TestConcurrentStopStart(t *testing.T) {
+	r := NewRegistry()
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for u := 1; u <= 10; u++ {
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				r.Route(messageCtx(1, userID, i))
+				runtime.Gosched()
+			}
+		}(int64(u))
+	}
+	for i := 0; i < 50; i++ {
+		var starters sync.WaitGroup
+		started := make(chan *Session, 3)
+		for j := 0; j < 3; j++ {
+			starters.Add(1)
+			go func() {
+				defer starters.Done()
+				if s, err := r.Start(groupCtx(1), "record", newRecordGame(t), 0); err == nil {
+					started <- s
+				} else if !errors.Is(err, ErrBusy) {
+					t.Errorf("Start() = %v", err)
+				}
+			}()
+		}
+		starters.Wait()
+		close(started)
+		if n := len(started); n != 1 {
+			t.Fatalf("%d sessions started at once", n)
+		}
+		// 两个人同时 stop，只有一个算数
+		results := make(chan bool, 2)
+		for j := 0; j < 2; j++ {
+			go func() {
+				_, ok := r.Stop(groupCtx(1))
+				results <- ok
+			}()
+		}
+		if a, b := <-results, <-results; a == b {
+			t.Fatalf("Stop() results = %v, %v", a, b)
+		}
+		if s := <-started; !s.Ended() {
+			t.Fatal("session not ended after Stop()")
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestConcurrentShutdown(t *testing.T) {
+	useTestDB(t)
+	r := NewRegistry()
+	for g := int64(1); g <= 5; g++ {
+		if _, err := r.Start(groupCtx(g), "record", newRecordGame(t), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for g := int64(1); g <= 5; g++ {
+		wg.Add(1)
+		go func(groupID int64) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				r.Route(messageCtx(groupID, 10000, i))
+			}
+		}(g)
+	}
+	var notices map[int64]string
+	var shutdowns sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		shutdowns.Add(1)
+		go func() {
+			defer shutdowns.Done()
+			if n := r.Shutdown(); n != nil {
+				notices = n
+			}
+		}()
+	}
+	shutdowns.Wait()
+	if len(notices) != 5 {
+		t.Errorf("notices = %v", notices)
+	}
+	// 保存之后的消息不再交给游戏
+	for g := int64(1); g <= 5; g++ {
+		if r.Route(messageCtx(g, 10000, 1<<30)) {
+			t.Errorf("group %d: message routed after Shutdown()", g)
+		}
+	}
+	if _, err := r.Start(groupCtx(6), "record", newRecordGame(t), 0); !errors.Is(err, ErrClosing) {
+		t.Errorf("Start() after Shutdown() = %v, want ErrClosing", err)
+	}
+	close(stop)
+	wg.Wait()
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM game_sessions`); err != nil || count != 5 {
+		t.Errorf("game_sessions rows = %d, %v", count, err)
+	}
+}
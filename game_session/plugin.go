@@ -0,0 +1,38 @@
+package gamesession
+
+import (
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	zero "github.com/wdvxdr1123/ZeroBot"
+)
+
+// Plugin 把聊天里的中文消息转给正在进行的游戏，要注册在各个游戏之后
+type Plugin struct{}
+
+func (Plugin) Name() string { return "games" }
+
+func (Plugin) Description() string { return "游戏公共指令：/scores、/restart" }
+
+func (Plugin) Init(config *toml.Tree, db *sqlx.DB) error {
+	Init(db)
+	return nil
+}
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "scores", Usage: "/scores [游戏名]", Description: "本群的游戏总分排行", Examples: []string{"/scores", "/scores 成语接龙"}},
+		{Name: "restart", Usage: "/restart", Description: "准备重启 bot：保存正在进行的游戏，不再开新游戏，重启后可以接着玩", Permission: plugin.SuperUser},
+	}
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnCommand("scores").Handle(ScoresCommand)
+	engine.OnCommand("restart", zero.SuperUserPermission).Handle(Restart)
+	engine.OnRegex(`^\p{Han}+$`).Handle(Sessions.Handle)
+}
+
+// Shutdown 保存还没结束的游戏，下次启动时恢复
+func (Plugin) Shutdown() {
+	Sessions.Shutdown()
+}
@@ -0,0 +1,583 @@
+package gamesession
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/doylecnn/qqbot/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+var (
+	// ErrBusy 同一个聊天里已经有游戏在进行，一个群同时只能玩一种游戏
+	ErrBusy = errors.New("已经有游戏在进行了")
+	// ErrClosing 准备重启，不再开新游戏
+	ErrClosing = errors.New("在准备重启啦，请稍后再开")
+)
+
+// Game 一种小游戏，所有方法都在 Session 的事件循环里依次调用，不需要自己加锁
+type Game interface {
+	// Start 游戏开始，一般用来出第一题
+	Start(ctx *zero.Ctx, s *Session)
+	// Input 处理一条消息，返回 true 表示这条消息属于游戏，不再交给后面的处理器
+	Input(ctx *zero.Ctx, s *Session) bool
+	// Timeout 超时没人操作，返回 true 表示继续并重新计时，false 结束游戏
+	Timeout(ctx *zero.Ctx, s *Session) bool
+}
+
+// Stopper 有人要求结束游戏时调用，返回 false 表示不让结束（比如没有权限）
+type Stopper interface {
+	Stop(ctx *zero.Ctx, s *Session) bool
+}
+
+// Persister 重启前保存游戏状态，启动后用 RegisterGame 注册的函数恢复
+type Persister interface {
+	Persist() ([]byte, error)
+}
+
+// Score 一个人的得分
+type Score struct {
+	UserID int64  `db:"qq_number"`
+	Name   string `db:"name"`
+	Points int    `db:"points"`
+}
+
+type Session struct {
+	Key int64
+	// Name 游戏名，也用于保存成绩和恢复游戏
+	Name string
+	Game Game
+
+	scores  map[int64]*Score
+	timeout time.Duration
+	// moves 每次重新计时加一，用来判断计时器是不是过期了
+	moves    int
+	ended    atomic.Bool
+	ctx      *zero.Ctx
+	registry *Registry
+	// events 事件队列，由 run 按顺序逐个处理，游戏状态只在 run 里读写
+	events chan func()
+	// done run 退出时关闭，之后的事件都不再处理
+	done chan struct{}
+}
+
+// queueSize 事件队列的缓冲，满了之后发送方按先来后到排队等着，不会丢消息
+const queueSize = 16
+
+func newSession(r *Registry, key int64, name string, game Game, timeout time.Duration, ctx *zero.Ctx) *Session {
+	s := &Session{
+		Key:      key,
+		Name:     name,
+		Game:     game,
+		scores:   make(map[int64]*Score),
+		timeout:  timeout,
+		ctx:      ctx,
+		registry: r,
+		events:   make(chan func(), queueSize),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// run 事件循环，游戏结束后退出
+func (s *Session) run() {
+	defer close(s.done)
+	for f := range s.events {
+		s.dispatch(f)
+		if s.ended.Load() {
+			return
+		}
+	}
+}
+
+// dispatch 执行一个事件，游戏代码 panic 时结束这一局，不影响其他聊天
+func (s *Session) dispatch(f func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event": "Game Session Panic",
+				"err":   err,
+				"Game":  s.Name,
+				"Key":   s.Key,
+			}).Warningln("游戏出错，结束这一局")
+			s.End()
+		}
+	}()
+	f()
+}
+
+// enqueue 把 f 放进事件队列，返回 f 执行完时关闭的 channel。事件循环已经退出时返回 nil
+func (s *Session) enqueue(f func()) chan struct{} {
+	finished := make(chan struct{})
+	select {
+	case s.events <- func() {
+		defer close(finished)
+		f()
+	}:
+		return finished
+	case <-s.done:
+		return nil
+	}
+}
+
+// wait 等 enqueue 放进去的事件执行完，游戏先结束了、事件没有执行时返回 false
+func (s *Session) wait(finished chan struct{}) bool {
+	if finished == nil {
+		return false
+	}
+	select {
+	case <-finished:
+		return true
+	case <-s.done:
+		// 结束游戏的那个事件自己也算执行完了
+		select {
+		case <-finished:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// call 在事件循环里执行 f 并等它执行完。不能在游戏的钩子里调用，否则会等自己
+func (s *Session) call(f func()) bool {
+	return s.wait(s.enqueue(f))
+}
+
+// Registry 每个聊天同时只能有一局游戏
+type Registry struct {
+	sessions map[int64]*Session
+	closing  bool
+	mux      sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{sessions: make(map[int64]*Session)}
+}
+
+// Sessions 所有游戏共用，这样一个群同时只会有一种游戏在进行
+var Sessions = NewRegistry()
+
+var db *sqlx.DB
+
+var restorers = make(map[string]func(data []byte) (Game, error))
+
+// RegisterGame 注册游戏的恢复函数，在 init 里调用
+func RegisterGame(name string, restore func(data []byte) (Game, error)) {
+	restorers[name] = restore
+}
+
+// Init 设置数据库连接并恢复重启前保存的游戏
+func Init(database *sqlx.DB) {
+	db = database
+	Sessions.restore()
+}
+
+// Key 群聊用群号，私聊用 QQ 号的相反数，避免和群号撞上
+func Key(ctx *zero.Ctx) int64 {
+	if ctx.Event.GroupID == 0 {
+		return -ctx.Event.UserID
+	}
+	return ctx.Event.GroupID
+}
+
+// Start 开一局游戏，timeout 为 0 表示不计时。已经有游戏时返回那一局和 ErrBusy
+func (r *Registry) Start(ctx *zero.Ctx, name string, game Game, timeout time.Duration) (*Session, error) {
+	key := Key(ctx)
+	r.mux.Lock()
+	if r.closing {
+		r.mux.Unlock()
+		return nil, ErrClosing
+	}
+	if s, exists := r.sessions[key]; exists {
+		r.mux.Unlock()
+		return s, fmt.Errorf("%w：正在玩%s", ErrBusy, s.Name)
+	}
+	s := newSession(r, key, name, game, timeout, ctx)
+	// Start 要先于别人发来的消息进队列，所以在放进 sessions 之前入队
+	started := s.enqueue(func() {
+		game.Start(ctx, s)
+		if !s.ended.Load() {
+			s.resetTimer()
+		}
+	})
+	r.sessions[key] = s
+	r.mux.Unlock()
+	s.wait(started)
+	return s, nil
+}
+
+func (r *Registry) Get(ctx *zero.Ctx) (*Session, bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	s, exists := r.sessions[Key(ctx)]
+	return s, exists
+}
+
+// Stop 结束当前聊天的游戏，返回那一局和是否真的结束了
+func (r *Registry) Stop(ctx *zero.Ctx) (*Session, bool) {
+	s, exists := r.Get(ctx)
+	if !exists {
+		return nil, false
+	}
+	stopped := false
+	s.call(func() {
+		if stopper, ok := s.Game.(Stopper); ok && !stopper.Stop(ctx, s) {
+			return
+		}
+		// Stop 里可能已经结束了，比如顺便记了成绩
+		s.End()
+		stopped = true
+	})
+	return s, stopped
+}
+
+// Route 把消息交给当前聊天正在进行的游戏，返回 true 表示消息被游戏用掉了
+func (r *Registry) Route(ctx *zero.Ctx) bool {
+	s, exists := r.Get(ctx)
+	if !exists {
+		return false
+	}
+	consumed := false
+	s.call(func() {
+		// 恢复的游戏没有 ctx，超时提醒用最近一条消息的
+		s.ctx = ctx
+		if !s.Game.Input(ctx, s) {
+			return
+		}
+		consumed = true
+		if !s.ended.Load() {
+			s.resetTimer()
+		}
+	})
+	return consumed
+}
+
+// Handle 注册成消息处理器，只有在游戏进行中并且消息属于游戏时才拦下消息
+func (r *Registry) Handle(ctx *zero.Ctx) {
+	if r.Route(ctx) {
+		ctx.Block()
+	}
+}
+
+// Shutdown 不再开新游戏，能保存的游戏保存起来，返回要通知的聊天和内容
+func (r *Registry) Shutdown() map[int64]string {
+	r.mux.Lock()
+	if r.closing {
+		r.mux.Unlock()
+		return nil
+	}
+	r.closing = true
+	sessions := make([]*Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		sessions = append(sessions, s)
+	}
+	r.mux.Unlock()
+	notices := make(map[int64]string, len(sessions))
+	for _, s := range sessions {
+		text := "准备重启啦"
+		saved := s.call(func() {
+			if s.persist() {
+				// 已经保存了，重启前的消息就不再处理，免得和保存的状态对不上
+				s.moves++
+				s.ended.Store(true)
+				text += fmt.Sprintf("，%s重启后可以接着玩", s.Name)
+			}
+		})
+		if saved {
+			notices[s.Key] = text
+		}
+	}
+	return notices
+}
+
+// Restart 重启前调用，见 Registry.Shutdown
+func Restart(ctx *zero.Ctx) {
+	for key, text := range Sessions.Shutdown() {
+		if key > 0 {
+			ctx.SendGroupMessage(key, message.Text(text))
+		} else {
+			ctx.SendPrivateMessage(-key, message.Text(text))
+		}
+	}
+}
+
+// persist 在事件循环里调用
+func (s *Session) persist() bool {
+	persister, ok := s.Game.(Persister)
+	if !ok || db == nil || s.ended.Load() {
+		return false
+	}
+	data, err := persister.Persist()
+	if err == nil {
+		var scores []byte
+		if scores, err = json.Marshal(s.Scores()); err == nil {
+			_, err = db.Exec(`INSERT OR REPLACE INTO game_sessions(chat_key, game, data, scores, timeout, time) VALUES (?, ?, ?, ?, ?, ?)`, s.Key, s.Name, string(data), string(scores), int64(s.timeout), time.Now().Unix())
+		}
+	}
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Game Session Persist",
+			"err":   err,
+			"Game":  s.Name,
+			"Key":   s.Key,
+		}).Warningln("保存游戏失败")
+		return false
+	}
+	return true
+}
+
+func (r *Registry) restore() {
+	if db == nil {
+		return
+	}
+	rows := []struct {
+		Key     int64         `db:"chat_key"`
+		Game    string        `db:"game"`
+		Data    string        `db:"data"`
+		Scores  string        `db:"scores"`
+		Timeout time.Duration `db:"timeout"`
+	}{}
+	if err := db.Select(&rows, `SELECT chat_key, game, data, scores, timeout FROM game_sessions`); err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Game Session Restore",
+			"call":  "Select",
+			"err":   err,
+		}).Warningln("读取保存的游戏失败")
+		return
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, row := range rows {
+		restore, exists := restorers[row.Game]
+		if !exists {
+			continue
+		}
+		game, err := restore([]byte(row.Data))
+		if err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event": "Game Session Restore",
+				"err":   err,
+				"Game":  row.Game,
+				"Key":   row.Key,
+			}).Warningln("恢复游戏失败")
+			continue
+		}
+		s := newSession(r, row.Key, row.Game, game, row.Timeout, nil)
+		var scores []Score
+		if err := json.Unmarshal([]byte(row.Scores), &scores); err == nil {
+			for i := range scores {
+				s.scores[scores[i].UserID] = &scores[i]
+			}
+		}
+		// 恢复之后没人接着玩也要按时结束
+		s.enqueue(s.resetTimer)
+		r.sessions[row.Key] = s
+	}
+	if _, err := db.Exec(`DELETE FROM game_sessions`); err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Game Session Restore",
+			"call":  "Exec",
+			"err":   err,
+		}).Warningln("清理保存的游戏失败")
+	}
+	log.Log.WithFields(logrus.Fields{
+		"event": "Game Session Restore",
+		"Count": len(r.sessions),
+	}).Infoln("恢复游戏")
+}
+
+// End 结束游戏并保存成绩，只能在事件循环里调用，比如游戏的钩子和 Do 里。返回 false 表示已经结束了
+func (s *Session) End() bool {
+	if s.ended.Load() {
+		return false
+	}
+	s.ended.Store(true)
+	s.moves++
+	s.saveScores()
+	s.registry.mux.Lock()
+	defer s.registry.mux.Unlock()
+	if current, exists := s.registry.sessions[s.Key]; exists && current == s {
+		delete(s.registry.sessions, s.Key)
+	}
+	return true
+}
+
+func (s *Session) saveScores() {
+	if db == nil || len(s.scores) == 0 {
+		return
+	}
+	now := time.Now().Unix()
+	for _, score := range s.scores {
+		if _, err := db.Exec(`INSERT INTO game_scores(game, group_number, qq_number, name, points, time) VALUES (?, ?, ?, ?, ?, ?)`,
+			s.Name, s.Key, score.UserID, score.Name, score.Points, now); err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event": "Game Session Scores",
+				"call":  "Exec",
+				"err":   err,
+				"Game":  s.Name,
+				"Key":   s.Key,
+			}).Warningln("保存成绩失败")
+			return
+		}
+	}
+}
+
+// Do 在事件循环里执行 f 并重新计时，用于游戏自己的指令。游戏已经结束时返回 false
+func (s *Session) Do(f func()) bool {
+	return s.call(func() {
+		f()
+		if !s.ended.Load() {
+			s.resetTimer()
+		}
+	})
+}
+
+// View 在事件循环里读取游戏状态，不重新计时。游戏已经结束时状态不会再变，直接读
+func (s *Session) View(f func()) {
+	if !s.call(f) {
+		f()
+	}
+}
+
+func (s *Session) Ended() bool {
+	return s.ended.Load()
+}
+
+// resetTimer 在事件循环里调用，超时事件也放进队列，和消息按顺序处理
+func (s *Session) resetTimer() {
+	s.moves++
+	if s.timeout <= 0 {
+		return
+	}
+	moves := s.moves
+	time.AfterFunc(s.timeout, func() {
+		s.call(func() {
+			if s.moves != moves {
+				return
+			}
+			ctx := s.timeoutCtx()
+			if ctx == nil {
+				s.End()
+				return
+			}
+			if s.Game.Timeout(ctx, s) && !s.ended.Load() {
+				s.resetTimer()
+			} else {
+				s.End()
+			}
+		})
+	})
+}
+
+// timeoutCtx 超时提醒用的 ctx。恢复的游戏还没人发过消息时没有 ctx，用 bot 的连接按聊天拼一个，bot 没连上时返回 nil
+func (s *Session) timeoutCtx() *zero.Ctx {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	var ctx *zero.Ctx
+	zero.RangeBot(func(id int64, c *zero.Ctx) bool {
+		ctx = c
+		ctx.Event = &zero.Event{PostType: "message", SelfID: id}
+		return false
+	})
+	if ctx == nil {
+		return nil
+	}
+	if s.Key > 0 {
+		ctx.Event.DetailType, ctx.Event.MessageType, ctx.Event.GroupID = "group", "group", s.Key
+	} else {
+		ctx.Event.DetailType, ctx.Event.MessageType, ctx.Event.UserID = "private", "private", -s.Key
+	}
+	return ctx
+}
+
+// AddScore 给玩家加分，name 为空时不修改已记录的名字
+func (s *Session) AddScore(userID int64, name string, points int) {
+	score, exists := s.scores[userID]
+	if !exists {
+		score = &Score{UserID: userID}
+		s.scores[userID] = score
+	}
+	if name != "" {
+		score.Name = name
+	}
+	score.Points += points
+}
+
+// Scores 按得分从高到低排好的成绩
+func (s *Session) Scores() []Score {
+	result := make([]Score, 0, len(s.scores))
+	for _, score := range s.scores {
+		result = append(result, *score)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Points != result[j].Points {
+			return result[i].Points > result[j].Points
+		}
+		return result[i].UserID < result[j].UserID
+	})
+	return result
+}
+
+func formatScores(scores []Score) string {
+	var sb strings.Builder
+	for i, score := range scores {
+		fmt.Fprintf(&sb, "\n%d. %s %d 分", i+1, score.Name, score.Points)
+	}
+	return sb.String()
+}
+
+func (s *Session) Scoreboard() string {
+	scores := s.Scores()
+	if len(scores) == 0 {
+		return "没有人得分"
+	}
+	return "得分：" + formatScores(scores)
+}
+
+// ScoresCommand 本群（私聊就是自己）的游戏总分：/scores [游戏名]
+func ScoresCommand(ctx *zero.Ctx) {
+	if db == nil {
+		return
+	}
+	game := ""
+	if args, ok := ctx.State["args"].(string); ok {
+		game = strings.TrimSpace(args)
+	}
+	query := `SELECT qq_number, MAX(name) AS name, SUM(points) AS points FROM game_scores WHERE group_number=?`
+	params := []interface{}{Key(ctx)}
+	if game != "" {
+		query += ` AND game=?`
+		params = append(params, game)
+	}
+	query += ` GROUP BY qq_number ORDER BY points DESC, qq_number LIMIT 10`
+	scores := []Score{}
+	if err := db.Select(&scores, query, params...); err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Game Session Scores",
+			"call":  "Select",
+			"err":   err,
+		}).Warningln("读取成绩失败")
+		return
+	}
+	if len(scores) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("还没有人得分")))
+		return
+	}
+	title := "游戏总分："
+	if game != "" {
+		title = game + "总分："
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(title+formatScores(scores))))
+}
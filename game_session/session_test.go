@@ -0,0 +1,188 @@
+package gamesession
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	testdb "github.com/doylecnn/qqbot/test_db"
+	zero "github.com/wdvxdr1123/ZeroBot"
+)
+
+type fakeGame struct {
+	started  bool
+	timeouts int
+	// keep 超时几次之后结束
+	keep int
+}
+
+func (g *fakeGame) Start(ctx *zero.Ctx, s *Session) {
+	g.started = true
+}
+
+func (g *fakeGame) Input(ctx *zero.Ctx, s *Session) bool {
+	return true
+}
+
+func (g *fakeGame) Timeout(ctx *zero.Ctx, s *Session) bool {
+	g.timeouts++
+	return g.timeouts < g.keep
+}
+
+func groupCtx(groupID int64) *zero.Ctx {
+	return &zero.Ctx{Event: &zero.Event{GroupID: groupID, UserID: 10000}}
+}
+
+func TestRegistryStartStop(t *testing.T) {
+	r := NewRegistry()
+	ctx := groupCtx(1)
+	game := &fakeGame{}
+	s, err := r.Start(ctx, "fake", game, 0)
+	if err != nil || !game.started {
+		t.Fatalf("Start() = %v, started %v", err, game.started)
+	}
+	if other, err := r.Start(ctx, "fake", &fakeGame{}, 0); !errors.Is(err, ErrBusy) || other != s {
+		t.Errorf("second Start() = %v, want ErrBusy", err)
+	}
+	if _, err := r.Start(groupCtx(2), "fake", &fakeGame{}, 0); err != nil {
+		t.Errorf("Start() in another group = %v", err)
+	}
+	if stopped, ok := r.Stop(ctx); !ok || stopped != s || !s.Ended() {
+		t.Errorf("Stop() = %v, %v", stopped, ok)
+	}
+	if _, ok := r.Stop(ctx); ok {
+		t.Error("Stop() twice should fail")
+	}
+	if _, err := r.Start(ctx, "fake", &fakeGame{}, 0); err != nil {
+		t.Errorf("Start() after Stop() = %v", err)
+	}
+}
+
+func TestPrivateKey(t *testing.T) {
+	if key := Key(&zero.Ctx{Event: &zero.Event{UserID: 12345}}); key != -12345 {
+		t.Errorf("Key() = %d, want -12345", key)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	r := NewRegistry()
+	ctx := groupCtx(1)
+	game := &fakeGame{keep: 2}
+	s, _ := r.Start(ctx, "fake", game, 10*time.Millisecond)
+	select {
+	case <-s.done:
+	case <-time.After(time.Second):
+		t.Fatal("session did not time out")
+	}
+	if game.timeouts != 2 {
+		t.Errorf("timeouts = %d, want 2", game.timeouts)
+	}
+	if _, exists := r.Get(ctx); exists {
+		t.Error("timed out session should be removed")
+	}
+}
+
+func TestScores(t *testing.T) {
+	s := &Session{scores: make(map[int64]*Score)}
+	s.AddScore(1, "甲", 1)
+	s.AddScore(2, "乙", 3)
+	s.AddScore(1, "", 1)
+	scores := s.Scores()
+	if len(scores) != 2 || scores[0].UserID != 2 || scores[1].Points != 2 || scores[1].Name != "甲" {
+		t.Errorf("Scores() = %v", scores)
+	}
+}
+
+type savedGame struct {
+	fakeGame
+	Round int
+}
+
+func (g *savedGame) Persist() ([]byte, error) {
+	return []byte(strconv.Itoa(g.Round)), nil
+}
+
+func registerSavedGame() {
+	RegisterGame("saved", func(data []byte) (Game, error) {
+		round, err := strconv.Atoi(string(data))
+		return &savedGame{Round: round}, err
+	})
+}
+
+// useTestDB 换成内存数据库，测试结束后还原
+func useTestDB(t *testing.T) {
+	db = testdb.New(t)
+	t.Cleanup(func() { db = nil })
+}
+
+func TestPersistRestore(t *testing.T) {
+	useTestDB(t)
+	registerSavedGame()
+	r := NewRegistry()
+	s, _ := r.Start(groupCtx(1), "saved", &savedGame{Round: 3}, 0)
+	s.AddScore(10000, "甲", 2)
+	if !s.persist() {
+		t.Fatal("persist() failed")
+	}
+	if _, err := r.Start(groupCtx(2), "fake", &fakeGame{}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewRegistry()
+	restored.restore()
+	got, exists := restored.sessions[1]
+	if !exists {
+		t.Fatal("session was not restored")
+	}
+	if game, ok := got.Game.(*savedGame); !ok || game.Round != 3 {
+		t.Errorf("restored game = %#v", got.Game)
+	}
+	if scores := got.Scores(); len(scores) != 1 || scores[0].Points != 2 {
+		t.Errorf("restored scores = %v", scores)
+	}
+	if _, exists := restored.sessions[2]; exists {
+		t.Error("game without Persist should not be restored")
+	}
+
+	got.Do(func() { got.End() })
+	var points int
+	if err := db.Get(&points, `SELECT SUM(points) FROM game_scores WHERE game = 'saved' AND group_number = 1`); err != nil || points != 2 {
+		t.Errorf("saved points = %d, %v", points, err)
+	}
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM game_sessions`); err != nil || count != 0 {
+		t.Errorf("game_sessions rows = %d, %v", count, err)
+	}
+}
+
+// TestRestoredTimeout 恢复的游戏按保存的时限计时，没人接着玩也会结束
+func TestRestoredTimeout(t *testing.T) {
+	useTestDB(t)
+	registerSavedGame()
+
+	r := NewRegistry()
+	s, _ := r.Start(groupCtx(1), "saved", &savedGame{Round: 1}, 20*time.Millisecond)
+	if !s.persist() {
+		t.Fatal("persist() failed")
+	}
+	s.Do(func() { s.End() })
+
+	restored := NewRegistry()
+	restored.restore()
+	got, exists := restored.Get(groupCtx(1))
+	if !exists {
+		t.Fatal("session was not restored")
+	}
+	if got.timeout != 20*time.Millisecond {
+		t.Errorf("restored timeout = %v", got.timeout)
+	}
+	select {
+	case <-got.done:
+	case <-time.After(time.Second):
+		t.Fatal("restored session did not time out")
+	}
+	if _, exists := restored.Get(groupCtx(1)); exists {
+		t.Error("timed out session should be removed")
+	}
+}
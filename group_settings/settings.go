@@ -0,0 +1,112 @@
+// Package groupsettings 按群保存的设置，各模块共用，键自己加前缀避免冲突。
+//
+// 设置单独存在 group_settings 表里，没有加到 groups 表上：groups 是关键词回复登记过的群，
+// 一个群一行、群名必填，没登记过的群也要能改设置；各模块的设置又是随意的键值，不适合做成 groups 的列。
+package groupsettings
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/doylecnn/qqbot/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+var db *sqlx.DB
+
+var cache = struct {
+	settings map[int64]map[string]string
+	mux      sync.RWMutex
+}{settings: make(map[int64]map[string]string)}
+
+// Init 设置数据库，清空缓存
+func Init(database *sqlx.DB) {
+	cache.mux.Lock()
+	defer cache.mux.Unlock()
+	db = database
+	cache.settings = make(map[int64]map[string]string)
+}
+
+func load(groupID int64) map[string]string {
+	cache.mux.RLock()
+	values, exists := cache.settings[groupID]
+	cache.mux.RUnlock()
+	if exists {
+		return values
+	}
+	cache.mux.Lock()
+	defer cache.mux.Unlock()
+	if values, exists = cache.settings[groupID]; exists {
+		return values
+	}
+	values = make(map[string]string)
+	if db != nil {
+		rows := []struct {
+			Key   string `db:"key"`
+			Value string `db:"value"`
+		}{}
+		err := db.Select(&rows, `SELECT key, value FROM group_settings WHERE group_number=?`, groupID)
+		if err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event":     "Group Settings",
+				"call":      "Select",
+				"err":       err,
+				"QQGroupId": groupID,
+			}).Warningln("读取群设置失败")
+		}
+		for _, row := range rows {
+			values[row.Key] = row.Value
+		}
+	}
+	cache.settings[groupID] = values
+	return values
+}
+
+// Lookup 读取群设置，没有设置过时 exists 为 false
+func Lookup(groupID int64, key string) (value string, exists bool) {
+	values := load(groupID)
+	cache.mux.RLock()
+	defer cache.mux.RUnlock()
+	value, exists = values[key]
+	return
+}
+
+// Get 读取群设置，没有设置过就返回 defaultValue
+func Get(groupID int64, key, defaultValue string) string {
+	if v, exists := Lookup(groupID, key); exists {
+		return v
+	}
+	return defaultValue
+}
+
+// Set 保存群设置
+func Set(groupID int64, key, value string) error {
+	if db == nil {
+		return errors.New("没有连接数据库，改不了")
+	}
+	values := load(groupID)
+	_, err := db.Exec(`INSERT INTO group_settings(group_number, key, value) VALUES (?, ?, ?)
+	ON CONFLICT(group_number, key) DO UPDATE SET value=excluded.value`, groupID, key, value)
+	if err != nil {
+		return err
+	}
+	cache.mux.Lock()
+	values[key] = value
+	cache.mux.Unlock()
+	return nil
+}
+
+// Keys 这个群设置过的所有键，按字母排序
+func Keys(groupID int64) []string {
+	values := load(groupID)
+	cache.mux.RLock()
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	cache.mux.RUnlock()
+	sort.Strings(keys)
+	return keys
+}
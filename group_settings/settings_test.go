@@ -0,0 +1,40 @@
+package groupsettings
+
+import (
+	"reflect"
+	"testing"
+
+	testdb "github.com/doylecnn/qqbot/test_db"
+)
+
+func TestSettings(t *testing.T) {
+	database := testdb.New(t)
+	database.MustExec(`INSERT INTO group_settings VALUES (1, 'plugin.dice', 'off')`)
+	Init(database)
+	defer Init(nil)
+
+	if v := Get(1, "plugin.dice", "on"); v != "off" {
+		t.Errorf("Get(1, plugin.dice) = %q", v)
+	}
+	if v := Get(2, "plugin.dice", "on"); v != "on" {
+		t.Errorf("Get(2, plugin.dice) = %q", v)
+	}
+	if err := Set(1, "plugin.dice", "on"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Set(1, "plugin.taunt", "off"); err != nil {
+		t.Fatal(err)
+	}
+	if v, exists := Lookup(1, "plugin.dice"); !exists || v != "on" {
+		t.Errorf("Lookup(1, plugin.dice) = %q, %v", v, exists)
+	}
+	if keys := Keys(1); !reflect.DeepEqual(keys, []string{"plugin.dice", "plugin.taunt"}) {
+		t.Errorf("Keys(1) = %v", keys)
+	}
+
+	// 清空缓存后从数据库读出来的一样
+	Init(database)
+	if v := Get(1, "plugin.taunt", "on"); v != "off" {
+		t.Errorf("after reload Get(1, plugin.taunt) = %q", v)
+	}
+}
@@ -0,0 +1,342 @@
+package hanyuwordle
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gamesession "github.com/doylecnn/qqbot/game_session"
+	"github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// difficultyTiers 按 THUOCL 词频排名取前百分之多少的词，hard 不限制
+var difficultyTiers = map[string]float64{
+	"easy":   0.2,
+	"normal": 0.6,
+	"hard":   1,
+}
+
+// freqCutoff 难度 -> 词长 -> 最低词频，在加载词典后计算
+var freqCutoff = make(map[string]map[int]int)
+
+func isDifficulty(s string) bool {
+	_, exists := difficultyTiers[strings.ToLower(s)]
+	return exists
+}
+
+func computeDifficulty() {
+	for tier, percent := range difficultyTiers {
+		if percent >= 1 {
+			continue
+		}
+		freqCutoff[tier] = make(map[int]int)
+		for length, words := range dict {
+			var freqs []int
+			for _, w := range words {
+				if w.Freq > 0 {
+					freqs = append(freqs, w.Freq)
+				}
+			}
+			if len(freqs) == 0 {
+				continue
+			}
+			sort.Sort(sort.Reverse(sort.IntSlice(freqs)))
+			idx := int(float64(len(freqs))*percent) - 1
+			if idx < 0 {
+				idx = 0
+			}
+			freqCutoff[tier][length] = freqs[idx]
+		}
+	}
+}
+
+// inDifficulty 没有词频的词（萌娘百科、自定义词）只在不限难度时出现
+func inDifficulty(w Word, difficulty string) bool {
+	cutoffs, exists := freqCutoff[strings.ToLower(difficulty)]
+	if !exists {
+		return true
+	}
+	cutoff, exists := cutoffs[len([]rune(w.Text))]
+	return exists && w.Freq >= cutoff
+}
+
+type blocklist struct {
+	words map[int64]map[string]bool
+	mux   sync.RWMutex
+}
+
+// blocked 群号为 0 的是全局屏蔽词
+var blocked = blocklist{words: make(map[int64]map[string]bool)}
+
+func (b *blocklist) load(groupID int64) map[string]bool {
+	b.mux.RLock()
+	words, exists := b.words[groupID]
+	b.mux.RUnlock()
+	if exists {
+		return words
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if words, exists = b.words[groupID]; exists {
+		return words
+	}
+	words = make(map[string]bool)
+	if db != nil {
+		rows := []string{}
+		if err := db.Select(&rows, `SELECT word FROM wordle_blocklist WHERE group_number=?`, groupID); err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event":     "Handle Game Blocklist",
+				"call":      "Select",
+				"err":       err,
+				"QQGroupId": groupID,
+			}).Warningln("读取屏蔽词失败")
+		}
+		for _, w := range rows {
+			words[w] = true
+		}
+	}
+	b.words[groupID] = words
+	return words
+}
+
+func (b *blocklist) contains(groupID int64, word string) bool {
+	global := b.load(0)
+	group := global
+	if groupID != 0 {
+		group = b.load(groupID)
+	}
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return global[word] || group[word]
+}
+
+func (b *blocklist) set(groupID, qq int64, word string, block bool) (err error) {
+	words := b.load(groupID)
+	if block {
+		_, err = db.Exec(`INSERT OR IGNORE INTO wordle_blocklist(group_number, word, qq_number, time) VALUES (?, ?, ?, ?)`, groupID, word, qq, time.Now().Unix())
+	} else {
+		_, err = db.Exec(`DELETE FROM wordle_blocklist WHERE group_number=? AND word=?`, groupID, word)
+	}
+	if err != nil {
+		return
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if block {
+		words[word] = true
+	} else {
+		delete(words, word)
+	}
+	return
+}
+
+// lastAnswer 本群正在进行或者刚结束的一局的答案
+func lastAnswer(ctx *zero.Ctx) (word Word, found bool) {
+	if s, exists := gamesession.Sessions.Get(ctx); exists {
+		s.View(func() {
+			if game, ok := s.Game.(*Game); ok && game.Status != Ready {
+				word, found = game.Answer.Word, true
+			}
+		})
+		if found {
+			return
+		}
+	}
+	lastGames.mux.Lock()
+	defer lastGames.mux.Unlock()
+	if game, exists := lastGames.games[gamesession.Key(ctx)]; exists {
+		return game.Answer.Word, true
+	}
+	return
+}
+
+// ReportAnswer 举报不合适的答案：/handle report [词] [原因]，不写词就是当前或上一局的答案
+func ReportAnswer(ctx *zero.Ctx, args []string) {
+	if db == nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("没有连接数据库，举报不了")))
+		return
+	}
+	var word Word
+	if len(args) > 0 && reZhongWenWord.MatchString(args[0]) {
+		word = Word{Text: args[0]}
+		args = args[1:]
+	} else if w, exists := lastAnswer(ctx); exists {
+		word = w
+	} else {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("用法：/handle report [词] [原因]，不写词就是举报本群当前或上一局的答案")))
+		return
+	}
+	_, err := db.Exec(`INSERT INTO wordle_reports(group_number, word, type, reason, qq_number, time, status) VALUES (?, ?, ?, ?, ?, ?, 'pending')`,
+		ctx.Event.GroupID, word.Text, word.Type, strings.Join(args, " "), ctx.Event.UserID, time.Now().Unix())
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event":     "Handle Game Report",
+			"call":      "Exec",
+			"err":       err,
+			"QQGroupId": ctx.Event.GroupID,
+		}).Warningln("记录举报失败")
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("举报失败了，稍后再试试")))
+		return
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("收到，管理员审核后这个词就不会再当答案了")))
+}
+
+// pinYinReportType 读音反馈也记在 wordle_reports 里，reason 是反馈的拼音
+const pinYinReportType = "读音"
+
+type report struct {
+	ID     int64  `db:"id"`
+	Group  int64  `db:"group_number"`
+	Word   string `db:"word"`
+	Type   string `db:"type"`
+	Reason string `db:"reason"`
+	QQ     int64  `db:"qq_number"`
+	Time   int64  `db:"time"`
+	Status string `db:"status"`
+}
+
+// ReviewReports 审核举报：/handle reports [approve|reject 编号]。
+// 群管理员只能在群里看本群的举报，批准后加入本群屏蔽词；超级用户看全部，批准后加入全局屏蔽词。
+// 读音反馈批准后所有群的读音都会改，只有超级用户能看能审
+func ReviewReports(ctx *zero.Ctx, args []string) {
+	if !plugin.GroupAdmin(ctx) {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("只有管理员可以审核举报")))
+		return
+	}
+	if db == nil {
+		return
+	}
+	superUser := zero.SuperUserPermission(ctx)
+	if len(args) < 2 {
+		reports := []report{}
+		query := `SELECT * FROM wordle_reports WHERE status='pending'`
+		params := []interface{}{}
+		if !superUser {
+			query += ` AND group_number=? AND type<>?`
+			params = append(params, ctx.Event.GroupID, pinYinReportType)
+		}
+		query += ` ORDER BY id LIMIT 20`
+		if err := db.Select(&reports, query, params...); err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event": "Handle Game Review",
+				"call":  "Select",
+				"err":   err,
+			}).Warningln("读取举报失败")
+			return
+		}
+		if len(reports) == 0 {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("没有待审核的举报")))
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("待审核的举报：\n")
+		for _, r := range reports {
+			if r.Type == pinYinReportType {
+				fmt.Fprintf(&sb, "#%d %s 应读作 %s\n", r.ID, r.Word, r.Reason)
+			} else {
+				fmt.Fprintf(&sb, "#%d %s（%s）%s\n", r.ID, r.Word, r.Type, r.Reason)
+			}
+		}
+		sb.WriteString("/handle reports approve|reject 编号")
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(sb.String())))
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(args[1], "#"), 10, 64)
+	if err != nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("编号不对")))
+		return
+	}
+	var r report
+	if err = db.Get(&r, `SELECT * FROM wordle_reports WHERE id=? AND status='pending'`, id); err != nil || (!superUser && (r.Group != ctx.Event.GroupID || r.Type == pinYinReportType)) {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("没有这个待审核的举报")))
+		return
+	}
+	status := ""
+	switch strings.ToLower(args[0]) {
+	case "approve":
+		status = "approved"
+		if r.Type == pinYinReportType {
+			err = savePinYin(r.Word, strings.Fields(r.Reason), ctx.Event.UserID)
+			break
+		}
+		groupID := ctx.Event.GroupID
+		if superUser {
+			groupID = 0
+		}
+		err = blocked.set(groupID, ctx.Event.UserID, r.Word, true)
+	case "reject":
+		status = "rejected"
+	default:
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("/handle reports approve|reject 编号")))
+		return
+	}
+	if err == nil {
+		_, err = db.Exec(`UPDATE wordle_reports SET status=? WHERE id=?`, status, id)
+	}
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Handle Game Review",
+			"call":  "Exec",
+			"err":   err,
+		}).Warningln("审核举报失败")
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("审核失败了，稍后再试试")))
+		return
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("#%d %s 已处理：%s", id, r.Word, status))))
+}
+
+// setBlock 群号为 0 的是全局屏蔽词，私聊里改的也是全局的，都要超级用户
+func setBlock(ctx *zero.Ctx, args []string, block bool) {
+	if !plugin.GroupAdmin(ctx) {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("只有管理员可以修改屏蔽词")))
+		return
+	}
+	if len(args) == 0 || !reZhongWenWord.MatchString(args[0]) {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("用法：/handle block|unblock 词 [global]")))
+		return
+	}
+	if db == nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("没有连接数据库，改不了")))
+		return
+	}
+	groupID := ctx.Event.GroupID
+	if len(args) > 1 && strings.ToLower(args[1]) == "global" {
+		groupID = 0
+	}
+	if groupID == 0 && !zero.SuperUserPermission(ctx) {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("只有超级用户可以修改全局屏蔽词")))
+		return
+	}
+	if err := blocked.set(groupID, ctx.Event.UserID, args[0], block); err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event":     "Handle Game Blocklist",
+			"call":      "Exec",
+			"err":       err,
+			"QQGroupId": groupID,
+		}).Warningln("修改屏蔽词失败")
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("修改失败了，稍后再试试")))
+		return
+	}
+	if block {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(args[0]+" 不会再当答案了")))
+	} else {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(args[0]+" 已经解除屏蔽")))
+	}
+}
+
+// BlockWord 屏蔽答案：/handle block 词 [global]
+func BlockWord(ctx *zero.Ctx, args []string) {
+	setBlock(ctx, args, true)
+}
+
+// UnblockWord 解除屏蔽：/handle unblock 词 [global]
+func UnblockWord(ctx *zero.Ctx, args []string) {
+	setBlock(ctx, args, false)
+}
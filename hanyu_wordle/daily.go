@@ -0,0 +1,460 @@
+package hanyuwordle
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doylecnn/qqbot/log"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const defaultDailyLength = 4
+
+var dailySeed = "hanyu-wordle"
+
+type dailyGame struct {
+	*Game
+	Date      string
+	UserID    int64
+	GroupID   int64
+	StartTime time.Time
+}
+
+type dailyGames struct {
+	games map[int64]*dailyGame
+	mux   sync.Mutex
+}
+
+var daily = dailyGames{games: make(map[int64]*dailyGame)}
+
+type dailyResult struct {
+	Date     string `db:"date"`
+	Length   int    `db:"length"`
+	QQ       int64  `db:"qq_number"`
+	Group    int64  `db:"group_number"`
+	Name     string `db:"name"`
+	Guesses  int    `db:"guesses"`
+	Solved   bool   `db:"solved"`
+	Finished bool   `db:"finished"`
+	Seconds  int64  `db:"seconds"`
+	Grid     string `db:"grid"`
+}
+
+func today() string {
+	return time.Now().Format("2006-01-02")
+}
+
+// dailyOrders 每日汉兜的候选词排好序后按日期缓存，换了一天才重新排，全局屏蔽词第二天生效
+var dailyOrders = struct {
+	date   string
+	orders map[int][]Word
+	mux    sync.Mutex
+}{orders: make(map[int][]Word)}
+
+// dailyOrder 当天某个长度的候选词，只排除全局屏蔽词。
+// 词典启动时会被打乱，这里排好序，保证重启后结果不变
+func dailyOrder(date string, length int) []Word {
+	dailyOrders.mux.Lock()
+	defer dailyOrders.mux.Unlock()
+	if dailyOrders.date != date {
+		dailyOrders.date = date
+		dailyOrders.orders = make(map[int][]Word)
+	}
+	if candidates, exists := dailyOrders.orders[length]; exists {
+		return candidates
+	}
+	var candidates []Word
+	for _, w := range dict[length] {
+		if !blocked.contains(0, w.Text) {
+			candidates = append(candidates, w)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Text == candidates[j].Text {
+			return candidates[i].Type < candidates[j].Type
+		}
+		return candidates[i].Text < candidates[j].Text
+	})
+	dailyOrders.orders[length] = candidates
+	return candidates
+}
+
+// dailyAnswer 用种子、日期和长度算出当天的答案，所有群都一样
+func dailyAnswer(date string, length int) (Word, error) {
+	candidates := dailyOrder(date, length)
+	if len(candidates) == 0 {
+		return Word{}, errors.New("非常不巧，词典里没有这个长度的词……")
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%s|%d", dailySeed, date, length)
+	return candidates[h.Sum64()%uint64(len(candidates))], nil
+}
+
+func dailyLength(args []string) (int, error) {
+	if len(args) == 0 {
+		return defaultDailyLength, nil
+	}
+	length, err := strconv.Atoi(args[0])
+	if err != nil || length < 2 || length > 9 {
+		return 0, errors.New("长度要在 2 到 9 之间")
+	}
+	return length, nil
+}
+
+// DailyCommand 每日汉兜：/handle daily [长度]、/handle daily rank [长度]、/handle daily summary [长度]
+func DailyCommand(ctx *zero.Ctx, args []string) {
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "rank":
+			DailyRank(ctx, args[1:])
+			return
+		case "summary":
+			DailySummary(ctx, args[1:])
+			return
+		}
+	}
+	DailyStart(ctx, args)
+}
+
+// DailyStart 开始今天的每日汉兜。答案所有人都一样，在群里猜会剧透，所以群里只登记，私聊里猜；
+// 成绩仍然算在开局的群。没猜完的进度存在数据库里，重启后再发 /handle daily 可以接着猜
+func DailyStart(ctx *zero.Ctx, args []string) {
+	length, err := dailyLength(args)
+	if err != nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err.Error())))
+		return
+	}
+	dictOnce.Do(wordleDictionaryInit)
+	date := today()
+	daily.mux.Lock()
+	game, exists := daily.games[ctx.Event.UserID]
+	daily.mux.Unlock()
+	if exists && game.Date != date {
+		expireDaily(game)
+	} else if exists {
+		replyUnfinished(ctx, game)
+		return
+	}
+	answer, err := dailyAnswer(date, length)
+	if err != nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err.Error())))
+		return
+	}
+	if db == nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("没有连接数据库，玩不了每日汉兜")))
+		return
+	}
+	game = &dailyGame{
+		Game:      &Game{Status: Start, guesses: make(map[string]Guess), Answer: Answer{Word: answer, PinYin: makePinYin(answer.Text)}},
+		Date:      date,
+		UserID:    ctx.Event.UserID,
+		GroupID:   ctx.Event.GroupID,
+		StartTime: time.Now(),
+	}
+	_, err = db.Exec(`INSERT INTO wordle_daily(date, length, qq_number, group_number, name, guesses, solved, finished, seconds, grid) VALUES (?, ?, ?, ?, ?, 0, 0, 0, 0, '')`,
+		date, length, ctx.Event.UserID, ctx.Event.GroupID, ctx.Event.Sender.Name())
+	if err != nil && strings.Contains(err.Error(), "UNIQUE") {
+		var restored bool
+		restored, err = restoreDaily(game)
+		if err == nil && !restored {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("今天的 %d 字每日汉兜你已经玩过啦，明天再来", length))))
+			return
+		}
+	}
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event":     "Handle Game Daily Start",
+			"call":      "Exec",
+			"err":       err,
+			"QQGroupId": ctx.Event.GroupID,
+			"QQ":        ctx.Event.UserID,
+		}).Warningln("记录每日汉兜失败")
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("开局失败了，稍后再试试")))
+		return
+	}
+	// 查数据库和发消息都不拿着 daily.mux，只在登记的时候锁一下，同时发了两次的话后一次不算
+	daily.mux.Lock()
+	if current, exists := daily.games[ctx.Event.UserID]; exists {
+		daily.mux.Unlock()
+		replyUnfinished(ctx, current)
+		return
+	}
+	daily.games[ctx.Event.UserID] = game
+	daily.mux.Unlock()
+	log.Log.WithFields(logrus.Fields{
+		"event":     "Handle Game Daily Start",
+		"Date":      date,
+		"Length":    length,
+		"Guesses":   game.Count,
+		"QQGroupId": game.GroupID,
+		"QQ":        ctx.Event.UserID,
+	}).Infoln("每日汉兜开始")
+	if game.Count > 0 {
+		text := fmt.Sprintf("接着猜 %s 的 %d 字每日汉兜，已经猜了 %d 次", date, length, game.Count)
+		if ctx.Event.GroupID != 0 {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(text+"，私聊我接着猜吧")))
+			return
+		}
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, renderBoard(game.Game, 0), message.Text(text)))
+		return
+	}
+	text := fmt.Sprintf("%s 的 %d 字每日汉兜开始啦，所有人的答案都一样，每人每天只能玩一次\n", date, length)
+	if ctx.Event.GroupID != 0 {
+		text += fmt.Sprintf("为了不剧透，请私聊我发 %d 个字的词来猜，成绩算在本群", length)
+	} else {
+		text += fmt.Sprintf("直接发 %d 个字的词来猜，输入“放弃”结束", length)
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(text)))
+}
+
+func replyUnfinished(ctx *zero.Ctx, game *dailyGame) {
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("你在%s开的每日汉兜还没猜完，私聊我接着猜吧", chatName(game.GroupID)))))
+}
+
+func chatName(groupID int64) string {
+	if groupID == 0 {
+		return "私聊"
+	}
+	return fmt.Sprintf("群 %d", groupID)
+}
+
+// restoreDaily 今天已经有记录时，没猜完的按存下来的词重放进度，返回 false 表示已经玩完了。
+// 成绩算在原来开局的地方
+func restoreDaily(game *dailyGame) (bool, error) {
+	var r dailyResult
+	err := db.Get(&r, `SELECT * FROM wordle_daily WHERE date=? AND length=? AND qq_number=?`,
+		game.Date, len([]rune(game.Answer.Word.Text)), game.UserID)
+	if err != nil || r.Finished {
+		return false, err
+	}
+	game.GroupID = r.Group
+	game.StartTime = time.Now().Add(-time.Duration(r.Seconds) * time.Second)
+	for _, word := range strings.Fields(r.Grid) {
+		guessPinYin := makePinYin(word)
+		if len(guessPinYin) != len(game.Answer.PinYin) {
+			continue
+		}
+		g := Guess{UserName: r.Name, Word: word, PinYin: guessPinYin, Tag: pinYinMatch(guessPinYin, game.Answer.PinYin)}
+		game.GuessList = append(game.GuessList, g)
+		game.guesses[word] = g
+		game.Count++
+	}
+	return true, nil
+}
+
+// expireDaily 不是今天的每日汉兜算作没猜出来，给新的一天让位
+func expireDaily(game *dailyGame) {
+	game.Mux.Lock()
+	defer game.Mux.Unlock()
+	if game.Status == End {
+		return
+	}
+	game.Status = End
+	finishDaily(game, false)
+}
+
+// dailyGuess 处理每日汉兜的猜测，只在私聊里猜，返回 false 表示这条消息不归每日汉兜管
+func dailyGuess(ctx *zero.Ctx) bool {
+	if ctx.Event.GroupID != 0 {
+		return false
+	}
+	daily.mux.Lock()
+	game, exists := daily.games[ctx.Event.UserID]
+	daily.mux.Unlock()
+	if !exists {
+		return false
+	}
+	if game.Date != today() {
+		expireDaily(game)
+		return false
+	}
+	msg := strings.TrimSpace(ctx.MessageString())
+	if len([]rune(msg)) != len([]rune(game.Answer.Word.Text)) {
+		return false
+	}
+	game.Mux.Lock()
+	defer game.Mux.Unlock()
+	if game.Status == End {
+		return false
+	}
+	if _, exists := game.guesses[msg]; exists {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("这个词已经猜过啦")))
+		return true
+	}
+	guessPinYin := makePinYin(msg)
+	if len(guessPinYin) == 0 {
+		return false
+	}
+	board, _ := guess(game.Game, ctx, msg, guessPinYin, game.Answer.PinYin)
+	if game.Answer.Word.Text != msg {
+		saveDailyProgress(game)
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, board, message.Text(fmt.Sprintf("每日汉兜 第 %d 次", game.Count))))
+		return true
+	}
+	game.Status = End
+	finishDaily(game, true)
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, board, message.Text(fmt.Sprintf("（总共 %d 次）猜对啦！%s\n\n%s", game.Count, revealText(game.Answer), dailyShareText(game)))))
+	return true
+}
+
+// dailyStop 在私聊里放弃当前的每日汉兜，返回 false 表示没有进行中的每日汉兜
+func dailyStop(ctx *zero.Ctx) bool {
+	if ctx.Event.GroupID != 0 {
+		return false
+	}
+	daily.mux.Lock()
+	game, exists := daily.games[ctx.Event.UserID]
+	daily.mux.Unlock()
+	if !exists {
+		return false
+	}
+	game.Mux.Lock()
+	defer game.Mux.Unlock()
+	if game.Status == End {
+		return false
+	}
+	game.Status = End
+	finishDaily(game, false)
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("每日汉兜结束\n%s\n\n%s", revealText(game.Answer), dailyShareText(game)))))
+	return true
+}
+
+// saveDailyProgress 没猜完时 grid 里存猜过的词，重启后用来恢复。调用方需持有 game.Mux
+func saveDailyProgress(game *dailyGame) {
+	if db == nil {
+		return
+	}
+	words := make([]string, 0, len(game.GuessList))
+	for _, g := range game.GuessList {
+		words = append(words, g.Word)
+	}
+	_, err := db.Exec(`UPDATE wordle_daily SET guesses=?, seconds=?, grid=? WHERE date=? AND length=? AND qq_number=? AND finished=0`,
+		game.Count, int64(time.Since(game.StartTime).Seconds()), strings.Join(words, " "), game.Date, len([]rune(game.Answer.Word.Text)), game.UserID)
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Handle Game Daily Progress",
+			"call":  "Exec",
+			"err":   err,
+			"QQ":    game.UserID,
+		}).Warningln("记录每日汉兜进度失败")
+	}
+}
+
+// finishDaily 调用方需持有 game.Mux
+func finishDaily(game *dailyGame, solved bool) {
+	daily.mux.Lock()
+	if daily.games[game.UserID] == game {
+		delete(daily.games, game.UserID)
+	}
+	daily.mux.Unlock()
+	if db == nil {
+		return
+	}
+	_, err := db.Exec(`UPDATE wordle_daily SET guesses=?, solved=?, finished=1, seconds=?, grid=? WHERE date=? AND length=? AND qq_number=?`,
+		game.Count, solved, int64(time.Since(game.StartTime).Seconds()), shareText(game.Game), game.Date, len([]rune(game.Answer.Word.Text)), game.UserID)
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Handle Game Daily Finish",
+			"call":  "Exec",
+			"err":   err,
+			"QQ":    game.UserID,
+		}).Warningln("记录每日汉兜结果失败")
+	}
+}
+
+func dailyShareText(game *dailyGame) string {
+	return fmt.Sprintf("每日汉兜 %s\n%s", game.Date, shareText(game.Game))
+}
+
+// DailyRank 今天的每日汉兜排行，群里只看本群，私聊看全部
+func DailyRank(ctx *zero.Ctx, args []string) {
+	length, err := dailyLength(args)
+	if err != nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err.Error())))
+		return
+	}
+	if db == nil {
+		return
+	}
+	results := []dailyResult{}
+	query := `SELECT * FROM wordle_daily WHERE date=? AND length=? AND finished=1`
+	params := []interface{}{today(), length}
+	if ctx.Event.GroupID != 0 {
+		query += ` AND group_number=?`
+		params = append(params, ctx.Event.GroupID)
+	}
+	query += ` ORDER BY solved DESC, guesses ASC, seconds ASC LIMIT 10`
+	if err = db.Select(&results, query, params...); err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Handle Game Daily Rank",
+			"call":  "Select",
+			"err":   err,
+		}).Warningln("读取每日汉兜排行失败")
+		return
+	}
+	if len(results) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("今天还没有人完成 %d 字每日汉兜", length))))
+		return
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %d 字每日汉兜排行\n", today(), length)
+	for i, r := range results {
+		if r.Solved {
+			fmt.Fprintf(&sb, "%d. %s  %d 次  %s\n", i+1, r.Name, r.Guesses, time.Duration(r.Seconds)*time.Second)
+		} else {
+			fmt.Fprintf(&sb, "%d. %s  没猜出来\n", i+1, r.Name)
+		}
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(strings.TrimRight(sb.String(), "\n"))))
+}
+
+// DailySummary 今天每日汉兜在各个群的成绩汇总
+func DailySummary(ctx *zero.Ctx, args []string) {
+	length, err := dailyLength(args)
+	if err != nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err.Error())))
+		return
+	}
+	if db == nil {
+		return
+	}
+	summaries := []struct {
+		Group   int64           `db:"group_number"`
+		Players int             `db:"players"`
+		Solved  int             `db:"solved"`
+		Average sql.NullFloat64 `db:"average"`
+	}{}
+	err = db.Select(&summaries, `SELECT group_number, count(*) AS players, sum(solved) AS solved, avg(CASE WHEN solved THEN guesses END) AS average
+	FROM wordle_daily WHERE date=? AND length=? AND finished=1 GROUP BY group_number ORDER BY solved DESC, average ASC`, today(), length)
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Handle Game Daily Summary",
+			"call":  "Select",
+			"err":   err,
+		}).Warningln("读取每日汉兜汇总失败")
+		return
+	}
+	if len(summaries) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("今天还没有人完成 %d 字每日汉兜", length))))
+		return
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %d 字每日汉兜各群成绩\n", today(), length)
+	for _, s := range summaries {
+		if s.Average.Valid {
+			fmt.Fprintf(&sb, "%s：%d 人参与，%d 人猜出，平均 %.1f 次\n", chatName(s.Group), s.Players, s.Solved, s.Average.Float64)
+		} else {
+			fmt.Fprintf(&sb, "%s：%d 人参与，没人猜出\n", chatName(s.Group), s.Players)
+		}
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(strings.TrimRight(sb.String(), "\n"))))
+}
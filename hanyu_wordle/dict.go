@@ -0,0 +1,335 @@
+package hanyuwordle
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+//go:embed wordle_dicts
+var dictsDir embed.FS
+
+var dict map[int][]Word = make(map[int][]Word)
+var dictOnce sync.Once
+
+// dictDir 外部词典目录，文件命名规则和内置词典一样
+var dictDir string
+
+// minFreq 低于这个词频的 THUOCL 词不会被当作答案，没有词频的词不受影响
+var minFreq int
+
+const customWordType = "自定义"
+
+// dictName 从文件名取词典名：THUOCL_成语.txt、dict_萌娘百科.txt 或者 其他.txt
+func dictName(filename string) (string, bool) {
+	if !strings.HasSuffix(filename, ".txt") {
+		return "", false
+	}
+	name := strings.TrimSuffix(filename, ".txt")
+	name = strings.TrimPrefix(name, "THUOCL_")
+	name = strings.TrimPrefix(name, "dict_")
+	return name, name != ""
+}
+
+// parseDictionary 每行一个词，THUOCL 格式的第二列是词频
+func parseDictionary(r io.Reader, name string) (words []Word) {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		word := strings.TrimSpace(fields[0])
+		if !reZhongWenWord.MatchString(word) {
+			continue
+		}
+		freq := 0
+		if len(fields) > 1 {
+			freq, _ = strconv.Atoi(strings.TrimSpace(fields[1]))
+		}
+		if freq > 0 && freq < minFreq {
+			continue
+		}
+		words = append(words, Word{Text: word, Type: name, Freq: freq})
+	}
+	return
+}
+
+func loadDictionaries(fsys fs.FS, dir string) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Handle Game Init",
+			"Error": err,
+			"Dir":   dir,
+		}).Warningln("读取词典目录失败")
+		return
+	}
+	for _, entry := range entries {
+		name, ok := dictName(entry.Name())
+		if entry.IsDir() || !ok {
+			continue
+		}
+		f, err := fsys.Open(path.Join(dir, entry.Name()))
+		if err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event":    "Handle Game Init",
+				"Error":    err,
+				"DictName": name,
+			}).Warningln("词典打不开，跳过")
+			continue
+		}
+		words := parseDictionary(f, name)
+		f.Close()
+		for _, w := range words {
+			length := len([]rune(w.Text))
+			dict[length] = append(dict[length], w)
+		}
+		log.Log.WithFields(logrus.Fields{
+			"event":    "Handle Game Init",
+			"DictName": name,
+			"Count":    len(words),
+		}).Infoln("加载词典")
+	}
+}
+
+func wordleDictionaryInit() {
+	loadDictionaries(dictsDir, "wordle_dicts")
+	if dictDir != "" {
+		loadDictionaries(os.DirFS(dictDir), ".")
+	}
+	for k, v := range dict {
+		dict[k] = lo.Shuffle(v)
+	}
+	computeDifficulty()
+}
+
+// DictionaryWords 返回某个词典里的全部词，比如 成语，给其他小游戏用
+func DictionaryWords(name string) (words []Word) {
+	dictOnce.Do(wordleDictionaryInit)
+	for _, ws := range dict {
+		for _, w := range ws {
+			if w.Type == name {
+				words = append(words, w)
+			}
+		}
+	}
+	return
+}
+
+// AllWords 返回所有词典里的词，包括外部词典，给分词之类的用
+func AllWords() (words []string) {
+	dictOnce.Do(wordleDictionaryInit)
+	for _, ws := range dict {
+		for _, w := range ws {
+			words = append(words, w.Text)
+		}
+	}
+	return
+}
+
+type customDicts struct {
+	words map[int64]map[string]Word
+	mux   sync.RWMutex
+}
+
+var custom = customDicts{words: make(map[int64]map[string]Word)}
+
+func (c *customDicts) load(groupID int64) map[string]Word {
+	c.mux.RLock()
+	words, exists := c.words[groupID]
+	c.mux.RUnlock()
+	if exists {
+		return words
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if words, exists = c.words[groupID]; exists {
+		return words
+	}
+	words = make(map[string]Word)
+	if db != nil {
+		rows := []string{}
+		if err := db.Select(&rows, `SELECT word FROM wordle_custom_words WHERE group_number=?`, groupID); err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event":     "Handle Game Custom Dict",
+				"call":      "Select",
+				"err":       err,
+				"QQGroupId": groupID,
+			}).Warningln("读取自定义词典失败")
+		}
+		for _, w := range rows {
+			words[w] = Word{Text: w, Type: customWordType}
+		}
+	}
+	c.words[groupID] = words
+	return words
+}
+
+func (c *customDicts) list(groupID int64, length int) (result []Word) {
+	words := c.load(groupID)
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	for _, w := range words {
+		if length == 0 || len([]rune(w.Text)) == length {
+			result = append(result, w)
+		}
+	}
+	return
+}
+
+func (c *customDicts) add(groupID, qq int64, texts []string) (added []string, err error) {
+	words := c.load(groupID)
+	for _, text := range texts {
+		if !reZhongWenWord.MatchString(text) || len([]rune(text)) < 2 || len([]rune(text)) > 9 {
+			continue
+		}
+		c.mux.RLock()
+		_, exists := words[text]
+		c.mux.RUnlock()
+		if exists {
+			continue
+		}
+		_, err = db.Exec(`INSERT INTO wordle_custom_words(group_number, word, qq_number, time) VALUES (?, ?, ?, ?)`, groupID, text, qq, time.Now().Unix())
+		if err != nil {
+			return
+		}
+		c.mux.Lock()
+		words[text] = Word{Text: text, Type: customWordType}
+		c.mux.Unlock()
+		added = append(added, text)
+	}
+	return
+}
+
+func (c *customDicts) remove(groupID int64, texts []string) (removed []string, err error) {
+	words := c.load(groupID)
+	for _, text := range texts {
+		c.mux.RLock()
+		_, exists := words[text]
+		c.mux.RUnlock()
+		if !exists {
+			continue
+		}
+		_, err = db.Exec(`DELETE FROM wordle_custom_words WHERE group_number=? AND word=?`, groupID, text)
+		if err != nil {
+			return
+		}
+		c.mux.Lock()
+		delete(words, text)
+		c.mux.Unlock()
+		removed = append(removed, text)
+	}
+	return
+}
+
+// answerCandidates 可以当作答案的词：公共词典加上本群的自定义词，去掉屏蔽词，再按难度筛选。
+// 按难度筛完没词了就不限难度
+func answerCandidates(groupID int64, length int, difficulty string) []Word {
+	words := dict[length]
+	if groupID != 0 {
+		words = append(append([]Word{}, words...), custom.list(groupID, length)...)
+	}
+	var candidates, all []Word
+	for _, w := range words {
+		if blocked.contains(groupID, w.Text) {
+			continue
+		}
+		all = append(all, w)
+		if inDifficulty(w, difficulty) {
+			candidates = append(candidates, w)
+		}
+	}
+	if len(candidates) == 0 {
+		return all
+	}
+	return candidates
+}
+
+// Candidates 给其他小游戏出题用的词，和汉兜一样考虑自定义词和屏蔽词，难度为 normal
+func Candidates(groupID int64, length int) []Word {
+	dictOnce.Do(wordleDictionaryInit)
+	return answerCandidates(groupID, length, "normal")
+}
+
+// DictCommand 管理本群的自定义词：/handle dict [add|remove|import] 词…
+func DictCommand(ctx *zero.Ctx, args []string) {
+	dictOnce.Do(wordleDictionaryInit)
+	if len(args) == 0 {
+		var sb strings.Builder
+		lengths := lo.Keys(dict)
+		sort.Ints(lengths)
+		sb.WriteString("词典里的词：\n")
+		for _, l := range lengths {
+			fmt.Fprintf(&sb, "%d 字：%d 个\n", l, len(dict[l]))
+		}
+		if ctx.Event.GroupID != 0 {
+			fmt.Fprintf(&sb, "本群自定义：%d 个\n", len(custom.list(ctx.Event.GroupID, 0)))
+		}
+		sb.WriteString("用法：/handle dict add|remove 词…，/handle dict import 后面每行一个词")
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(sb.String())))
+		return
+	}
+	if ctx.Event.GroupID == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("自定义词只能在群里管理")))
+		return
+	}
+	if !plugin.GroupAdmin(ctx) {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("只有管理员可以管理自定义词")))
+		return
+	}
+	if db == nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("没有连接数据库，改不了")))
+		return
+	}
+	var (
+		changed []string
+		err     error
+		verb    string
+	)
+	switch strings.ToLower(args[0]) {
+	case "add":
+		verb = "添加"
+		changed, err = custom.add(ctx.Event.GroupID, ctx.Event.UserID, args[1:])
+	case "import":
+		verb = "导入"
+		var texts []string
+		full := ctx.State["args"].(string)
+		rest := full[strings.Index(full, args[0])+len(args[0]):]
+		for _, line := range strings.Split(rest, "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 {
+				texts = append(texts, fields[0])
+			}
+		}
+		changed, err = custom.add(ctx.Event.GroupID, ctx.Event.UserID, texts)
+	case "remove":
+		verb = "删除"
+		changed, err = custom.remove(ctx.Event.GroupID, args[1:])
+	default:
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("用法：/handle dict add|remove 词…，/handle dict import 后面每行一个词")))
+		return
+	}
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event":     "Handle Game Custom Dict",
+			"call":      "Exec",
+			"err":       err,
+			"QQGroupId": ctx.Event.GroupID,
+		}).Warningln("修改自定义词典失败")
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("%s了 %d 个词：%s", verb, len(changed), strings.Join(changed, "、")))))
+}
@@ -0,0 +1,42 @@
+package hanyuwordle
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDictName(t *testing.T) {
+	cases := []struct {
+		filename string
+		name     string
+		ok       bool
+	}{
+		{"THUOCL_成语.txt", "成语", true},
+		{"dict_萌娘百科.txt", "萌娘百科", true},
+		{"歇后语.txt", "歇后语", true},
+		{"README.md", "", false},
+	}
+	for _, c := range cases {
+		name, ok := dictName(c.filename)
+		if name != c.name || ok != c.ok {
+			t.Errorf("dictName(%s) = %s, %v, want %s, %v", c.filename, name, ok, c.name, c.ok)
+		}
+	}
+}
+
+func TestParseDictionaryMinFreq(t *testing.T) {
+	defer func(old int) { minFreq = old }(minFreq)
+	minFreq = 100
+	data := "坚定不移 \t 54113\n冷僻词\t 12\n没有词频\nabc\t999\n"
+	words := parseDictionary(strings.NewReader(data), "成语")
+	var got []string
+	for _, w := range words {
+		got = append(got, w.Text)
+	}
+	if strings.Join(got, ",") != "坚定不移,没有词频" {
+		t.Errorf("parseDictionary = %v", got)
+	}
+	if words[0].Freq != 54113 || words[0].Type != "成语" {
+		t.Errorf("parseDictionary()[0] = %+v", words[0])
+	}
+}
@@ -0,0 +1,165 @@
+package hanyuwordle
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/doylecnn/qqbot/log"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed wordle_glossary
+var glossaryFS embed.FS
+
+// glossaryDir 外部词义目录，文件名和词典名相同，比如 成语.txt、萌娘百科.txt
+var glossaryDir string
+
+// searchURLs 词典名 -> 搜索链接模板，{word} 会替换成答案，空字符串是默认模板
+var searchURLs = map[string]string{
+	"":     "https://www.bing.com/search?q={word}",
+	"萌娘百科": "https://zh.moegirl.org.cn/{word}",
+}
+
+type glossaryDict struct {
+	// meanings 词典名 -> 词 -> 释义
+	meanings map[string]map[string]string
+	// names 词典名按字典序排好，查其他词义表时按这个顺序，同一个词每次查到的释义都一样
+	names []string
+	once  sync.Once
+}
+
+var glossary = glossaryDict{meanings: make(map[string]map[string]string)}
+
+func (g *glossaryDict) load(fsys fs.FS, dir string) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Handle Game Glossary",
+			"Error": err,
+			"Dir":   dir,
+		}).Warningln("读取词义目录失败")
+		return
+	}
+	for _, entry := range entries {
+		name, ok := dictName(entry.Name())
+		if entry.IsDir() || !ok {
+			continue
+		}
+		f, err := fsys.Open(path.Join(dir, entry.Name()))
+		if err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event":    "Handle Game Glossary",
+				"Error":    err,
+				"DictName": name,
+			}).Warningln("词义文件打不开，跳过")
+			continue
+		}
+		if g.meanings[name] == nil {
+			g.meanings[name] = make(map[string]string)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			fields := strings.SplitN(line, "\t", 2)
+			if len(fields) == 2 {
+				g.meanings[name][strings.TrimSpace(fields[0])] = strings.TrimSpace(fields[1])
+			}
+		}
+		f.Close()
+	}
+	g.names = g.names[:0]
+	for name := range g.meanings {
+		g.names = append(g.names, name)
+	}
+	sort.Strings(g.names)
+}
+
+// lookup 先查和词典同名的词义表，查不到再按词典名的顺序查其他的
+func (g *glossaryDict) lookup(w Word) string {
+	g.once.Do(func() {
+		g.load(glossaryFS, "wordle_glossary")
+		if glossaryDir != "" {
+			g.load(os.DirFS(glossaryDir), ".")
+		}
+	})
+	if meaning, exists := g.meanings[w.Type][w.Text]; exists {
+		return meaning
+	}
+	for _, name := range g.names {
+		if meaning, exists := g.meanings[name][w.Text]; exists {
+			return meaning
+		}
+	}
+	return ""
+}
+
+var toneMarks = map[rune][4]rune{
+	'a': {'ā', 'á', 'ǎ', 'à'},
+	'e': {'ē', 'é', 'ě', 'è'},
+	'i': {'ī', 'í', 'ǐ', 'ì'},
+	'o': {'ō', 'ó', 'ǒ', 'ò'},
+	'u': {'ū', 'ú', 'ǔ', 'ù'},
+	'ü': {'ǖ', 'ǘ', 'ǚ', 'ǜ'},
+}
+
+// markTone 把 hang2 这样的拼音写成 háng：a、e 和 ou 里的 o 优先标调，否则标最后一个元音
+func markTone(initial, final, tone string) string {
+	runes := []rune(strings.ReplaceAll(final, "v", "ü"))
+	if len(tone) != 1 || tone < "1" || tone > "4" {
+		return initial + string(runes)
+	}
+	pos := -1
+	for i, r := range runes {
+		if r == 'a' || r == 'e' || (r == 'o' && i+1 < len(runes) && runes[i+1] == 'u') {
+			pos = i
+			break
+		}
+		if _, exists := toneMarks[r]; exists {
+			pos = i
+		}
+	}
+	if pos >= 0 {
+		runes[pos] = toneMarks[runes[pos]][tone[0]-'1']
+	}
+	return initial + string(runes)
+}
+
+// TonePinYin 带声调符号的拼音，比如 yín háng
+func TonePinYin(pinYin [][4]string) string {
+	syllables := make([]string, 0, len(pinYin))
+	for _, p := range pinYin {
+		syllables = append(syllables, markTone(p[1], p[2], p[3]))
+	}
+	return strings.Join(syllables, " ")
+}
+
+func searchURL(w Word) string {
+	template, exists := searchURLs[w.Type]
+	if !exists {
+		template = searchURLs[""]
+	}
+	return strings.ReplaceAll(template, "{word}", url.QueryEscape(w.Text))
+}
+
+// revealText 公布答案：拼音、分类、释义和搜索链接
+func revealText(answer Answer) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "答案是：%s（%s）\n分类：%s\n", answer.Word.Text, TonePinYin(answer.PinYin), answer.Word.Type)
+	if meaning := glossary.lookup(answer.Word); meaning != "" {
+		fmt.Fprintf(&sb, "释义：%s\n查一下：%s", meaning, searchURL(answer.Word))
+	} else {
+		fmt.Fprintf(&sb, "所以… %[1]s 是什么呢？好吃吗？ 查一下：%[2]s", answer.Word.Text, searchURL(answer.Word))
+	}
+	return sb.String()
+}
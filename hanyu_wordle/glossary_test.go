@@ -0,0 +1,56 @@
+package hanyuwordle
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestTonePinYin(t *testing.T) {
+	cases := []struct {
+		word string
+		want string
+	}{
+		{"银行", "yín háng"},
+		{"觉得", "jué de"},
+		{"绿色", "lǜ sè"},
+		{"贵州", "guì zhōu"},
+		{"牛奶", "niú nǎi"},
+		{"国家", "guó jiā"},
+	}
+	for _, c := range cases {
+		if got := TonePinYin(makePinYin(c.word)); got != c.want {
+			t.Errorf("TonePinYin(%s) = %s, want %s", c.word, got, c.want)
+		}
+	}
+}
+
+func TestGlossaryLookup(t *testing.T) {
+	if meaning := glossary.lookup(Word{Text: "一目了然", Type: "成语"}); meaning == "" {
+		t.Error("lookup(一目了然) is empty")
+	}
+	if meaning := glossary.lookup(Word{Text: "一目了然", Type: "其他"}); meaning == "" {
+		t.Error("lookup should fall back to other glossaries")
+	}
+	if got := searchURL(Word{Text: "初音", Type: "萌娘百科"}); got != "https://zh.moegirl.org.cn/%E5%88%9D%E9%9F%B3" {
+		t.Errorf("searchURL = %s", got)
+	}
+}
+
+func TestGlossaryLookupOrder(t *testing.T) {
+	g := glossaryDict{meanings: make(map[string]map[string]string)}
+	g.once.Do(func() {})
+	g.load(fstest.MapFS{
+		"乙.txt": {Data: []byte("银行\t乙的释义\n")},
+		"甲.txt": {Data: []byte("银行\t甲的释义\n")},
+		"丙.txt": {Data: []byte("银行\t丙的释义\n")},
+	}, ".")
+	if got := g.lookup(Word{Text: "银行", Type: "乙"}); got != "乙的释义" {
+		t.Errorf("lookup in own glossary = %q", got)
+	}
+	// 其他词义表按词典名的顺序查，每次都一样
+	for i := 0; i < 10; i++ {
+		if got := g.lookup(Word{Text: "银行", Type: "其他"}); got != "丙的释义" {
+			t.Fatalf("lookup = %q, want %q", got, "丙的释义")
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package hanyuwordle
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doylecnn/qqbot/log"
+	"github.com/mozillazg/go-pinyin"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+//go:embed pinyin_phrases.txt
+var pinyinPhrasesData string
+
+var pinyinArgs = pinyin.Args{Style: pinyin.Tone3, Heteronym: false}
+
+var rePinYinElements = regexp.MustCompile(`^([bcdfghjklmnpqrstwxyz]|ch|sh|zh|)([aeiouv]+(?:n|ng|)|n|ng|er)(\d?)$`)
+
+type phraseDict struct {
+	phrases   map[string][]string
+	maxLength int
+	mux       sync.RWMutex
+	once      sync.Once
+}
+
+var phrases = phraseDict{phrases: make(map[string][]string)}
+
+func (d *phraseDict) init() {
+	d.once.Do(func() {
+		d.mux.Lock()
+		defer d.mux.Unlock()
+		scanner := bufio.NewScanner(strings.NewReader(pinyinPhrasesData))
+		scanner.Split(bufio.ScanLines)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			fields := strings.SplitN(line, "\t", 2)
+			if len(fields) != 2 {
+				continue
+			}
+			word := strings.TrimSpace(fields[0])
+			syllables := strings.Fields(fields[1])
+			if err := checkSyllables(word, syllables); err != nil {
+				log.Log.WithFields(logrus.Fields{
+					"event":  "Handle Game PinYin Init",
+					"Error":  err,
+					"Phrase": line,
+				}).Warningln("多音字词组读音有误")
+				continue
+			}
+			d.set(word, syllables)
+		}
+		if db == nil {
+			return
+		}
+		rows := []struct {
+			Word   string `db:"word"`
+			PinYin string `db:"pinyin"`
+		}{}
+		if err := db.Select(&rows, `SELECT word, pinyin FROM wordle_pinyin`); err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event": "Handle Game PinYin Init",
+				"call":  "Select",
+				"err":   err,
+			}).Warningln("读取读音修正失败")
+			return
+		}
+		for _, row := range rows {
+			d.set(row.Word, strings.Fields(row.PinYin))
+		}
+	})
+}
+
+// set 调用方需持有写锁
+func (d *phraseDict) set(word string, syllables []string) {
+	d.phrases[word] = syllables
+	if length := len([]rune(word)); length > d.maxLength {
+		d.maxLength = length
+	}
+}
+
+func (d *phraseDict) update(word string, syllables []string) {
+	d.init()
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.set(word, syllables)
+}
+
+// readings 按最长匹配在词里查找多音字词组，没有命中词组的字使用默认读音
+func (d *phraseDict) readings(word string) []string {
+	d.init()
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	runes := []rune(word)
+	result := make([]string, len(runes))
+	for i := 0; i < len(runes); {
+		matched := 0
+		for l := d.maxLength; l > 1; l-- {
+			if i+l > len(runes) {
+				continue
+			}
+			if syllables, exists := d.phrases[string(runes[i:i+l])]; exists {
+				copy(result[i:], syllables)
+				matched = l
+				break
+			}
+		}
+		if matched == 0 {
+			if syllables, exists := d.phrases[string(runes[i])]; exists {
+				result[i] = syllables[0]
+			} else if symbols := pinyin.SinglePinyin(runes[i], pinyinArgs); len(symbols) > 0 {
+				result[i] = symbols[0]
+			}
+			matched = 1
+		}
+		i += matched
+	}
+	return result
+}
+
+func checkSyllables(word string, syllables []string) error {
+	if len(syllables) != len([]rune(word)) {
+		return fmt.Errorf("拼音数量和字数对不上：%s 有 %d 个字，给了 %d 个拼音", word, len([]rune(word)), len(syllables))
+	}
+	for _, s := range syllables {
+		if !rePinYinElements.MatchString(s) {
+			return fmt.Errorf("看不懂这个拼音：%s（声调用数字写在后面，比如 hang2，轻声不写数字）", s)
+		}
+	}
+	return nil
+}
+
+func makePinYin(word string) (result [][4]string) {
+	pinYinSymbols := phrases.readings(word)
+	if len(pinYinSymbols) == len([]rune(word)) {
+		for i, w := range []rune(word) {
+			if rePinYinElements.MatchString(pinYinSymbols[i]) {
+				match := rePinYinElements.FindStringSubmatch(pinYinSymbols[i])
+
+				if match[2] == "n" {
+					match[2] = "en"
+				}
+
+				if match[2] == "ng" {
+					match[2] = "eng"
+				}
+
+				result = append(result, [4]string{string(w), match[1], match[2], match[3]})
+			}
+		}
+	}
+	log.Log.WithFields(logrus.Fields{
+		"event":         "Handle Game MakePinYin",
+		"PinYinSymbols": result,
+	}).Debugln("MakePinYin")
+	return
+}
+
+// PinYin 词的拼音，每个字是 [字, 声母, 韵母, 声调]，读不出来的词返回的长度和字数不同
+func PinYin(word string) [][4]string {
+	return pinYinCache.get(word)
+}
+
+func savePinYin(word string, syllables []string, qq int64) (err error) {
+	if err = checkSyllables(word, syllables); err != nil {
+		return
+	}
+	if db == nil {
+		return errors.New("没有连接数据库，改不了")
+	}
+	_, err = db.NamedExec(`INSERT INTO wordle_pinyin(word, pinyin, qq_number, time) VALUES (:word, :pinyin, :qq, :time)
+	ON CONFLICT(word) DO UPDATE SET pinyin=excluded.pinyin, qq_number=excluded.qq_number, time=excluded.time`,
+		map[string]interface{}{"word": word, "pinyin": strings.Join(syllables, " "), "qq": qq, "time": time.Now().Unix()})
+	if err != nil {
+		return
+	}
+	phrases.update(word, syllables)
+	pinYinCache.reset()
+	return
+}
+
+// PinYinFix 查看或修正词的读音：/handle pinyin 银行 [yin2 hang2]
+func PinYinFix(ctx *zero.Ctx, args []string) {
+	if len(args) == 0 || !reZhongWenWord.MatchString(args[0]) {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("用法：/handle pinyin 词 [拼音…]\n例如：/handle pinyin 银行 yin2 hang2")))
+		return
+	}
+	word := args[0]
+	if len(args) == 1 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("%s 现在读作：%s", word, strings.Join(phrases.readings(word), " ")))))
+		return
+	}
+	syllables := lowerAll(args[1:])
+	// 读音修正对所有群都生效，跟全局屏蔽词一样只有超级用户能直接改
+	if !zero.SuperUserPermission(ctx) {
+		reportPinYin(ctx, word, syllables)
+		return
+	}
+	if err := savePinYin(word, syllables, ctx.Event.UserID); err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event":  "Handle Game PinYin Fix",
+			"Error":  err,
+			"Word":   word,
+			"PinYin": syllables,
+		}).Warningln("修正读音失败")
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err.Error())))
+		return
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("记住啦，%s 读作：%s", word, strings.Join(syllables, " ")))))
+}
+
+func lowerAll(s []string) []string {
+	result := make([]string, len(s))
+	for i, v := range s {
+		result[i] = strings.ToLower(v)
+	}
+	return result
+}
+
+// reportPinYin 不是超级用户的读音修正记成举报，超级用户用 /handle reports 审核
+func reportPinYin(ctx *zero.Ctx, word string, syllables []string) {
+	if err := checkSyllables(word, syllables); err != nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err.Error())))
+		return
+	}
+	if db == nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("修正读音需要超级用户来")))
+		return
+	}
+	_, err := db.Exec(`INSERT INTO wordle_reports(group_number, word, type, reason, qq_number, time, status) VALUES (?, ?, ?, ?, ?, ?, 'pending')`,
+		ctx.Event.GroupID, word, pinYinReportType, strings.Join(syllables, " "), ctx.Event.UserID, time.Now().Unix())
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event":     "Handle Game PinYin Report",
+			"call":      "Exec",
+			"err":       err,
+			"Word":      word,
+			"QQGroupId": ctx.Event.GroupID,
+		}).Warningln("记录读音反馈失败")
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("反馈失败了，稍后再试试")))
+		return
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("收到，超级用户审核后会改成这个读音")))
+}
@@ -0,0 +1,86 @@
+package hanyuwordle
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMakePinYinHeteronym(t *testing.T) {
+	cases := []struct {
+		word string
+		want string
+	}{
+		{"银行", "yin2 hang2"},
+		{"行业", "hang2 ye4"},
+		{"自行车", "zi4 xing2 che1"},
+		{"中国银行", "zhong1 guo2 yin2 hang2"},
+		{"银行行长", "yin2 hang2 hang2 zhang3"},
+		{"重庆", "chong2 qing4"},
+		{"重要", "zhong4 yao4"},
+		{"长大", "zhang3 da4"},
+		{"长城", "chang2 cheng2"},
+		{"音乐", "yin1 yue4"},
+		{"快乐", "kuai4 le4"},
+		{"睡觉", "shui4 jiao4"},
+		{"觉得", "jue2 de"},
+		{"会计", "kuai4 ji4"},
+		{"角色", "jue2 se4"},
+		{"厦门", "xia4 men2"},
+		{"大厦", "da4 sha4"},
+	}
+	for _, c := range cases {
+		t.Run(c.word, func(t *testing.T) {
+			result := makePinYin(c.word)
+			var got []string
+			for _, p := range result {
+				got = append(got, p[1]+p[2]+p[3])
+			}
+			if strings.Join(got, " ") != c.want {
+				t.Errorf("makePinYin(%s) = %v, want %s", c.word, got, c.want)
+			}
+		})
+	}
+}
+
+func TestMakePinYinElements(t *testing.T) {
+	cases := []struct {
+		word string
+		want [][4]string
+	}{
+		{"银行", [][4]string{{"银", "y", "in", "2"}, {"行", "h", "ang", "2"}}},
+		{"重庆", [][4]string{{"重", "ch", "ong", "2"}, {"庆", "q", "ing", "4"}}},
+		{"觉得", [][4]string{{"觉", "j", "ue", "2"}, {"得", "d", "e", ""}}},
+	}
+	for _, c := range cases {
+		t.Run(c.word, func(t *testing.T) {
+			got := makePinYin(c.word)
+			if len(got) != len(c.want) {
+				t.Fatalf("makePinYin(%s) = %v, want %v", c.word, got, c.want)
+			}
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Errorf("makePinYin(%s)[%d] = %v, want %v", c.word, i, got[i], c.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSyllables(t *testing.T) {
+	cases := []struct {
+		word      string
+		syllables []string
+		ok        bool
+	}{
+		{"银行", []string{"yin2", "hang2"}, true},
+		{"觉得", []string{"jue2", "de"}, true},
+		{"银行", []string{"yin2"}, false},
+		{"银行", []string{"yin2", "háng"}, false},
+	}
+	for _, c := range cases {
+		err := checkSyllables(c.word, c.syllables)
+		if (err == nil) != c.ok {
+			t.Errorf("checkSyllables(%s, %v) = %v, want ok=%v", c.word, c.syllables, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package hanyuwordle
+
+import (
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	zero "github.com/wdvxdr1123/ZeroBot"
+)
+
+// Plugin 汉兜，猜测由 gamesession 模块转发，这里只处理指令和每日汉兜
+type Plugin struct{}
+
+func (Plugin) Name() string { return "wordle" }
+
+func (Plugin) Description() string {
+	return "汉兜：/handle 开局，/help 查看更多指令"
+}
+
+func (Plugin) Init(config *toml.Tree, db *sqlx.DB) error {
+	Init(db, config)
+	return nil
+}
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "handle", Usage: "/handle [easy|normal|hard]", Description: "开一局汉兜，直接发四字词语猜，每次猜完会提示字、声母、韵母和声调对不对", Examples: []string{"/handle", "/handle easy", "/handle 一目了然"}},
+		{Name: "handle daily", Usage: "/handle daily", Description: "每日汉兜，每人每天一题，在私聊里猜，成绩算在开局的群"},
+		{Name: "handle race", Usage: "/handle race", Description: "汉兜比赛，/handle join 报名，/handle go 开始"},
+		{Name: "handle board", Usage: "/handle board [full]", Description: "再看一次当前的棋盘，full 是完整记录"},
+		{Name: "handle review", Usage: "/handle review", Description: "复盘上一局，看每一步排除了多少候选词"},
+		{Name: "handle suggest", Usage: "/handle suggest", Description: "练习时提示下一步猜什么", PrivateOnly: true},
+		{Name: "handle report", Usage: "/handle report [词] [原因]", Description: "举报不合适的答案"},
+		{Name: "handle theme", Usage: "/handle theme default|dark|colorblind", Description: "切换本群的配色", Permission: plugin.Admin},
+		{Name: "handle block", Usage: "/handle block|unblock 词 [global]", Description: "屏蔽或者解除屏蔽答案", Permission: plugin.Admin},
+		{Name: "handle reports", Usage: "/handle reports [approve|reject 编号]", Description: "审核本群的举报，读音反馈对所有群生效，只有超级用户能审", Permission: plugin.Admin},
+		{Name: "stop", Usage: "/stop", Description: "结束本轮汉兜，说“太难了”“放弃”也可以"},
+	}
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnCommand("handle").Handle(GameStart)
+	engine.OnCommand("stop").Handle(GameStop)
+	engine.OnRegex(`^\p{Han}+$`).Handle(OnGuess)
+	engine.OnFullMatchGroup([]string{"太难了", "放弃"}).Handle(GameStop)
+}
+
+func (Plugin) Shutdown() {}
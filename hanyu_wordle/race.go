@@ -0,0 +1,285 @@
+package hanyuwordle
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gamesession "github.com/doylecnn/qqbot/game_session"
+	"github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	raceName      = "汉兜比赛"
+	raceTimeLimit = 10 * time.Minute
+	// raceSignupLimit 报名这么久还没开始就取消
+	raceSignupLimit = 5 * time.Minute
+)
+
+type raceTeam struct {
+	Name     string
+	Members  map[int64]string
+	Board    *Game
+	Solved   bool
+	SolvedIn time.Duration
+}
+
+// score 猜中得 100 分，猜的次数越少、用时越短加分越多
+func (t *raceTeam) score() int {
+	if !t.Solved {
+		return 0
+	}
+	score := 100
+	if bonus := 50 - 5*(t.Board.Count-1); bonus > 0 {
+		score += bonus
+	}
+	if bonus := 50 - int(t.SolvedIn.Seconds())/12; bonus > 0 {
+		score += bonus
+	}
+	return score
+}
+
+// race 比赛分报名和进行两个阶段，由 gamesession 加锁
+type race struct {
+	Running   bool
+	Length    int
+	Creator   int64
+	Answer    Answer
+	Teams     map[string]*raceTeam
+	players   map[int64]*raceTeam
+	StartTime time.Time
+	// timer 报名阶段是报名期限，开始后是比赛时间限制
+	timer *time.Timer
+}
+
+// raceOf 当前聊天正在进行的比赛
+func raceOf(ctx *zero.Ctx) (*gamesession.Session, *race, bool) {
+	s, exists := gamesession.Sessions.Get(ctx)
+	if !exists {
+		return nil, nil, false
+	}
+	game, ok := s.Game.(*race)
+	return s, game, ok
+}
+
+// RaceCommand 比赛模式：/handle race [长度] 开始报名
+func RaceCommand(ctx *zero.Ctx, args []string) {
+	if ctx.Event.GroupID == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("比赛只能在群里玩")))
+		return
+	}
+	length := 4
+	if len(args) > 0 {
+		var err error
+		if length, err = strconv.Atoi(args[0]); err != nil || length < 2 || length > 9 {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("长度要在 2 到 9 之间")))
+			return
+		}
+	}
+	game := &race{
+		Length:  length,
+		Creator: ctx.Event.UserID,
+		Teams:   make(map[string]*raceTeam),
+		players: make(map[int64]*raceTeam),
+	}
+	if _, err := gamesession.Sessions.Start(ctx, raceName, game, 0); err != nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err.Error())))
+	}
+}
+
+func (game *race) Start(ctx *zero.Ctx, s *gamesession.Session) {
+	game.timer = time.AfterFunc(raceSignupLimit, func() {
+		s.Do(func() {
+			if game.Running {
+				return
+			}
+			s.End()
+			ctx.Send(message.Text(fmt.Sprintf("报名 %d 分钟了还没开始，比赛取消了", int(raceSignupLimit.Minutes()))))
+		})
+	})
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("%d 字汉兜比赛开始报名，%d 分钟内不开始就取消\n/handle join [队名] 加入，不写队名就是单人参赛\n/handle go 开始比赛，每队各猜各的，同一个答案", game.Length, int(raceSignupLimit.Minutes())))))
+}
+
+// RaceJoin 报名参加比赛：/handle join [队名]
+func RaceJoin(ctx *zero.Ctx, args []string) {
+	s, game, exists := raceOf(ctx)
+	if !exists {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("现在没有比赛，/handle race 开一场")))
+		return
+	}
+	s.Do(func() {
+		if game.Running {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("比赛已经开始了，下一场吧")))
+			return
+		}
+		name := ctx.Event.Sender.Name()
+		if len(args) > 0 {
+			name = args[0]
+		}
+		if old, exists := game.players[ctx.Event.UserID]; exists {
+			delete(old.Members, ctx.Event.UserID)
+			if len(old.Members) == 0 {
+				delete(game.Teams, old.Name)
+			}
+		}
+		team, exists := game.Teams[name]
+		if !exists {
+			team = &raceTeam{Name: name, Members: make(map[int64]string)}
+			game.Teams[name] = team
+		}
+		team.Members[ctx.Event.UserID] = ctx.Event.Sender.Name()
+		game.players[ctx.Event.UserID] = team
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("加入了 %s，现在有 %d 队", name, len(game.Teams)))))
+	})
+}
+
+// RaceGo 开始比赛：/handle go，只有开比赛的人或者管理员可以开始
+func RaceGo(ctx *zero.Ctx, args []string) {
+	s, game, exists := raceOf(ctx)
+	if !exists {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("现在没有比赛，/handle race 开一场")))
+		return
+	}
+	s.Do(func() {
+		if game.Running {
+			return
+		}
+		if game.Creator != ctx.Event.UserID && !plugin.GroupAdmin(ctx) {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("只有开比赛的人或者管理员可以开始")))
+			return
+		}
+		if len(game.Teams) < 2 {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("至少要两队才能比赛")))
+			return
+		}
+		dictOnce.Do(wordleDictionaryInit)
+		candidates := answerCandidates(ctx.Event.GroupID, game.Length, "")
+		if len(candidates) == 0 {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("非常不巧，词典里没有这个长度的词……")))
+			return
+		}
+		answer := candidates[rand.Intn(len(candidates))]
+		game.Answer = Answer{Word: answer, PinYin: makePinYin(answer.Text)}
+		for _, team := range game.Teams {
+			team.Board = &Game{Status: Start, Answer: game.Answer, guesses: make(map[string]Guess)}
+		}
+		game.timer.Stop()
+		game.Running = true
+		game.StartTime = time.Now()
+		game.timer = time.AfterFunc(raceTimeLimit, func() {
+			s.Do(func() {
+				game.finish(s)
+				ctx.Send(message.Text("比赛时间到！\n" + game.result()))
+			})
+		})
+		log.Log.WithFields(logrus.Fields{
+			"event":     "Handle Game Race Start",
+			"Answer":    game.Answer.Word,
+			"Teams":     len(game.Teams),
+			"QQGroupId": ctx.Event.GroupID,
+		}).Infoln("比赛开始")
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("比赛开始！%d 字，限时 %d 分钟，直接发词来猜，每队各猜各的，格子都发在群里", game.Length, int(raceTimeLimit.Minutes())))))
+	})
+}
+
+// finish 结束比赛，每个队员都记上队伍的得分，调用方需持有 Session 锁
+func (game *race) finish(s *gamesession.Session) {
+	if game.timer != nil {
+		game.timer.Stop()
+	}
+	for _, team := range game.Teams {
+		if team.Solved {
+			for userID, name := range team.Members {
+				s.AddScore(userID, name, team.score())
+			}
+		}
+	}
+	s.End()
+}
+
+func (game *race) result() string {
+	teams := make([]*raceTeam, 0, len(game.Teams))
+	for _, team := range game.Teams {
+		teams = append(teams, team)
+	}
+	sort.Slice(teams, func(i, j int) bool {
+		return teams[i].score() > teams[j].score()
+	})
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "答案是：%s\n", game.Answer.Word.Text)
+	for i, team := range teams {
+		if team.Solved {
+			fmt.Fprintf(&sb, "%d. %s  %d 分（%d 次，%s）\n", i+1, team.Name, team.score(), team.Board.Count, team.SolvedIn.Round(time.Second))
+		} else {
+			fmt.Fprintf(&sb, "%d. %s  没猜出来（%d 次）\n", i+1, team.Name, team.Board.Count)
+		}
+	}
+	if len(teams) > 0 && teams[0].Solved {
+		fmt.Fprintf(&sb, "恭喜 %s 获胜！", teams[0].Name)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// Input 比赛中的猜测，只有报了名的人猜的才算
+func (game *race) Input(ctx *zero.Ctx, s *gamesession.Session) bool {
+	team, joined := game.players[ctx.Event.UserID]
+	if !game.Running || !joined {
+		return false
+	}
+	msg := strings.TrimSpace(ctx.MessageString())
+	if len([]rune(msg)) != game.Length || team.Solved {
+		return false
+	}
+	if _, exists := team.Board.guesses[msg]; exists {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("你们队已经猜过这个词啦")))
+		return true
+	}
+	guessPinYin := makePinYin(msg)
+	if len(guessPinYin) == 0 {
+		return false
+	}
+	board, _ := guess(team.Board, ctx, msg, guessPinYin, game.Answer.PinYin)
+	if msg != game.Answer.Word.Text {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, board, message.Text(fmt.Sprintf("%s 第 %d 次", team.Name, team.Board.Count))))
+		return true
+	}
+	team.Solved = true
+	team.SolvedIn = time.Since(game.StartTime)
+	team.Board.Status = End
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, board, message.Text(fmt.Sprintf("%s 猜对啦！用了 %d 次，%s", team.Name, team.Board.Count, team.SolvedIn.Round(time.Second)))))
+	for _, t := range game.Teams {
+		if !t.Solved {
+			return true
+		}
+	}
+	game.finish(s)
+	ctx.Send(message.Text("所有队伍都猜出来了！\n" + game.result()))
+	return true
+}
+
+// Timeout 比赛不按空闲计时，时间限制由 game.timer 负责
+func (game *race) Timeout(ctx *zero.Ctx, s *gamesession.Session) bool {
+	return true
+}
+
+// Stop 只有开比赛的人或者管理员可以结束
+func (game *race) Stop(ctx *zero.Ctx, s *gamesession.Session) bool {
+	if game.Creator != ctx.Event.UserID && !plugin.GroupAdmin(ctx) {
+		return false
+	}
+	if !game.Running {
+		game.timer.Stop()
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("比赛取消了")))
+		return true
+	}
+	game.finish(s)
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("比赛结束\n"+game.result())))
+	return true
+}
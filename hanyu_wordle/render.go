@@ -0,0 +1,447 @@
+package hanyuwordle
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	groupsettings "github.com/doylecnn/qqbot/group_settings"
+	"github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/doylecnn/qqbot/render"
+	"github.com/fogleman/gg"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomedium"
+)
+
+// BoardRenderer 把一局游戏画成可以发送的消息
+type BoardRenderer interface {
+	// Render 只画最近几次猜测，更早的汇总成一行，猜多少次图片都不会太大
+	Render(game *Game) (message.MessageSegment, error)
+	// RenderFull 完整的猜测记录，太长时分成多张
+	RenderFull(game *Game) (message.Message, error)
+}
+
+// Theme 棋盘配色，下标对应标记：0 不对，1 位置不对，2 对
+type Theme struct {
+	Name       string
+	Background string
+	// 格子背景和汉字颜色，按整个字的标记
+	CellBackground [3]string
+	CellText       [3]string
+	// 拼音元素颜色，先按整个字的标记，再按拼音元素的标记
+	PartText [3][3]string
+	// 键盘上已知拼音元素的背景色，文字统一用 KeyText
+	KeyBackground [3]string
+	KeyText       string
+	// 键盘上还没猜过的拼音元素
+	KeyUnknownBackground string
+	KeyUnknownShadow     string
+	KeyUnknownText       string
+}
+
+var themes = map[string]Theme{
+	"default": {
+		Name:           "default",
+		Background:     "#ffffff",
+		CellBackground: [3]string{"#f7f8f9", "#f7f8f9", "#1d9c9c"},
+		CellText:       [3]string{"#5d6572", "#de7525", "#ffffff"},
+		PartText: [3][3]string{
+			{"#b4b8be", "#de7525", "#1d9c9c"},
+			{"#b4b8be", "#de7525", "#1d9c9c"},
+			{"#5d6572", "#de7525", "#ffffff"},
+		},
+		KeyBackground:        [3]string{"#5d6572", "#de7525", "#1d9c9c"},
+		KeyText:              "#ffffff",
+		KeyUnknownBackground: "#ffffff",
+		KeyUnknownShadow:     "#5d6572",
+		KeyUnknownText:       "#5d6572",
+	},
+	"dark": {
+		Name:           "dark",
+		Background:     "#121213",
+		CellBackground: [3]string{"#2a2b2e", "#2a2b2e", "#1d9c9c"},
+		CellText:       [3]string{"#c9cdd3", "#f08c3c", "#ffffff"},
+		PartText: [3][3]string{
+			{"#6b7079", "#f08c3c", "#2bbcbc"},
+			{"#6b7079", "#f08c3c", "#2bbcbc"},
+			{"#0e4a4a", "#f08c3c", "#ffffff"},
+		},
+		KeyBackground:        [3]string{"#3a3c40", "#de7525", "#1d9c9c"},
+		KeyText:              "#ffffff",
+		KeyUnknownBackground: "#818384",
+		KeyUnknownShadow:     "#3a3c40",
+		KeyUnknownText:       "#ffffff",
+	},
+	// 橙色表示对、蓝色表示位置不对，红绿色弱也能分清
+	"colorblind": {
+		Name:           "colorblind",
+		Background:     "#ffffff",
+		CellBackground: [3]string{"#f7f8f9", "#f7f8f9", "#f5793a"},
+		CellText:       [3]string{"#5d6572", "#3b82c4", "#ffffff"},
+		PartText: [3][3]string{
+			{"#b4b8be", "#3b82c4", "#f5793a"},
+			{"#b4b8be", "#3b82c4", "#f5793a"},
+			{"#7a3510", "#3b82c4", "#ffffff"},
+		},
+		KeyBackground:        [3]string{"#5d6572", "#3b82c4", "#f5793a"},
+		KeyText:              "#ffffff",
+		KeyUnknownBackground: "#ffffff",
+		KeyUnknownShadow:     "#5d6572",
+		KeyUnknownText:       "#5d6572",
+	},
+}
+
+// Fonts 字体文件路径，为空时使用内置的 Go 字体（不含汉字）
+type Fonts struct {
+	Han   string
+	Latin string
+}
+
+type boardLayout struct {
+	CellSize      int
+	Gap           int
+	RowsPerColumn int
+	// RecentRows 平时只画最近这么多次猜测，0 表示不限
+	RecentRows int
+	// PageColumns 完整记录每张图最多几列
+	PageColumns int
+	KeyWidth    int
+	KeyHeight   int
+	Keyboard    []string
+}
+
+var defaultLayout = boardLayout{
+	CellSize:      96,
+	Gap:           8,
+	RowsPerColumn: 16,
+	RecentRows:    10,
+	PageColumns:   2,
+	KeyWidth:      48,
+	KeyHeight:     24,
+	Keyboard: []string{
+		"b", "c", "ch", "d", "f", "g", "h", "j", "k", "l", "m", "n", "p", "q", "r", "s", "sh", "t", "w", "x", "y", "z", "zh",
+		"",
+		"a", "ai", "an", "ang", "ao",
+		"e", "ei", "en", "eng", "er",
+		"i", "ia", "ian", "iang", "iao", "ie", "in", "ing", "iong", "iu",
+		"o", "ong", "ou",
+		"u", "ua", "uai", "uan", "uang", "ue", "ui", "un", "uo",
+		"v", "ve",
+	},
+}
+
+type imageRenderer struct {
+	theme  Theme
+	fonts  Fonts
+	layout boardLayout
+}
+
+func newImageRenderer(theme Theme, fonts Fonts) *imageRenderer {
+	return &imageRenderer{theme: theme, fonts: fonts, layout: defaultLayout}
+}
+
+func (r *imageRenderer) Render(game *Game) (message.MessageSegment, error) {
+	img, err := r.Draw(game)
+	if err != nil {
+		return message.MessageSegment{}, err
+	}
+	return render.EncodePNG(img)
+}
+
+func (r *imageRenderer) RenderFull(game *Game) (message.Message, error) {
+	images, err := r.DrawFull(game)
+	if err != nil {
+		return nil, err
+	}
+	msg := make(message.Message, 0, len(images))
+	for _, img := range images {
+		seg, err := render.EncodePNG(img)
+		if err != nil {
+			return nil, err
+		}
+		msg = append(msg, seg)
+	}
+	return msg, nil
+}
+
+// Draw 画最近 RecentRows 次猜测和键盘，更早的猜测汇总成一行放在最前面
+func (r *imageRenderer) Draw(game *Game) (image.Image, error) {
+	guesses := game.GuessList
+	summary := false
+	if n := len(guesses); r.layout.RecentRows > 0 && n > r.layout.RecentRows {
+		guesses = guesses[n-r.layout.RecentRows:]
+		summary = true
+	}
+	return r.draw(game, guesses, summary, true)
+}
+
+// DrawFull 画全部猜测，每张最多 PageColumns 列，不画键盘
+func (r *imageRenderer) DrawFull(game *Game) ([]image.Image, error) {
+	pageSize := r.layout.RowsPerColumn * r.layout.PageColumns
+	var images []image.Image
+	for start := 0; start < len(game.GuessList) || start == 0; start += pageSize {
+		end := start + pageSize
+		if end > len(game.GuessList) {
+			end = len(game.GuessList)
+		}
+		img, err := r.draw(game, game.GuessList[start:end], false, false)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// summaryCell 汇总每个位置已经确定的字和拼音元素
+type summaryCell struct {
+	Char  string
+	Parts [3]string
+	// Found 字已经猜对了
+	Found bool
+}
+
+func summarize(game *Game, size int) []summaryCell {
+	cells := make([]summaryCell, size)
+	for _, guess := range game.GuessList {
+		for i := 0; i < size && i < len(guess.PinYin); i++ {
+			if guess.Tag[0][i] == '2' {
+				cells[i] = summaryCell{Char: guess.PinYin[i][0], Parts: [3]string{guess.PinYin[i][1], guess.PinYin[i][2], guess.PinYin[i][3]}, Found: true}
+				continue
+			}
+			if cells[i].Found {
+				continue
+			}
+			for j := 1; j <= 3; j++ {
+				if guess.Tag[j][i] == '2' {
+					cells[i].Parts[j-1] = guess.PinYin[i][j]
+				}
+			}
+		}
+	}
+	return cells
+}
+
+type faces struct {
+	han, part, smallPart, key font.Face
+}
+
+func (r *imageRenderer) loadFaces() (*faces, error) {
+	var f faces
+	var err error
+	if f.han, err = render.LoadFontFace(r.fonts.Han, gobold.TTF, 52); err != nil {
+		return nil, err
+	}
+	if f.part, err = render.LoadFontFace(r.fonts.Latin, gomedium.TTF, 22); err != nil {
+		return nil, err
+	}
+	if f.smallPart, err = render.LoadFontFace(r.fonts.Latin, gomedium.TTF, 18); err != nil {
+		return nil, err
+	}
+	if f.key, err = render.LoadFontFace(r.fonts.Latin, gomedium.TTF, 15); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (f *faces) Close() {
+	for _, face := range []font.Face{f.han, f.part, f.smallPart, f.key} {
+		if face != nil {
+			face.Close()
+		}
+	}
+}
+
+// drawCell 画一个字的格子，tags 依次是整个字、声母、韵母、声调的标记
+func (r *imageRenderer) drawCell(dc *gg.Context, f *faces, x, y float64, char string, parts [3]string, tags [4]int) {
+	theme := r.theme
+	cell := float64(r.layout.CellSize)
+	pinyin1 := strings.ToUpper(parts[0])
+	pinyin2 := strings.ToUpper(parts[1])
+	pinyin3 := parts[2]
+
+	dc.SetHexColor(theme.CellBackground[tags[0]])
+	dc.DrawRectangle(x+2, y+2, cell-2, cell-2)
+	dc.Fill()
+
+	dc.SetHexColor(theme.CellText[tags[0]])
+	dc.SetFontFace(f.han)
+	dc.DrawStringAnchored(char, x+cell/2, y+cell*5/8, 0.5, 0.5)
+
+	if len(pinyin1+pinyin2+pinyin3) <= 6 {
+		dc.SetFontFace(f.part)
+	} else {
+		dc.SetFontFace(f.smallPart)
+	}
+	w1, _ := dc.MeasureString(pinyin1)
+	w2, _ := dc.MeasureString(pinyin2)
+	w3, _ := dc.MeasureString(pinyin3)
+	w1 /= 2
+	w2 /= 2
+	w3 /= 2
+
+	colors := theme.PartText[tags[0]]
+	dc.SetHexColor(colors[tags[1]])
+	dc.DrawStringAnchored(pinyin1, x+cell/2-w2-w3, y+20, 0.5, 0.5)
+	dc.SetHexColor(colors[tags[2]])
+	dc.DrawStringAnchored(pinyin2, x+cell/2+w1-w3, y+20, 0.5, 0.5)
+	dc.SetHexColor(colors[tags[3]])
+	dc.DrawStringAnchored(pinyin3, x+cell/2+w1+w2, y+20, 0.5, 0.5)
+}
+
+// draw 画一张图：summary 为真时第一行是汇总，keyboard 为真时最后画键盘
+func (r *imageRenderer) draw(game *Game, guesses []Guess, summary, keyboard bool) (image.Image, error) {
+	theme, layout := r.theme, r.layout
+	cell := float64(layout.CellSize)
+	keyW, keyH := float64(layout.KeyWidth), float64(layout.KeyHeight)
+	columnHeight := cell * float64(layout.RowsPerColumn)
+	size := len([]rune(game.Answer.Word.Text))
+	realTotal := float64(len(guesses))
+	if summary {
+		realTotal++
+	}
+	if keyboard {
+		keyboardRows := math.Ceil(float64(len(layout.Keyboard)) / float64(size*2))
+		realTotal += keyboardRows * keyH / cell
+	}
+	if realTotal == 0 {
+		realTotal = 1
+	}
+	width := (layout.CellSize*size+layout.Gap)*int(math.Ceil(realTotal/float64(layout.RowsPerColumn))) - layout.Gap
+	height := int(math.Ceil(cell * math.Min(realTotal, float64(layout.RowsPerColumn))))
+	log.Log.WithFields(logrus.Fields{
+		"event":  "Handle Game Draw Image",
+		"Theme":  theme.Name,
+		"Width":  width,
+		"Height": height,
+	}).Debugln("Draw Image")
+
+	f, err := r.loadFaces()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dc := gg.NewContext(width, height)
+	dc.SetHexColor(theme.Background)
+	dc.Clear()
+	left := 0.0
+	top := 0.0
+	nextRow := func() {
+		top += cell
+		if top == columnHeight {
+			left += cell*float64(size) + float64(layout.Gap)
+			top = 0
+		}
+	}
+	if summary {
+		// 汇总行：猜对的字照常画，没猜对的位置画问号和已经确定的拼音元素
+		for i, c := range summarize(game, size) {
+			tags := [4]int{0, 2, 2, 2}
+			char := "?"
+			if c.Found {
+				tags[0] = 2
+				char = c.Char
+			}
+			r.drawCell(dc, f, left+float64(i)*cell, top, char, c.Parts, tags)
+		}
+		nextRow()
+	}
+	for _, guess := range guesses {
+		for i := 0; i < size; i++ {
+			tags := [4]int{int(guess.Tag[0][i] - '0'), int(guess.Tag[1][i] - '0'), int(guess.Tag[2][i] - '0'), int(guess.Tag[3][i] - '0')}
+			r.drawCell(dc, f, left+float64(i)*cell, top, guess.PinYin[i][0], [3]string{guess.PinYin[i][1], guess.PinYin[i][2], guess.PinYin[i][3]}, tags)
+		}
+		nextRow()
+	}
+	if !keyboard {
+		return dc.Image(), nil
+	}
+
+	best := knownParts(game)
+	for i, v := range layout.Keyboard {
+		j := float64(i % (size * 2))
+		k := math.Floor(float64(i) / float64(size*2))
+
+		if top+k*keyH == columnHeight {
+			left += cell*float64(size) + float64(layout.Gap)
+			top = -k * keyH
+		}
+
+		if len(v) == 0 {
+			continue
+		}
+		if len(v) <= 3 {
+			dc.SetFontFace(f.smallPart)
+		} else {
+			dc.SetFontFace(f.key)
+		}
+
+		x, y := left+j*keyW, top+k*keyH
+		if tag, exists := best[v]; exists {
+			dc.SetHexColor(theme.KeyBackground[tag])
+			dc.DrawRectangle(x+1, y+1, keyW-2, keyH-2)
+			dc.Fill()
+			dc.SetHexColor(theme.KeyText)
+		} else {
+			dc.SetHexColor(theme.KeyUnknownShadow)
+			dc.DrawRectangle(x+2, y+2, keyW-2, keyH-2)
+			dc.Fill()
+			dc.SetHexColor(theme.KeyUnknownBackground)
+			dc.DrawRectangle(x+1, y+1, keyW-2, keyH-2)
+			dc.Fill()
+			dc.SetHexColor(theme.KeyUnknownText)
+		}
+		dc.DrawStringAnchored(strings.ToUpper(v), x+keyW/2, y+keyH/2, 0.5, 0.5)
+	}
+	return dc.Image(), nil
+}
+
+type textRenderer struct{}
+
+func (textRenderer) Render(game *Game) (message.MessageSegment, error) {
+	return message.Text(drawTextBoard(game, defaultLayout.RecentRows)), nil
+}
+
+func (textRenderer) RenderFull(game *Game) (message.Message, error) {
+	return message.Message{message.Text(drawTextBoard(game, 0))}, nil
+}
+
+func groupRenderer(groupID int64) BoardRenderer {
+	if groupsettings.Get(groupID, boardSettingKey, boardStyleImage) == boardStyleText {
+		return textRenderer{}
+	}
+	theme, exists := themes[groupsettings.Get(groupID, themeSettingKey, "default")]
+	if !exists {
+		theme = themes["default"]
+	}
+	return newImageRenderer(theme, Fonts{Han: render.HanFont, Latin: render.LatinFont})
+}
+
+// BoardTheme 切换本群的棋盘配色：/handle theme default|dark|colorblind
+func BoardTheme(ctx *zero.Ctx, args []string) {
+	if len(args) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("当前配色：%s\n用法：/handle theme default|dark|colorblind", groupsettings.Get(ctx.Event.GroupID, themeSettingKey, "default")))))
+		return
+	}
+	if !plugin.GroupAdmin(ctx) {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("只有管理员可以切换配色")))
+		return
+	}
+	name := strings.ToLower(args[0])
+	if _, exists := themes[name]; !exists {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("没有这个配色，可选：default、dark、colorblind")))
+		return
+	}
+	if err := groupsettings.Set(ctx.Event.GroupID, themeSettingKey, name); err != nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err.Error())))
+		return
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("配色已切换为："+name)))
+}
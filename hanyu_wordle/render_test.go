@@ -0,0 +1,157 @@
+package hanyuwordle
+
+import (
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden images in testdata")
+
+// testFonts 测试环境不一定有中文字体，用 testdata 里只有测试用字的字体，拼音用内置的 Go 字体。
+// 字体由 testdata/genfont.go 生成
+var testFonts = Fonts{Han: filepath.Join("testdata", "hantest.ttf")}
+
+func newTestGame(answer string, words ...string) *Game {
+	game := &Game{Status: Start, guesses: make(map[string]Guess)}
+	game.Answer = Answer{Word: Word{Text: answer, Type: "测试"}, PinYin: makePinYin(answer)}
+	for _, w := range words {
+		guessPinYin := makePinYin(w)
+		guess := Guess{UserName: "tester", Word: w, PinYin: guessPinYin, Tag: pinYinMatch(guessPinYin, game.Answer.PinYin)}
+		game.GuessList = append(game.GuessList, guess)
+		game.guesses[w] = guess
+		game.Count++
+	}
+	return game
+}
+
+func TestImageRendererGolden(t *testing.T) {
+	game := newTestGame("银行", "音乐", "重庆", "银河", "银行")
+	for name, theme := range themes {
+		t.Run(name, func(t *testing.T) {
+			img, err := newImageRenderer(theme, testFonts).Draw(game)
+			if err != nil {
+				t.Fatal(err)
+			}
+			goldenPath := filepath.Join("testdata", "board_"+name+".png")
+			if *updateGolden {
+				f, err := os.Create(goldenPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				if err = png.Encode(f, img); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			f, err := os.Open(goldenPath)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			defer f.Close()
+			golden, err := png.Decode(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareImages(t, img, golden)
+		})
+	}
+}
+
+// compareImages 允许极少量像素有细微差别，不同平台的浮点运算会让抗锯齿边缘略有不同
+func compareImages(t *testing.T, got, want image.Image) {
+	t.Helper()
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("image bounds = %v, want %v", got.Bounds(), want.Bounds())
+	}
+	bounds := got.Bounds()
+	diff := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, a1 := got.At(x, y).RGBA()
+			r2, g2, b2, a2 := want.At(x, y).RGBA()
+			if absDiff(r1, r2) > 0x800 || absDiff(g1, g2) > 0x800 || absDiff(b1, b2) > 0x800 || absDiff(a1, a2) > 0x800 {
+				diff++
+			}
+		}
+	}
+	if limit := bounds.Dx() * bounds.Dy() / 1000; diff > limit {
+		t.Errorf("%d pixels differ from golden image, limit %d", diff, limit)
+	}
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// longGame 猜了 n 次还没猜中的一局，词轮流用
+func longGame(n int) *Game {
+	words := []string{"音乐", "重庆", "银河", "长大", "快乐", "睡觉", "会计", "角色", "厦门", "大厦", "行业", "空调", "出差", "人参", "着急", "主角", "薄荷"}
+	game := newTestGame("银行", words...)
+	for len(game.GuessList) < n {
+		game.GuessList = append(game.GuessList, game.GuessList[len(game.GuessList)%len(words)])
+		game.Count++
+	}
+	game.GuessList = game.GuessList[:n]
+	game.Count = n
+	return game
+}
+
+func TestImageRendererRecentRows(t *testing.T) {
+	for _, n := range []int{17, 60} {
+		img, err := newImageRenderer(themes["default"], Fonts{}).Draw(longGame(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 最近 10 次、一行汇总、15 行键盘，一列就放得下
+		if got, want := img.Bounds().Dx(), 96*2; got != want {
+			t.Errorf("%d guesses: width = %d, want %d", n, got, want)
+		}
+		if got, want := img.Bounds().Dy(), 96*11+15*24; got != want {
+			t.Errorf("%d guesses: height = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestImageRendererFullPages(t *testing.T) {
+	r := newImageRenderer(themes["default"], Fonts{})
+	images, err := r.DrawFull(longGame(17))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 {
+		t.Fatalf("17 guesses: %d pages, want 1", len(images))
+	}
+	if got, want := images[0].Bounds().Size(), image.Pt(2*(96*2+8)-8, 96*16); got != want {
+		t.Errorf("17 guesses: size = %v, want %v", got, want)
+	}
+	images, err = r.DrawFull(longGame(40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("40 guesses: %d pages, want 2", len(images))
+	}
+	if got, want := images[1].Bounds().Size(), image.Pt(96*2, 96*8); got != want {
+		t.Errorf("40 guesses: last page size = %v, want %v", got, want)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	// 银河猜对了“银”，“河”的声母和声调对了，重庆什么都没对上
+	game := newTestGame("银行", "重庆", "银河")
+	cells := summarize(game, 2)
+	if !cells[0].Found || cells[0].Char != "银" {
+		t.Errorf("cells[0] = %+v", cells[0])
+	}
+	if cells[1].Found || cells[1].Parts[0] != "h" || cells[1].Parts[2] != "2" {
+		t.Errorf("cells[1] = %+v", cells[1])
+	}
+}
@@ -0,0 +1,7 @@
+package hanyuwordle
+
+// 本群的汉兜设置存在 groupsettings 里，/settings 能看到
+const (
+	boardSettingKey = "wordle.board"
+	themeSettingKey = "wordle.theme"
+)
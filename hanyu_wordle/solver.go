@@ -0,0 +1,220 @@
+package hanyuwordle
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	gamesession "github.com/doylecnn/qqbot/game_session"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// 词典很大的时候只抽一部分来估算，否则每一步都是平方级的计算量
+const (
+	solverMaxProbes  = 100
+	solverMaxTargets = 500
+)
+
+type pinYinCacheMap struct {
+	words map[string][][4]string
+	mux   sync.RWMutex
+}
+
+// pinYinCache 分析时每个候选词都要转拼音，缓存起来；修正读音后清空
+var pinYinCache = pinYinCacheMap{words: make(map[string][][4]string)}
+
+func (c *pinYinCacheMap) get(word string) [][4]string {
+	c.mux.RLock()
+	result, exists := c.words[word]
+	c.mux.RUnlock()
+	if exists {
+		return result
+	}
+	result = makePinYin(word)
+	c.mux.Lock()
+	c.words[word] = result
+	c.mux.Unlock()
+	return result
+}
+
+func (c *pinYinCacheMap) reset() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.words = make(map[string][][4]string)
+}
+
+type solverWord struct {
+	Text   string
+	PinYin [][4]string
+}
+
+// candidatePool 玩家眼里所有可能的答案，不按难度筛选
+func candidatePool(groupID int64, length int) (pool []solverWord) {
+	dictOnce.Do(wordleDictionaryInit)
+	seen := make(map[string]bool)
+	for _, w := range answerCandidates(groupID, length, "") {
+		if seen[w.Text] {
+			continue
+		}
+		seen[w.Text] = true
+		if py := pinYinCache.get(w.Text); len(py) == length {
+			pool = append(pool, solverWord{Text: w.Text, PinYin: py})
+		}
+	}
+	return
+}
+
+// filterCandidates 留下和这次猜测的结果相符的候选词
+func filterCandidates(candidates []solverWord, g Guess) (result []solverWord) {
+	for _, c := range candidates {
+		if len(c.PinYin) == len(g.PinYin) && pinYinMatch(g.PinYin, c.PinYin) == g.Tag {
+			result = append(result, c)
+		}
+	}
+	return
+}
+
+func sampleWords(words []solverWord, n int) []solverWord {
+	if len(words) <= n {
+		return words
+	}
+	step := float64(len(words)) / float64(n)
+	result := make([]solverWord, 0, n)
+	for i := 0; i < n; i++ {
+		result = append(result, words[int(float64(i)*step)])
+	}
+	return result
+}
+
+// expectedInfo 猜这个词能得到的期望信息量（bit），即各种结果分布的熵
+func expectedInfo(guessPinYin [][4]string, targets []solverWord) float64 {
+	if len(targets) == 0 {
+		return 0
+	}
+	patterns := make(map[[4]string]int)
+	for _, t := range targets {
+		patterns[pinYinMatch(guessPinYin, t.PinYin)]++
+	}
+	info := 0.0
+	for _, count := range patterns {
+		p := float64(count) / float64(len(targets))
+		info -= p * math.Log2(p)
+	}
+	return info
+}
+
+// bestGuess 在剩下的候选词里找期望信息量最大的词
+func bestGuess(candidates []solverWord) (best solverWord, info float64) {
+	if len(candidates) == 0 {
+		return
+	}
+	best = candidates[0]
+	if len(candidates) == 1 {
+		return
+	}
+	targets := sampleWords(candidates, solverMaxTargets)
+	for _, probe := range sampleWords(candidates, solverMaxProbes) {
+		if i := expectedInfo(probe.PinYin, targets); i > info {
+			best, info = probe, i
+		}
+	}
+	return
+}
+
+type reviewStep struct {
+	Guess    Guess
+	Before   int
+	After    int
+	Expected float64
+	Best     solverWord
+	BestInfo float64
+}
+
+// analyze 逐步重放猜测，记录每一步前后的候选词数量和当时的最佳猜测
+func analyze(guesses []Guess, groupID int64, length int) (steps []reviewStep) {
+	candidates := candidatePool(groupID, length)
+	for _, g := range guesses {
+		step := reviewStep{Guess: g, Before: len(candidates)}
+		step.Expected = expectedInfo(g.PinYin, sampleWords(candidates, solverMaxTargets))
+		step.Best, step.BestInfo = bestGuess(candidates)
+		candidates = filterCandidates(candidates, g)
+		step.After = len(candidates)
+		steps = append(steps, step)
+	}
+	return
+}
+
+func reviewText(game *Game, groupID int64) string {
+	length := len([]rune(game.Answer.Word.Text))
+	steps := analyze(game.GuessList, groupID, length)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "复盘：答案 %s，共 %d 次\n", game.Answer.Word.Text, game.Count)
+	for i, s := range steps {
+		gain := 0.0
+		if s.After > 0 {
+			gain = math.Log2(float64(s.Before) / float64(s.After))
+		}
+		fmt.Fprintf(&sb, "%d. %s（%s）候选 %d → %d，信息量 %.1f bit（期望 %.1f）", i+1, s.Guess.Word, s.Guess.UserName, s.Before, s.After, gain, s.Expected)
+		if s.Best.Text != "" && s.Best.Text != s.Guess.Word && s.BestInfo-s.Expected >= 0.1 {
+			fmt.Fprintf(&sb, "，当时最佳：%s（期望 %.1f）", s.Best.Text, s.BestInfo)
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// ReviewGame 复盘本群（私聊就是自己）上一局：/handle review
+func ReviewGame(ctx *zero.Ctx, args []string) {
+	lastGames.mux.Lock()
+	game, exists := lastGames.games[gamesession.Key(ctx)]
+	lastGames.mux.Unlock()
+	if !exists || len(game.GuessList) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("还没有结束的局可以复盘")))
+		return
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(reviewText(game, ctx.Event.GroupID))))
+}
+
+// SuggestGuess 给练习局提示下一步猜什么：/handle suggest，只能在私聊里用
+func SuggestGuess(ctx *zero.Ctx, args []string) {
+	if ctx.Event.GroupID != 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("群里就别作弊啦，私聊开一局练习吧")))
+		return
+	}
+	var (
+		guesses []Guess
+		length  int
+	)
+	if s, exists := gamesession.Sessions.Get(ctx); exists {
+		s.View(func() {
+			if game, ok := s.Game.(*Game); ok && game.Status == Start {
+				guesses = append(guesses, game.GuessList...)
+				length = len([]rune(game.Answer.Word.Text))
+			}
+		})
+	}
+	if len(guesses) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("先开一局汉兜、猜一次再来问吧")))
+		return
+	}
+	candidates := candidatePool(0, length)
+	for _, g := range guesses {
+		candidates = filterCandidates(candidates, g)
+	}
+	best, info := bestGuess(candidates)
+	if best.Text == "" {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("词典里找不到符合条件的词了……")))
+		return
+	}
+	text := fmt.Sprintf("还剩 %d 个候选词，建议猜：%s（期望 %.1f bit）", len(candidates), best.Text, info)
+	if len(candidates) <= 5 {
+		var words []string
+		for _, c := range candidates {
+			words = append(words, c.Text)
+		}
+		text += "\n候选：" + strings.Join(words, "、")
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(text)))
+}
@@ -0,0 +1,34 @@
+package hanyuwordle
+
+import "testing"
+
+func newSolverWords(words ...string) (result []solverWord) {
+	for _, w := range words {
+		result = append(result, solverWord{Text: w, PinYin: makePinYin(w)})
+	}
+	return
+}
+
+func TestFilterCandidates(t *testing.T) {
+	candidates := newSolverWords("银行", "音乐", "银河", "重庆", "长城")
+	game := newTestGame("银行", "银河")
+	got := filterCandidates(candidates, game.GuessList[0])
+	if len(got) != 1 || got[0].Text != "银行" {
+		t.Errorf("filterCandidates = %v, want [银行]", got)
+	}
+}
+
+func TestExpectedInfo(t *testing.T) {
+	candidates := newSolverWords("银行", "音乐", "银河", "重庆")
+	if info := expectedInfo(candidates[0].PinYin, candidates[:1]); info != 0 {
+		t.Errorf("expectedInfo with one target = %v, want 0", info)
+	}
+	// 四个词的结果各不相同时正好 2 bit
+	if info := expectedInfo(candidates[0].PinYin, candidates); info != 2 {
+		t.Errorf("expectedInfo = %v, want 2", info)
+	}
+	best, info := bestGuess(candidates)
+	if best.Text == "" || info < expectedInfo(candidates[3].PinYin, candidates) {
+		t.Errorf("bestGuess = %s %v", best.Text, info)
+	}
+}
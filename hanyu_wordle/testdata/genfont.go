@@ -0,0 +1,206 @@
+//go:build ignore
+
+// genfont 生成测试用的汉字字体 hantest.ttf：只有测试里用到的字，每个字画成一个方框，
+// 框里按码位的二进制填上格子，不同的字看得出不一样，也不会画成缺字的方块。
+// 在 hanyu_wordle 目录下运行：go run testdata/genfont.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"os"
+	"sort"
+)
+
+// chars 渲染测试里出现的所有汉字
+const chars = "银行音乐重庆银河长大快乐睡觉会计角色厦门大厦行业空调出差人参着急主角薄荷"
+
+const (
+	unitsPerEm = 1000
+	ascent     = 880
+	descent    = -120
+	advance    = 1000
+)
+
+type point struct{ x, y int16 }
+
+// rect 顺时针的矩形轮廓，inner 为 true 时逆时针，用来挖空
+func rect(x0, y0, x1, y1 int16, inner bool) []point {
+	if inner {
+		return []point{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}
+	}
+	return []point{{x0, y0}, {x0, y1}, {x1, y1}, {x1, y0}}
+}
+
+// glyph 方框加 4×4 的格子，第 i 个格子在码位第 i 位为 1 时填上
+func glyph(r rune) [][]point {
+	contours := [][]point{rect(60, -60, 940, 820, false), rect(120, 0, 880, 760, true)}
+	for i := 0; i < 16; i++ {
+		if r>>i&1 == 0 {
+			continue
+		}
+		x := int16(180 + i%4*160)
+		y := int16(60 + i/4*160)
+		contours = append(contours, rect(x, y, x+120, y+120, false))
+	}
+	return contours
+}
+
+// encodeGlyph 简单字形，所有点都在曲线上，坐标一律用 16 位差值
+func encodeGlyph(contours [][]point) []byte {
+	buf := new(bytes.Buffer)
+	w := func(v interface{}) { binary.Write(buf, binary.BigEndian, v) }
+	xMin, yMin, xMax, yMax := int16(32767), int16(32767), int16(-32768), int16(-32768)
+	var points []point
+	var ends []uint16
+	for _, c := range contours {
+		points = append(points, c...)
+		ends = append(ends, uint16(len(points)-1))
+	}
+	for _, p := range points {
+		if p.x < xMin {
+			xMin = p.x
+		}
+		if p.x > xMax {
+			xMax = p.x
+		}
+		if p.y < yMin {
+			yMin = p.y
+		}
+		if p.y > yMax {
+			yMax = p.y
+		}
+	}
+	w(int16(len(contours)))
+	w([]int16{xMin, yMin, xMax, yMax})
+	w(ends)
+	w(uint16(0)) // 没有指令
+	for range points {
+		buf.WriteByte(0x01)
+	}
+	var last int16
+	for _, p := range points {
+		w(p.x - last)
+		last = p.x
+	}
+	last = 0
+	for _, p := range points {
+		w(p.y - last)
+		last = p.y
+	}
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+func be(vs ...interface{}) []byte {
+	buf := new(bytes.Buffer)
+	for _, v := range vs {
+		binary.Write(buf, binary.BigEndian, v)
+	}
+	return buf.Bytes()
+}
+
+func checksum(b []byte) uint32 {
+	var sum uint32
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	for i := 0; i < len(b); i += 4 {
+		sum += binary.BigEndian.Uint32(b[i:])
+	}
+	return sum
+}
+
+func main() {
+	seen := map[rune]bool{}
+	var runes []rune
+	for _, r := range chars {
+		if !seen[r] {
+			seen[r] = true
+			runes = append(runes, r)
+		}
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+
+	// 0 号字形是缺字时用的空方框
+	glyphs := [][][]point{{rect(60, -60, 940, 820, false), rect(120, 0, 880, 760, true)}}
+	for _, r := range runes {
+		glyphs = append(glyphs, glyph(r))
+	}
+	var glyf, loca []byte
+	maxPoints, maxContours := 0, 0
+	for _, g := range glyphs {
+		loca = append(loca, be(uint32(len(glyf)))...)
+		glyf = append(glyf, encodeGlyph(g)...)
+		n := 0
+		for _, c := range g {
+			n += len(c)
+		}
+		if n > maxPoints {
+			maxPoints = n
+		}
+		if len(g) > maxContours {
+			maxContours = len(g)
+		}
+	}
+	loca = append(loca, be(uint32(len(glyf)))...)
+
+	cmap := be(uint16(0), uint16(1), uint16(3), uint16(10), uint32(12))
+	cmap = append(cmap, be(uint16(12), uint16(0), uint32(16+12*len(runes)), uint32(0), uint32(len(runes)))...)
+	for i, r := range runes {
+		cmap = append(cmap, be(uint32(r), uint32(r), uint32(i+1))...)
+	}
+
+	var hmtx []byte
+	for range glyphs {
+		hmtx = append(hmtx, be(uint16(advance), int16(60))...)
+	}
+
+	tables := map[string][]byte{
+		"cmap": cmap,
+		"glyf": glyf,
+		"head": be(uint32(0x00010000), uint32(0x00010000), uint32(0), uint32(0x5F0F3CF5), uint16(0x000B), uint16(unitsPerEm),
+			int64(0), int64(0), int16(60), int16(-60), int16(940), int16(820), uint16(0), uint16(8), int16(2), int16(1), int16(0)),
+		"hhea": be(uint32(0x00010000), int16(ascent), int16(descent), int16(0), uint16(advance), int16(60), int16(60), int16(940),
+			int16(1), int16(0), int16(0), int16(0), int16(0), int16(0), int16(0), int16(0), uint16(len(glyphs))),
+		"hmtx": hmtx,
+		"loca": loca,
+		"maxp": be(uint32(0x00010000), uint16(len(glyphs)), uint16(maxPoints), uint16(maxContours), uint16(0), uint16(0),
+			uint16(2), uint16(0), uint16(0), uint16(0), uint16(0), uint16(0), uint16(0), uint16(0), uint16(0)),
+		"post": be(uint32(0x00030000), int32(0), int16(-100), int16(50), uint32(1), uint32(0), uint32(0), uint32(0), uint32(0)),
+	}
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := be(uint32(0x00010000), uint16(len(names)), uint16(128), uint16(3), uint16(len(names)*16-128))
+	offset := len(out) + 16*len(names)
+	var body []byte
+	for _, name := range names {
+		data := tables[name]
+		out = append(out, name...)
+		out = append(out, be(checksum(data), uint32(offset+len(body)), uint32(len(data)))...)
+		body = append(body, data...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+	font := append(out, body...)
+	// head 的 checkSumAdjustment 在偏移 8
+	headOffset := offset
+	for _, name := range names {
+		if name == "head" {
+			break
+		}
+		headOffset += (len(tables[name]) + 3) / 4 * 4
+	}
+	binary.BigEndian.PutUint32(font[headOffset+8:], 0xB1B0AFBA-checksum(font))
+	if err := os.WriteFile("testdata/hantest.ttf", font, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
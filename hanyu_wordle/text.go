@@ -0,0 +1,186 @@
+package hanyuwordle
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	gamesession "github.com/doylecnn/qqbot/game_session"
+	groupsettings "github.com/doylecnn/qqbot/group_settings"
+	"github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	boardStyleImage = "image"
+	boardStyleText  = "text"
+)
+
+var tagEmoji = []string{"⬜", "🟨", "🟩"}
+
+// knownParts 汇总已经猜过的声母和韵母的最好结果：0 排除，1 位置不对，2 对
+func knownParts(game *Game) map[string]int {
+	best := make(map[string]int)
+	for _, guess := range game.GuessList {
+		for i := range guess.PinYin {
+			for j := 1; j <= 2; j++ {
+				part := guess.PinYin[i][j]
+				tag := int(guess.Tag[j][i] - '0')
+				if v, exists := best[part]; !exists || v < tag {
+					best[part] = tag
+				}
+			}
+		}
+	}
+	return best
+}
+
+// drawTextBoard 文字棋盘，recent 大于 0 时只列出最近几次猜测
+func drawTextBoard(game *Game, recent int) string {
+	var sb strings.Builder
+	skipped := 0
+	if recent > 0 && len(game.GuessList) > recent {
+		skipped = len(game.GuessList) - recent
+		fmt.Fprintf(&sb, "（前 %d 次省略，/handle board full 查看全部）\n", skipped)
+	}
+	for n, guess := range game.GuessList[skipped:] {
+		fmt.Fprintf(&sb, "%d. %s ", skipped+n+1, guess.Word)
+		for i := range guess.PinYin {
+			sb.WriteString(tagEmoji[guess.Tag[0][i]-'0'])
+		}
+		sb.WriteString("\n  ")
+		for i, p := range guess.PinYin {
+			if i > 0 {
+				sb.WriteString(" ")
+			}
+			sb.WriteString(p[1] + p[2] + p[3])
+			for j := 1; j <= 3; j++ {
+				sb.WriteString(tagEmoji[guess.Tag[j][i]-'0'])
+			}
+		}
+		sb.WriteString("\n")
+	}
+	var found, misplaced, excluded []string
+	for part, tag := range knownParts(game) {
+		if part == "" {
+			continue
+		}
+		switch tag {
+		case 2:
+			found = append(found, part)
+		case 1:
+			misplaced = append(misplaced, part)
+		default:
+			excluded = append(excluded, part)
+		}
+	}
+	for _, parts := range []struct {
+		title string
+		parts []string
+	}{{"对", found}, {"位置不对", misplaced}, {"排除", excluded}} {
+		if len(parts.parts) > 0 {
+			sort.Strings(parts.parts)
+			fmt.Fprintf(&sb, "%s: %s\n", parts.title, strings.Join(parts.parts, " "))
+		}
+	}
+	return sb.String()
+}
+
+// shareText 生成类似 Wordle 的分享格子
+func shareText(game *Game) string {
+	var sb strings.Builder
+	result := "X"
+	if n := len(game.GuessList); n > 0 && game.GuessList[n-1].Word == game.Answer.Word.Text {
+		result = fmt.Sprintf("%d", game.Count)
+	}
+	fmt.Fprintf(&sb, "汉兜 %d字 %s次\n", len([]rune(game.Answer.Word.Text)), result)
+	for _, guess := range game.GuessList {
+		for i := range guess.PinYin {
+			sb.WriteString(tagEmoji[guess.Tag[0][i]-'0'])
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// renderBoard 按群设置生成棋盘消息，图片画不出来时退回文字
+func renderBoard(game *Game, groupID int64) message.MessageSegment {
+	board, err := groupRenderer(groupID).Render(game)
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event":     "Handle Game Draw Image",
+			"Error":     err,
+			"QQGroupId": groupID,
+		}).Warningln("画图失败，改用文字棋盘")
+		board, _ = textRenderer{}.Render(game)
+	}
+	return board
+}
+
+// BoardStyle 切换本群的棋盘样式：/handle style image|text
+func BoardStyle(ctx *zero.Ctx, args []string) {
+	if len(args) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("当前棋盘样式：%s\n用法：/handle style image|text", groupsettings.Get(ctx.Event.GroupID, boardSettingKey, boardStyleImage)))))
+		return
+	}
+	if !plugin.GroupAdmin(ctx) {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("只有管理员可以切换棋盘样式")))
+		return
+	}
+	style := strings.ToLower(args[0])
+	if style != boardStyleImage && style != boardStyleText {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("只有 image 和 text 两种样式")))
+		return
+	}
+	if err := groupsettings.Set(ctx.Event.GroupID, boardSettingKey, style); err != nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err.Error())))
+		return
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("棋盘样式已切换为："+style)))
+}
+
+// currentBoard 本群正在进行的一局，没有就是刚结束的一局，返回的是副本
+func currentBoard(ctx *zero.Ctx) (board *Game, found bool) {
+	if s, exists := gamesession.Sessions.Get(ctx); exists {
+		s.View(func() {
+			if game, ok := s.Game.(*Game); ok && game.Status != Ready {
+				board = &Game{Status: game.Status, Answer: game.Answer, GuessList: append([]Guess(nil), game.GuessList...), Count: game.Count}
+			}
+		})
+		if board != nil {
+			return board, true
+		}
+	}
+	lastGames.mux.Lock()
+	defer lastGames.mux.Unlock()
+	if game, exists := lastGames.games[gamesession.Key(ctx)]; exists {
+		return game, true
+	}
+	return nil, false
+}
+
+// BoardCommand 重新发一遍棋盘：/handle board [full]，full 发送完整的猜测记录
+func BoardCommand(ctx *zero.Ctx, args []string) {
+	game, exists := currentBoard(ctx)
+	if !exists || len(game.GuessList) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("现在没有可以看的棋盘")))
+		return
+	}
+	if len(args) == 0 || strings.ToLower(args[0]) != "full" {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, renderBoard(game, ctx.Event.GroupID)))
+		return
+	}
+	board, err := groupRenderer(ctx.Event.GroupID).RenderFull(game)
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event":     "Handle Game Draw Image",
+			"Error":     err,
+			"QQGroupId": ctx.Event.GroupID,
+		}).Warningln("画图失败，改用文字棋盘")
+		board, _ = textRenderer{}.RenderFull(game)
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, board...))
+}
@@ -1,32 +1,25 @@
 package hanyuwordle
 
 import (
-	"bufio"
-	"bytes"
-	"embed"
-	"errors"
+	"encoding/json"
 	"fmt"
-	"image/png"
-	"math"
 	"math/rand"
-	"net/url"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
+	gamesession "github.com/doylecnn/qqbot/game_session"
 	"github.com/doylecnn/qqbot/log"
 	"github.com/sirupsen/logrus"
 
-	"github.com/fogleman/gg"
-	"github.com/mozillazg/go-pinyin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
 	"github.com/samber/lo"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
 )
 
-//go:embed wordle_dicts
-var dictsDir embed.FS
-
 type GameStatus int
 
 var (
@@ -35,12 +28,6 @@ var (
 	End   GameStatus = 2
 )
 
-type Games struct {
-	games  map[int64]*Game
-	status string
-	mux    sync.RWMutex
-}
-
 type Game struct {
 	Status    GameStatus
 	Answer    Answer
@@ -48,7 +35,10 @@ type Game struct {
 	guesses   map[string]Guess
 	Count     int
 	Tips      []rune
-	Mux       sync.Mutex
+	// Difficulty 出题难度，见 difficultyTiers
+	Difficulty string
+	// Mux 每日汉兜用，普通汉兜和比赛在 gamesession 的事件队列里串行处理
+	Mux sync.Mutex
 }
 
 type Guess struct {
@@ -66,253 +56,290 @@ type Answer struct {
 type Word struct {
 	Text string
 	Type string
+	// Freq THUOCL 词库里的词频，没有词频的词典为 0
+	Freq int
 }
 
-var dict map[int][]Word = make(map[int][]Word)
 var reZhongWenWord = regexp.MustCompile(`^\p{Han}+$`)
-var games Games = Games{games: make(map[int64]*Game), mux: sync.RWMutex{}, status: "ready"}
-var pinyinArgs = pinyin.Args{Style: pinyin.Tone3, Heteronym: false}
-
-func wordleDictionaryInit() {
-	THUOCLDicts := []string{"动物", "财经", "汽车", "地名", "食物", "IT", "法律", "人名", "医药", "成语", "古诗文"}
-	for _, dn := range THUOCLDicts {
-		data, err := dictsDir.ReadFile(fmt.Sprintf("wordle_dicts/THUOCL_%s.txt", dn))
-		if err != nil {
-			log.Log.WithFields(logrus.Fields{
-				"event":    "Handle Game Init",
-				"Error":    err,
-				"DictName": dn,
-			}).Fatalln("字典初始出错")
-		}
-		scanner := bufio.NewScanner(strings.NewReader(string(data)))
-		scanner.Split(bufio.ScanLines)
-		for scanner.Scan() {
-			word := strings.TrimSpace(strings.Split(scanner.Text(), "\t")[0])
-			if reZhongWenWord.MatchString(word) {
-				length := len([]rune(word))
-				dict[length] = append(dict[length], Word{word, dn})
-			}
-		}
-	}
 
-	otherDicts := []string{"维基百科", "萌娘百科"}
-	for _, dn := range otherDicts {
-		data, err := dictsDir.ReadFile(fmt.Sprintf("wordle_dicts/dict_%s.txt", dn))
-		if err != nil {
-			log.Log.WithFields(logrus.Fields{
-				"event":    "Handle Game Init",
-				"Error":    err,
-				"DictName": dn,
-			}).Fatalln("字典初始出错")
-		}
-		scanner := bufio.NewScanner(strings.NewReader(string(data)))
-		scanner.Split(bufio.ScanLines)
-		for scanner.Scan() {
-			word := strings.TrimSpace(strings.Split(scanner.Text(), "\t")[0])
-			if reZhongWenWord.MatchString(word) {
-				length := len([]rune(word))
-				dict[length] = append(dict[length], Word{word, dn})
+const gameName = "汉兜"
+
+// idleTimeout 这么久没人猜就结束并公布答案
+const idleTimeout = 30 * time.Minute
+
+// lastGames 每个聊天最近结束的一局，用于举报答案、复盘等，键和 gamesession.Key 相同
+var lastGames = struct {
+	games map[int64]*Game
+	mux   sync.Mutex
+}{games: make(map[int64]*Game)}
+
+func init() {
+	gamesession.RegisterGame(gameName, restoreGame)
+}
+
+var db *sqlx.DB
+
+// Init 设置数据库连接和配置，数据库用于保存读音修正和每日汉兜成绩等数据，群设置在 groupsettings 里
+func Init(database *sqlx.DB, config *toml.Tree) {
+	db = database
+	if config == nil {
+		return
+	}
+	if seed, ok := config.Get("wordle.daily_seed").(string); ok && seed != "" {
+		dailySeed = seed
+	}
+	if dir, ok := config.Get("wordle.dict_dir").(string); ok {
+		dictDir = dir
+	}
+	if freq, ok := config.Get("wordle.min_freq").(int64); ok {
+		minFreq = int(freq)
+	}
+	if dir, ok := config.Get("wordle.glossary_dir").(string); ok {
+		glossaryDir = dir
+	}
+	if urls, ok := config.Get("wordle.search_url").(*toml.Tree); ok {
+		for _, name := range urls.Keys() {
+			if template, ok := urls.Get(name).(string); ok {
+				if name == "default" {
+					name = ""
+				}
+				searchURLs[name] = template
 			}
 		}
 	}
-	for k, v := range dict {
-		dict[k] = lo.Shuffle(v)
-	}
 }
 
-func BotRestart(ctx *zero.Ctx) {
-	games.mux.Lock()
-	defer games.mux.Unlock()
-	if games.status == "ready" {
-		games.status = "end"
-		for groupid := range games.games {
-			ctx.SendGroupMessage(groupid, message.Text("准备重启啦"))
-		}
-	}
+var subCommands = map[string]func(ctx *zero.Ctx, args []string){
+	"pinyin":  PinYinFix,
+	"style":   BoardStyle,
+	"theme":   BoardTheme,
+	"board":   BoardCommand,
+	"daily":   DailyCommand,
+	"dict":    DictCommand,
+	"report":  ReportAnswer,
+	"reports": ReviewReports,
+	"block":   BlockWord,
+	"unblock": UnblockWord,
+	"race":    RaceCommand,
+	"join":    RaceJoin,
+	"go":      RaceGo,
+	"review":  ReviewGame,
+	"suggest": SuggestGuess,
 }
 
 func GameStart(ctx *zero.Ctx) {
-	if len(dict) == 0 {
-		wordleDictionaryInit()
-	}
-	rlocker := games.mux.RLocker()
-	rlocker.Lock()
-	if games.status == "end" {
-		rlocker.Unlock()
-		ctx.SendGroupMessage(ctx.Event.GroupID, message.ReplyWithMessage(ctx.Event.MessageID, message.Text("在准备重启啦，请稍后再开")))
-		return
-	}
-	_, exists := games.games[ctx.Event.GroupID]
-	rlocker.Unlock()
-	if exists {
-		ctx.SendGroupMessage(ctx.Event.GroupID, message.ReplyWithMessage(ctx.Event.MessageID, message.Text("已经开始啦")))
-	} else if games.mux.TryLock() {
-		log.Log.WithFields(logrus.Fields{
-			"event":     "Handle Game Start",
-			"Msg":       ctx.MessageString(),
-			"QQGroupId": ctx.Event.GroupID,
-		}).Infoln("游戏开始")
-		game := &Game{Status: Ready, guesses: make(map[string]Guess), Mux: sync.Mutex{}}
-		games.mux.Unlock()
-		err := firstGuess(ctx, game)
-		if err != nil {
-			if err.Error() == "内容太长了，换一个短点的词！" {
-				ctx.SendGroupMessage(ctx.Event.GroupID, message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err)))
+	difficulty := ""
+	if args, ok := ctx.State["args"].(string); ok {
+		fields := strings.Fields(args)
+		if len(fields) > 0 {
+			if subCommand, exists := subCommands[strings.ToLower(fields[0])]; exists {
+				subCommand(ctx, fields[1:])
 				ctx.Block()
+				return
+			}
+			if isDifficulty(fields[0]) {
+				difficulty = fields[0]
 			}
-			return
-		}
-		if game.Status != End {
-			games.mux.Lock()
-			games.games[ctx.Event.GroupID] = game
-			games.mux.Unlock()
 		}
-		if game.Status == Ready {
-			ctx.SendGroupMessage(ctx.Event.GroupID, message.ReplyWithMessage(ctx.Event.MessageID, message.Text("游戏开始啦，下一条群消息就是第一次猜测（并确定词的长度）\n\n灰色: 不太对\n黄色: 位置不太对\n绿色: 对对对\n灰色拼音元素: 排除\n\n输入“太难了”、“放弃”或者/stop指令结束游戏并看答案")))
+	}
+	dictOnce.Do(wordleDictionaryInit)
+	game := &Game{Status: Ready, guesses: make(map[string]Guess), Difficulty: difficulty}
+	if s, err := gamesession.Sessions.Start(ctx, gameName, game, idleTimeout); err != nil {
+		if s != nil && s.Name == gameName {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("已经开始啦")))
+		} else {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err.Error())))
 		}
 	}
 	ctx.Block()
 }
 
+// GameStop /stop、“太难了”、“放弃”：先看每日汉兜，再结束当前聊天里的汉兜或者汉兜比赛，别的游戏有自己的结束指令
 func GameStop(ctx *zero.Ctx) {
-	rlocker := games.mux.RLocker()
-	rlocker.Lock()
-	game, exists := games.games[ctx.Event.GroupID]
-	rlocker.Unlock()
-	if exists {
-		games.mux.Lock()
-		delete(games.games, ctx.Event.GroupID)
-		games.mux.Unlock()
-		urlstr := "https://www.bing.com/search?q=" + url.QueryEscape(game.Answer.Word.Text)
-		if game.Answer.Word.Type == "moegirl" {
-			urlstr = "https://www.bing.com/search?q=site%3Azh.moegirl.org.cn+\"" + url.PathEscape(game.Answer.Word.Text) + "\""
-		}
-		ctx.SendGroupMessage(ctx.Event.GroupID, message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("本轮终止\n 答案是：%[1]s\n所以… %[1]s 是什么呢？好吃吗？ Bing一下: %[2]s", game.Answer.Word.Text, urlstr))))
+	if dailyStop(ctx) {
+		return
+	}
+	s, exists := gamesession.Sessions.Get(ctx)
+	if !exists {
+		return
+	}
+	switch s.Game.(type) {
+	case *Game, *race:
+		gamesession.Sessions.Stop(ctx)
 	}
 }
 
+// OnGuess 每日汉兜的猜测，普通汉兜和其他游戏的消息由 gamesession 分发
 func OnGuess(ctx *zero.Ctx) {
-	rlocker := games.mux.RLocker()
-	rlocker.Lock()
-	game, exists := games.games[ctx.Event.GroupID]
-	rlocker.Unlock()
-	if !exists {
-		return
-	} else if game.Status == Ready {
-		err := firstGuess(ctx, game)
-		if err != nil {
-			if err.Error() == "非常不巧，词典里没有这个长度的词……" {
-				ctx.SendGroupMessage(ctx.Event.GroupID, message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err)))
-				ctx.Block()
-			}
-			return
-		}
+	if dailyGuess(ctx) {
 		ctx.Block()
-	} else if game.Status != End {
-		msg := strings.TrimSpace(ctx.MessageString())
-		length := len([]rune(msg))
-		if length != len([]rune(game.Answer.Word.Text)) {
-			return
-		}
-		if _, exists := game.guesses[msg]; exists {
-			ctx.SendGroupMessage(ctx.Event.GroupID, message.ReplyWithMessage(ctx.Event.MessageID, message.Text("这个词已经猜过啦")))
-			ctx.Block()
-			return
-		}
+	}
+}
 
-		guessPinYin := makePinYin(msg)
-		if len(guessPinYin) == 0 {
-			return
-		}
-		game.Mux.Lock()
-		imageBytes, err := guess(game, ctx, msg, guessPinYin, game.Answer.PinYin)
-		if err != nil {
-			log.Log.WithFields(logrus.Fields{
-				"event":        "Handle Game Guess",
-				"Error":        err,
-				"Game":         game,
-				"Guess":        msg,
-				"GuessPinYin":  guessPinYin,
-				"Answer":       game.Answer.Word.Text,
-				"AnswerDict":   game.Answer.Word.Type,
-				"AnswerPinYin": game.Answer.PinYin,
-			}).Warningln("猜测过程异常")
-		}
-		if game.Answer.Word.Text == msg {
-			game.Status = End
-			games.mux.Lock()
-			games.games[ctx.Event.GroupID] = game
-			delete(games.games, ctx.Event.GroupID)
-			games.mux.Unlock()
-			urlstr := "https://www.bing.com/search?q=" + url.QueryEscape(game.Answer.Word.Text)
-			if game.Answer.Word.Type == "moegirl" {
-				urlstr = "https://www.bing.com/search?q=site%3Azh.moegirl.org.cn+\"" + url.PathEscape(game.Answer.Word.Text) + "\""
-			}
-			ctx.SendGroupMessage(ctx.Event.GroupID, message.ReplyWithMessage(ctx.Event.MessageID, message.ImageBytes(imageBytes), message.Text(fmt.Sprintf("（总共 %[1]d 次）猜对啦！答案是:\n%[2]s\n所以… %[2]s 是什么呢？好吃吗？ Bing 一下: %[3]s", game.Count, game.Answer.Word.Text, urlstr))))
-			game.Mux.Unlock()
-			ctx.Block()
-			return
-		} else if len(game.GuessList) > 9 && len(game.GuessList)%5 == 0 {
-			var guessedWords []rune
-			for _, v := range game.GuessList {
-				guessedWords = append(guessedWords, []rune(v.Word)...)
-			}
-			guessedWords = append(guessedWords, game.Tips...)
-			guessedWords = lo.Uniq(guessedWords)
-			hints := []rune(game.Answer.Word.Text)
-			hints = lo.DropWhile(hints, func(r rune) bool {
-				return lo.Contains(guessedWords, r)
-			})
-			hints = lo.Uniq(hints)
-			hints = lo.Shuffle(hints)
-			if len(hints) > 0 {
-				game.Tips = append(game.Tips, hints[0])
-				game.Tips = lo.Uniq(game.Tips)
-			}
+// finish 结束这一局并记下来，调用方需持有 Session 锁
+func finish(s *gamesession.Session, game *Game) {
+	game.Status = End
+	s.End()
+	lastGames.mux.Lock()
+	defer lastGames.mux.Unlock()
+	lastGames.games[s.Key] = game
+}
+
+// Start /handle 后面直接带了词就当作第一次猜测
+func (game *Game) Start(ctx *zero.Ctx, s *gamesession.Session) {
+	log.Log.WithFields(logrus.Fields{
+		"event":     "Handle Game Start",
+		"Msg":       ctx.MessageString(),
+		"QQGroupId": ctx.Event.GroupID,
+	}).Infoln("游戏开始")
+	if game.firstGuess(ctx, s) {
+		return
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("游戏开始啦，下一条消息就是第一次猜测（并确定词的长度）\n\n灰色: 不太对\n黄色: 位置不太对\n绿色: 对对对\n灰色拼音元素: 排除\n\n输入“太难了”、“放弃”或者/stop指令结束游戏并看答案")))
+}
+
+func (game *Game) Input(ctx *zero.Ctx, s *gamesession.Session) bool {
+	if game.Status == Ready {
+		return game.firstGuess(ctx, s)
+	}
+	msg := strings.TrimSpace(ctx.MessageString())
+	if len([]rune(msg)) != len([]rune(game.Answer.Word.Text)) {
+		return false
+	}
+	if _, exists := game.guesses[msg]; exists {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("这个词已经猜过啦")))
+		return true
+	}
+	guessPinYin := makePinYin(msg)
+	if len(guessPinYin) == 0 {
+		return false
+	}
+	board, err := guess(game, ctx, msg, guessPinYin, game.Answer.PinYin)
+	if err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event":        "Handle Game Guess",
+			"Error":        err,
+			"Game":         game,
+			"Guess":        msg,
+			"GuessPinYin":  guessPinYin,
+			"Answer":       game.Answer.Word.Text,
+			"AnswerDict":   game.Answer.Word.Type,
+			"AnswerPinYin": game.Answer.PinYin,
+		}).Warningln("猜测过程异常")
+	}
+	if game.Answer.Word.Text == msg {
+		game.win(ctx, s, board)
+		return true
+	} else if len(game.GuessList) > 9 && len(game.GuessList)%5 == 0 {
+		var guessedWords []rune
+		for _, v := range game.GuessList {
+			guessedWords = append(guessedWords, []rune(v.Word)...)
 		}
-		if len(game.Tips) > 0 {
-			ctx.SendGroupMessage(ctx.Event.GroupID, message.ReplyWithMessage(ctx.Event.MessageID, message.ImageBytes(imageBytes), message.Text(fmt.Sprintf("词条来源：%s, 第 %d 次\n提示 包含以下几个字：%s", game.Answer.Word.Type, game.Count, string(game.Tips)))))
-		} else {
-			ctx.SendGroupMessage(ctx.Event.GroupID, message.ReplyWithMessage(ctx.Event.MessageID, message.ImageBytes(imageBytes), message.Text(fmt.Sprintf("词条来源：%s, 第 %d 次", game.Answer.Word.Type, game.Count))))
+		guessedWords = append(guessedWords, game.Tips...)
+		guessedWords = lo.Uniq(guessedWords)
+		hints := []rune(game.Answer.Word.Text)
+		hints = lo.DropWhile(hints, func(r rune) bool {
+			return lo.Contains(guessedWords, r)
+		})
+		hints = lo.Uniq(hints)
+		hints = lo.Shuffle(hints)
+		if len(hints) > 0 {
+			game.Tips = append(game.Tips, hints[0])
+			game.Tips = lo.Uniq(game.Tips)
 		}
-		game.Mux.Unlock()
-		ctx.Block()
 	}
+	if len(game.Tips) > 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, board, message.Text(fmt.Sprintf("词条来源：%s, 第 %d 次\n提示 包含以下几个字：%s", game.Answer.Word.Type, game.Count, string(game.Tips)))))
+	} else {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, board, message.Text(fmt.Sprintf("词条来源：%s, 第 %d 次", game.Answer.Word.Type, game.Count))))
+	}
+	return true
 }
 
-func firstGuess(ctx *zero.Ctx, game *Game) (err error) {
-	if !game.Mux.TryLock() {
-		return
+// win 猜中的人得 1 分
+func (game *Game) win(ctx *zero.Ctx, s *gamesession.Session, board message.MessageSegment) {
+	s.AddScore(ctx.Event.UserID, game.GuessList[len(game.GuessList)-1].UserName, 1)
+	finish(s, game)
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, board, message.Text(fmt.Sprintf("（总共 %d 次）猜对啦！%s\n\n%s", game.Count, revealText(game.Answer), shareText(game)))))
+}
+
+func (game *Game) Timeout(ctx *zero.Ctx, s *gamesession.Session) bool {
+	if game.Status == Ready {
+		ctx.Send(message.Text(fmt.Sprintf("%s 没人猜，本轮结束", idleTimeout)))
+	} else {
+		ctx.Send(message.Text(fmt.Sprintf("%s 没人猜，本轮结束\n%s\n\n%s", idleTimeout, revealText(game.Answer), shareText(game))))
 	}
-	defer game.Mux.Unlock()
+	finish(s, game)
+	return false
+}
+
+func (game *Game) Stop(ctx *zero.Ctx, s *gamesession.Session) bool {
+	if game.Status == Ready {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("本轮终止")))
+	} else {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("本轮终止\n%s\n\n%s", revealText(game.Answer), shareText(game)))))
+	}
+	finish(s, game)
+	return true
+}
+
+// savedGame 重启前保存的一局，guesses 从 GuessList 重建
+type savedGame struct {
+	Status     GameStatus
+	Answer     Answer
+	GuessList  []Guess
+	Count      int
+	Tips       []rune
+	Difficulty string
+}
+
+func (game *Game) Persist() ([]byte, error) {
+	return json.Marshal(savedGame{Status: game.Status, Answer: game.Answer, GuessList: game.GuessList, Count: game.Count, Tips: game.Tips, Difficulty: game.Difficulty})
+}
+
+func restoreGame(data []byte) (gamesession.Game, error) {
+	var saved savedGame
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	game := &Game{Status: saved.Status, Answer: saved.Answer, GuessList: saved.GuessList, guesses: make(map[string]Guess), Count: saved.Count, Tips: saved.Tips, Difficulty: saved.Difficulty}
+	for _, g := range game.GuessList {
+		game.guesses[g.Word] = g
+	}
+	return game, nil
+}
+
+// firstGuess 第一次猜测决定词的长度并出题，返回 false 表示这条消息不是猜测
+func (game *Game) firstGuess(ctx *zero.Ctx, s *gamesession.Session) bool {
 	msg := strings.TrimSpace(ctx.MessageString())
 	if strings.HasPrefix(msg, "/handle") {
 		msg = strings.TrimSpace(msg[7:])
+		if fields := strings.Fields(msg); len(fields) > 0 && isDifficulty(fields[0]) {
+			msg = strings.TrimSpace(msg[len(fields[0]):])
+		}
 	}
 	if !reZhongWenWord.MatchString(msg) {
-		return
+		return false
 	}
 	length := len([]rune(msg))
-	if length < 2 {
-		length = 2
+	if length < 2 || length > 9 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("词的长度要在 2 到 9 个字之间")))
+		return true
 	}
-	if length > 9 {
-		length = 9
-	}
-	selectedDict, exists := dict[length]
-	if !exists {
-		err = errors.New("非常不巧，词典里没有这个长度的词……")
-		return
+	selectedDict := answerCandidates(ctx.Event.GroupID, length, game.Difficulty)
+	if len(selectedDict) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("非常不巧，词典里没有这个长度的词……")))
+		return true
 	}
 	guessPinYin := makePinYin(msg)
 	if len(guessPinYin) == 0 {
-		return
+		return false
 	}
-	answer := selectedDict[rand.Intn(len(dict[length]))]
+	answer := selectedDict[rand.Intn(len(selectedDict))]
 	answerPinYin := makePinYin(answer.Text)
 	game.Answer = Answer{Word: answer, PinYin: answerPinYin}
 	game.Status = Start
-	imageBytes, err := guess(game, ctx, msg, guessPinYin, game.Answer.PinYin)
+	board, err := guess(game, ctx, msg, guessPinYin, game.Answer.PinYin)
 	if err != nil {
 		log.Log.WithFields(logrus.Fields{
 			"event":        "Handle Game Guess",
@@ -331,200 +358,29 @@ func firstGuess(ctx *zero.Ctx, game *Game) (err error) {
 		"QQGroupId": ctx.Event.GroupID,
 	}).Infoln("第一次猜测")
 	if game.Answer.Word.Text == msg {
-		game.Status = End
-		games.mux.Lock()
-		games.games[ctx.Event.GroupID] = game
-		delete(games.games, ctx.Event.GroupID)
-		games.mux.Unlock()
-		urlstr := "https://www.bing.com/search?q=" + url.QueryEscape(game.Answer.Word.Text)
-		if game.Answer.Word.Type == "moegirl" {
-			urlstr = "https://www.bing.com/search?q=site%3Azh.moegirl.org.cn+\"" + url.PathEscape(game.Answer.Word.Text) + "\""
-		}
-		ctx.SendGroupMessage(ctx.Event.GroupID, message.ReplyWithMessage(ctx.Event.MessageID, message.ImageBytes(imageBytes), message.Text(fmt.Sprintf("（总共 %[1]d 次）猜对啦！答案是:\n%[2]s\n所以… %[2]s 是什么呢？好吃吗？ Bing 一下: %[3]s", game.Count, game.Answer.Word.Text, urlstr))))
+		game.win(ctx, s, board)
 	} else {
-		ctx.SendGroupMessage(ctx.Event.GroupID, message.ReplyWithMessage(ctx.Event.MessageID, message.ImageBytes(imageBytes), message.Text(fmt.Sprintf("词条分类：%s, 第 %d 次", game.Answer.Word.Type, game.Count))))
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, board, message.Text(fmt.Sprintf("词条分类：%s, 第 %d 次", game.Answer.Word.Type, game.Count))))
 	}
-	return
+	return true
 }
 
-func guess(game *Game, ctx *zero.Ctx, msg string, guessPinYin, targetPinYin [][4]string) (imageBytes []byte, err error) {
-	tag := pinYinMatch(game, guessPinYin, targetPinYin)
+func guess(game *Game, ctx *zero.Ctx, msg string, guessPinYin, targetPinYin [][4]string) (board message.MessageSegment, err error) {
+	tag := pinYinMatch(guessPinYin, targetPinYin)
 	guess := Guess{UserName: ctx.CardOrNickName(ctx.Event.UserID), Word: msg, PinYin: guessPinYin, Tag: tag}
 	game.GuessList = append(game.GuessList, guess)
 	game.guesses[msg] = guess
 	game.Count++
-	games.mux.Lock()
-	games.games[ctx.Event.GroupID] = game
-	games.mux.Unlock()
-	// 画图
-	img, err := drawGameBorad(game)
-	imageBytes = img.Bytes()
+	board = renderBoard(game, ctx.Event.GroupID)
 	return
 }
 
-func drawGameBorad(game *Game) (boardImage *bytes.Buffer, err error) {
-	size := len([]rune(game.Answer.Word.Text))
-	realTotal := float64(game.Count) + math.Ceil(29/float64(size))/4
-	width := (96*size+8)*int(math.Ceil(realTotal/16.0)) - 8
-	height := int(math.Ceil(96 * math.Min(realTotal, 16.0)))
-	best := make(map[string]int)
-	log.Log.WithFields(logrus.Fields{
-		"event":  "Handle Game Draw Image",
-		"Width":  width,
-		"Height": height,
-	}).Debugln("Draw Image")
-	dc := gg.NewContext(width, height)
-	dc.SetRGB(1, 1, 1)
-	dc.Clear()
-	filePath1 := "C:\\Windows\\Fonts\\msyhbd.ttc"
-	face1, err := gg.LoadFontFace(filePath1, 52)
-	if err != nil {
-		panic(err)
-	}
-	defer face1.Close()
-	filePath2 := "C:\\Windows\\Fonts\\arialnb.ttf"
-	face2, err := gg.LoadFontFace(filePath2, 22)
-	if err != nil {
-		panic(err)
-	}
-	defer face2.Close()
-	face3, err := gg.LoadFontFace(filePath2, 18)
-	if err != nil {
-		panic(err)
-	}
-	defer face3.Close()
-	backgroundColor := []string{"#f7f8f9", "#f7f8f9", "#1d9c9c"}
-	frontColor := []string{"#5d6572", "#de7525", "#ffffff"}
-	ColorMap := [][]string{
-		{"#b4b8be", "#de7525", "#1d9c9c"},
-		{"#b4b8be", "#de7525", "#1d9c9c"},
-		{"#5d6572", "#de7525", "#ffffff"},
-	}
-	left := 0.0
-	top := 0.0
-	for _, guess := range game.GuessList {
-		for i := 0; i < size; i++ {
-			pinyin1 := guess.PinYin[i][1]
-			pinyin2 := guess.PinYin[i][2]
-			pinyin3 := guess.PinYin[i][3]
-			tag1 := int(guess.Tag[1][i] - 48)
-			tag2 := int(guess.Tag[2][i] - 48)
-			tag3 := int(guess.Tag[3][i] - 48)
-			if _, exists := best[pinyin1]; !exists {
-				best[pinyin1] = 0
-			}
-			if _, exists := best[pinyin2]; !exists {
-				best[pinyin2] = 0
-			}
-			if best[pinyin1] < tag1 {
-				best[pinyin1] = tag1
-			}
-			if best[pinyin2] < tag2 {
-				best[pinyin2] = tag2
-			}
-
-			dc.SetHexColor(backgroundColor[int(guess.Tag[0][i])-48])
-			dc.DrawRectangle(left+float64(i*96)+2, top+2, 94.0, 94.0)
-			dc.Fill()
-
-			dc.SetHexColor(frontColor[int(guess.Tag[0][i])-48])
-			dc.SetFontFace(face1)
-			dc.DrawStringAnchored(guess.PinYin[i][0], left+float64(i*96)+48, top+60, 0.5, 0.5)
-
-			if len(pinyin1+pinyin2+pinyin3) <= 6 {
-				dc.SetFontFace(face2)
-			} else {
-				dc.SetFontFace(face3)
-			}
-
-			w1, _ := dc.MeasureString(strings.ToUpper(pinyin1))
-			w2, _ := dc.MeasureString(strings.ToUpper(pinyin2))
-			w3, _ := dc.MeasureString(guess.PinYin[i][3])
-			w1 /= 2
-			w2 /= 2
-			w3 /= 2
-			colormap := ColorMap[int(guess.Tag[0][i]-48)]
-
-			dc.SetHexColor(colormap[tag1])
-			dc.DrawStringAnchored(strings.ToUpper(pinyin1), left+float64(i*96)+48-w2-w3, top+20, 0.5, 0.5)
-			dc.SetHexColor(colormap[tag2])
-			dc.DrawStringAnchored(strings.ToUpper(pinyin2), left+float64(i*96)+48+w1-w3, top+20, 0.5, 0.5)
-			dc.SetHexColor(colormap[tag3])
-			dc.DrawStringAnchored(pinyin3, left+float64(i*96)+48+w1+w2, top+20, 0.5, 0.5)
-		}
-		top += 96
-
-		if top == 1536 {
-			left += float64(96*size) + 8
-			top = 0
-		}
-	}
-
-	part := []string{
-		"b", "c", "ch", "d", "f", "g", "h", "j", "k", "l", "m", "n", "p", "q", "r", "s", "sh", "t", "w", "x", "y", "z", "zh",
-		"",
-		"a", "ai", "an", "ang", "ao",
-		"e", "ei", "en", "eng", "er",
-		"i", "ia", "ian", "iang", "iao", "ie", "in", "ing", "iong", "iu",
-		"o", "ong", "ou",
-		"u", "ua", "uai", "uan", "uang", "ue", "ui", "un", "uo",
-		"v", "ve",
-	}
-	face4, err := gg.LoadFontFace(filePath2, 15)
-	if err != nil {
-		panic(err)
-	}
-	defer face4.Close()
-
-	colormap2 := []string{"#5d6572", "#de7525", "#1d9c9c"}
-
-	for i, v := range part {
-		j := i % (size * 2)
-		k := math.Floor(float64(i) / float64(size*2))
-
-		if top+k*24 == 1536 {
-			left += 96*float64(size) + 8
-			top = -k * 24
-		}
-
-		vLen := len(v)
-		if vLen > 0 {
-			if vLen <= 3 {
-				dc.SetFontFace(face3)
-			} else {
-				dc.SetFontFace(face4)
-			}
-
-			if v, exists := best[part[i]]; exists {
-				dc.SetHexColor(colormap2[v])
-				dc.DrawRectangle(left+float64(j)*48+1, top+k*24+1, 46, 22)
-				dc.Fill()
-				dc.SetHexColor("#ffffff")
-				dc.DrawStringAnchored(strings.ToUpper(part[i]), left+float64(j)*48+24, top+k*24+12, 0.5, 0.5)
-			} else {
-				dc.SetHexColor("#5d6572")
-				dc.DrawRectangle(left+float64(j)*48+2, top+k*24+2, 46, 22)
-				dc.Fill()
-				dc.SetHexColor("#ffffff")
-				dc.DrawRectangle(left+float64(j)*48+1, top+k*24+1, 46, 22)
-				dc.Fill()
-				dc.SetHexColor("#5d6572")
-				dc.DrawStringAnchored(strings.ToUpper(part[i]), left+float64(j)*48+24, top+k*24+12, 0.5, 0.5)
-			}
-		}
-	}
-
-	boardImage = new(bytes.Buffer)
-	err = png.Encode(boardImage, dc.Image())
-	return
-}
-
-func pinYinMatch(game *Game, guessPinYin, targetPinYin [][4]string) (tag [4]string) {
+func pinYinMatch(guessPinYin, targetPinYin [][4]string) (tag [4]string) {
 	for i := 0; i < 4; i++ {
 		var guessCounts map[string]int = make(map[string]int)
 		var answerCounts map[string]int = make(map[string]int)
 		var pos []int
-		for j := 0; j < len([]rune(game.Answer.Word.Text)); j++ {
+		for j := 0; j < len(targetPinYin); j++ {
 			if guessPinYin[j][i] == targetPinYin[j][i] {
 				pos = append(pos, 0)
 			} else {
@@ -534,7 +390,7 @@ func pinYinMatch(game *Game, guessPinYin, targetPinYin [][4]string) (tag [4]stri
 			}
 		}
 
-		for j := 0; j < len([]rune(game.Answer.Word.Text)); j++ {
+		for j := 0; j < len(targetPinYin); j++ {
 			if pos[j] > 0 {
 				if v, exists := answerCounts[guessPinYin[j][i]]; exists && pos[j] <= v {
 					tag[i] += "1"
@@ -548,31 +404,3 @@ func pinYinMatch(game *Game, guessPinYin, targetPinYin [][4]string) (tag [4]stri
 	}
 	return
 }
-
-var rePinYinElements = regexp.MustCompile(`^([bcdfghjklmnpqrstwxyz]|ch|sh|zh|)([aeiouv]+(?:n|ng|)|n|ng|er)(\d?)$`)
-
-func makePinYin(word string) (result [][4]string) {
-	pinYinSymbols := pinyin.Pinyin(word, pinyinArgs)
-	if len(pinYinSymbols) == len([]rune(word)) {
-		for i, w := range []rune(word) {
-			if rePinYinElements.MatchString(pinYinSymbols[i][0]) {
-				match := rePinYinElements.FindStringSubmatch(pinYinSymbols[i][0])
-
-				if match[2] == "n" {
-					match[2] = "en"
-				}
-
-				if match[2] == "ng" {
-					match[2] = "eng"
-				}
-
-				result = append(result, [4]string{string(w), match[1], match[2], match[3]})
-			}
-		}
-	}
-	log.Log.WithFields(logrus.Fields{
-		"event":         "Handle Game MakePinYin",
-		"PinYinSymbols": result,
-	}).Debugln("MakePinYin")
-	return
-}
@@ -0,0 +1,260 @@
+package idiomchain
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	gamesession "github.com/doylecnn/qqbot/game_session"
+	hanyuwordle "github.com/doylecnn/qqbot/hanyu_wordle"
+	"github.com/doylecnn/qqbot/log"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// turnTimeout 这么久没人接上就结束
+const turnTimeout = 60 * time.Second
+
+type idiomIndex struct {
+	idioms       map[string]bool
+	byChar       map[rune][]string
+	bySyllable   map[string][]string
+	lastSyllable map[string]string
+	once         sync.Once
+}
+
+var index = idiomIndex{
+	idioms:       make(map[string]bool),
+	byChar:       make(map[rune][]string),
+	bySyllable:   make(map[string][]string),
+	lastSyllable: make(map[string]string),
+}
+
+// syllable 不带声调的拼音，宽松模式下同音就能接
+func syllable(p [4]string) string {
+	return p[1] + p[2]
+}
+
+func (idx *idiomIndex) init() {
+	idx.once.Do(func() {
+		for _, w := range hanyuwordle.DictionaryWords("成语") {
+			runes := []rune(w.Text)
+			if idx.idioms[w.Text] || len(runes) < 4 {
+				continue
+			}
+			idx.idioms[w.Text] = true
+			idx.byChar[runes[0]] = append(idx.byChar[runes[0]], w.Text)
+			if py := hanyuwordle.PinYin(w.Text); len(py) == len(runes) {
+				first := syllable(py[0])
+				idx.bySyllable[first] = append(idx.bySyllable[first], w.Text)
+				idx.lastSyllable[w.Text] = syllable(py[len(py)-1])
+			}
+		}
+		log.Log.WithFields(logrus.Fields{
+			"event": "Idiom Chain Init",
+			"Count": len(idx.idioms),
+		}).Infoln("加载成语")
+	})
+}
+
+// follows 判断 next 能不能接在 prev 后面
+func (idx *idiomIndex) follows(prev, next string, lenient bool) bool {
+	prevRunes, nextRunes := []rune(prev), []rune(next)
+	if prevRunes[len(prevRunes)-1] == nextRunes[0] {
+		return true
+	}
+	if !lenient {
+		return false
+	}
+	last, exists := idx.lastSyllable[prev]
+	if !exists {
+		return false
+	}
+	py := hanyuwordle.PinYin(next)
+	return len(py) == len(nextRunes) && syllable(py[0]) == last
+}
+
+// continuations 能接在 prev 后面并且还没用过的成语
+func (idx *idiomIndex) continuations(prev string, lenient bool, used map[string]bool) (result []string) {
+	runes := []rune(prev)
+	candidates := idx.byChar[runes[len(runes)-1]]
+	if lenient {
+		candidates = append(append([]string{}, candidates...), idx.bySyllable[idx.lastSyllable[prev]]...)
+	}
+	for _, c := range candidates {
+		if !used[c] {
+			result = append(result, c)
+		}
+	}
+	return
+}
+
+const gameName = "成语接龙"
+
+type chain struct {
+	Lenient bool
+	Last    string
+	used    map[string]bool
+}
+
+// chainOf 当前聊天正在进行的接龙
+func chainOf(ctx *zero.Ctx) (*gamesession.Session, *chain, bool) {
+	s, exists := gamesession.Sessions.Get(ctx)
+	if !exists {
+		return nil, nil, false
+	}
+	game, ok := s.Game.(*chain)
+	return s, game, ok
+}
+
+// play 接上一个成语，userID 为 0 表示 bot 接的，不计分
+func (game *chain) play(s *gamesession.Session, idiom string, userID int64, name string) {
+	game.Last = idiom
+	game.used[idiom] = true
+	if userID != 0 {
+		s.AddScore(userID, name, 1)
+	}
+}
+
+func (game *chain) scoreboard(s *gamesession.Session) string {
+	return fmt.Sprintf("一共接了 %d 个，%s", len(game.used), s.Scoreboard())
+}
+
+// Command 成语接龙：/chain [宽松] 开始，/chain hint 提示，/chain pass 让 bot 接，/chain stop 结束
+func Command(ctx *zero.Ctx) {
+	args := ""
+	if v, ok := ctx.State["args"].(string); ok {
+		args = strings.ToLower(strings.TrimSpace(v))
+	}
+	index.init()
+	switch args {
+	case "", "lenient", "宽松":
+		start(ctx, args != "")
+	case "hint", "提示":
+		hint(ctx, false)
+	case "pass", "bot", "跳过":
+		hint(ctx, true)
+	case "stop", "结束":
+		if _, _, exists := chainOf(ctx); exists {
+			gamesession.Sessions.Stop(ctx)
+		}
+	default:
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("用法：/chain [宽松] 开始，宽松模式下同音字也能接\n/chain hint 提示，/chain pass 让 bot 接，/chain stop 结束")))
+	}
+	ctx.Block()
+}
+
+func start(ctx *zero.Ctx, lenient bool) {
+	if len(index.idioms) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("没有找到成语词典……")))
+		return
+	}
+	game := &chain{Lenient: lenient, used: make(map[string]bool)}
+	if s, err := gamesession.Sessions.Start(ctx, gameName, game, turnTimeout); err != nil {
+		if s != nil && s.Name == gameName {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("已经在接龙啦")))
+		} else {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err.Error())))
+		}
+	}
+}
+
+func (game *chain) Start(ctx *zero.Ctx, s *gamesession.Session) {
+	// 开局的成语尽量选接得下去的
+	first := randomIdiom()
+	for i := 0; i < 100 && len(index.continuations(first, game.Lenient, nil)) == 0; i++ {
+		first = randomIdiom()
+	}
+	game.play(s, first, 0, "")
+	mode := "严格模式：首字要和上一个的尾字相同"
+	if game.Lenient {
+		mode = "宽松模式：首字和上一个的尾字同音就行"
+	}
+	log.Log.WithFields(logrus.Fields{
+		"event":     "Idiom Chain Start",
+		"First":     first,
+		"Lenient":   game.Lenient,
+		"QQGroupId": ctx.Event.GroupID,
+	}).Infoln("成语接龙开始")
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("成语接龙开始！%s，%s 内没人接上就结束\n第一个：%s", mode, turnTimeout, first))))
+}
+
+func randomIdiom() string {
+	n := rand.Intn(len(index.idioms))
+	for idiom := range index.idioms {
+		if n == 0 {
+			return idiom
+		}
+		n--
+	}
+	return ""
+}
+
+// hint 提示一个能接的成语，takeTurn 为真时 bot 直接接上
+func hint(ctx *zero.Ctx, takeTurn bool) {
+	s, game, exists := chainOf(ctx)
+	if !exists {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("现在没有在接龙，/chain 开一局")))
+		return
+	}
+	s.Do(func() {
+		candidates := index.continuations(game.Last, game.Lenient, game.used)
+		if len(candidates) == 0 {
+			s.End()
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("「%s」bot 也接不下去了，接龙结束\n%s", game.Last, game.scoreboard(s)))))
+			return
+		}
+		idiom := candidates[rand.Intn(len(candidates))]
+		if !takeTurn {
+			runes := []rune(idiom)
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("可以试试：%s%s", string(runes[:2]), strings.Repeat("○", len(runes)-2)))))
+			return
+		}
+		game.play(s, idiom, 0, "")
+		if len(index.continuations(idiom, game.Lenient, game.used)) == 0 {
+			s.End()
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("bot 接：%s，已经没有成语能接下去了，接龙结束\n%s", idiom, game.scoreboard(s)))))
+			return
+		}
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("bot 接：%s", idiom))))
+	})
+}
+
+// Input 检查每条中文消息，是词典里的成语才算数
+func (game *chain) Input(ctx *zero.Ctx, s *gamesession.Session) bool {
+	idiom := strings.TrimSpace(ctx.MessageString())
+	if !index.idioms[idiom] {
+		return false
+	}
+	if game.used[idiom] {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(idiom+" 已经用过啦")))
+		return true
+	}
+	if !index.follows(game.Last, idiom, game.Lenient) {
+		runes := []rune(game.Last)
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("接不上哦，要接「%s」的「%s」", game.Last, string(runes[len(runes)-1])))))
+		return true
+	}
+	name := ctx.CardOrNickName(ctx.Event.UserID)
+	game.play(s, idiom, ctx.Event.UserID, name)
+	if len(index.continuations(idiom, game.Lenient, game.used)) == 0 {
+		s.End()
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("%s 接上了「%s」，已经没有成语能接下去了，接龙结束\n%s", name, idiom, game.scoreboard(s)))))
+	} else {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("%s 接上了，得 1 分，现在是「%s」", name, idiom))))
+	}
+	return true
+}
+
+func (game *chain) Timeout(ctx *zero.Ctx, s *gamesession.Session) bool {
+	ctx.Send(message.Text(fmt.Sprintf("%s 没人接得上，成语接龙结束\n%s", turnTimeout, game.scoreboard(s))))
+	return false
+}
+
+func (game *chain) Stop(ctx *zero.Ctx, s *gamesession.Session) bool {
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("成语接龙结束\n"+game.scoreboard(s))))
+	return true
+}
@@ -0,0 +1,40 @@
+package idiomchain
+
+import "testing"
+
+func TestFollows(t *testing.T) {
+	index.init()
+	cases := []struct {
+		prev, next string
+		lenient    bool
+		want       bool
+	}{
+		{"一目了然", "然而不然", false, true},
+		{"一目了然", "全力以赴", false, false},
+		{"坚定不移", "移花接木", false, true},
+		{"全力以赴", "赴汤蹈火", false, true},
+		{"全力以赴", "富国强兵", false, false},
+		{"全力以赴", "富国强兵", true, true},
+		{"全力以赴", "福如东海", true, true},
+		{"全力以赴", "一目了然", true, false},
+	}
+	for _, c := range cases {
+		if got := index.follows(c.prev, c.next, c.lenient); got != c.want {
+			t.Errorf("follows(%s, %s, %v) = %v, want %v", c.prev, c.next, c.lenient, got, c.want)
+		}
+	}
+}
+
+func TestContinuations(t *testing.T) {
+	index.init()
+	used := map[string]bool{}
+	for _, idiom := range index.continuations("坚定不移", false, used) {
+		if []rune(idiom)[0] != '移' {
+			t.Errorf("continuation %s does not start with 移", idiom)
+		}
+		used[idiom] = true
+	}
+	if got := index.continuations("坚定不移", false, used); len(got) != 0 {
+		t.Errorf("used idioms should be skipped, got %v", got)
+	}
+}
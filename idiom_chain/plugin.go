@@ -0,0 +1,29 @@
+package idiomchain
+
+import (
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	zero "github.com/wdvxdr1123/ZeroBot"
+)
+
+// Plugin 成语接龙
+type Plugin struct{}
+
+func (Plugin) Name() string { return "chain" }
+
+func (Plugin) Description() string { return "成语接龙：/chain" }
+
+func (Plugin) Init(config *toml.Tree, db *sqlx.DB) error { return nil }
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "chain", Usage: "/chain [宽松|hint|pass|stop]", Description: "成语接龙，宽松模式下同音字也能接，hint 提示，pass 让 bot 接", Examples: []string{"/chain", "/chain 宽松"}},
+	}
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnCommand("chain").Handle(Command)
+}
+
+func (Plugin) Shutdown() {}
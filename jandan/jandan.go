@@ -0,0 +1,107 @@
+package jandan
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+
+	"github.com/PuerkitoBio/goquery"
+	mylog "github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// Plugin 煎蛋无聊图
+type Plugin struct{}
+
+func (Plugin) Name() string { return "jandan" }
+
+func (Plugin) Description() string { return "煎蛋无聊图：/无聊图" }
+
+func (Plugin) Init(config *toml.Tree, db *sqlx.DB) error { return nil }
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "无聊图", Usage: "/无聊图", Description: "随机发一组煎蛋网的无聊图"},
+	}
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnCommand("无聊图").Handle(func(ctx *zero.Ctx) {
+		if err := Send(ctx); err != nil {
+			mylog.Log.WithFields(logrus.Fields{
+				"event": "Boring Pic",
+				"call":  "jandanpic",
+				"err":   err,
+			}).Warningln("无聊图 error")
+		}
+	})
+}
+
+func (Plugin) Shutdown() {}
+
+// Send 随机发一组无聊图和帖子链接
+func Send(ctx *zero.Ctx) error {
+	thread_url, pic_urls, err := jandanpic()
+	if err != nil {
+		return err
+	}
+	var msgs []message.MessageSegment
+	for i := 0; i < len(pic_urls); i++ {
+		msgs = append(msgs, message.Image(pic_urls[i]))
+	}
+	msgs = append(msgs, message.Text(thread_url))
+	ctx.SendChain(msgs...)
+	return nil
+}
+
+// topURL 煎蛋热榜，测试时换成本地的服务器
+var topURL = "https://jandan.net/top"
+
+func jandanpic() (string, []string, error) {
+	req, err := http.NewRequest("GET", topURL, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/89.0.4389.90 Safari/537.36")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	if resp.StatusCode != 200 {
+		return "", nil, errors.New(resp.Status)
+	}
+	d, err := goquery.NewDocumentFromReader(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return "", nil, err
+	}
+	var boringPics [][]string
+	var boringUrls []string
+	d.Find("ol.commentlist li").Each(func(_ int, s *goquery.Selection) {
+		var picurls []string
+		s.Find("div.text p img").Each(func(_ int, img *goquery.Selection) {
+			if v, exists := img.Attr("org_src"); exists {
+				picurls = append(picurls, "https:"+v)
+			} else if v, exists := img.Attr("src"); exists {
+				picurls = append(picurls, "https:"+v)
+			}
+		})
+		if len(picurls) > 0 {
+			// 帖子链接和图片要一一对应，没有链接也占个位置
+			v, _ := s.Find("div.text span.righttext a").Attr("href")
+			boringPics = append(boringPics, picurls)
+			boringUrls = append(boringUrls, "https://jandan.net"+v)
+		}
+	})
+	if len(boringPics) > 0 {
+		var randIdx = rand.Intn(len(boringPics))
+		return boringUrls[randIdx], boringPics[randIdx], nil
+	} else {
+		return "", nil, errors.New("no boring picture")
+	}
+}
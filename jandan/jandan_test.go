@@ -0,0 +1,33 @@
+package jandan
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestJanDanPic(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer srv.Close()
+	defer func(u string) { topURL = u }(topURL)
+	topURL = srv.URL + "/top.html"
+
+	thread, pics, err := jandanpic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有图的帖子不算
+	if want := "https://jandan.net/t/5123456"; thread != want {
+		t.Errorf("thread = %q, want %q", thread, want)
+	}
+	want := []string{"https://wx1.sinaimg.cn/mw2000/0001.gif", "https://wx2.sinaimg.cn/mw600/0002.jpg"}
+	if !reflect.DeepEqual(pics, want) {
+		t.Errorf("pics = %q, want %q", pics, want)
+	}
+
+	topURL = srv.URL + "/missing.html"
+	if _, _, err := jandanpic(); err == nil {
+		t.Error("missing page: err = nil")
+	}
+}
@@ -1,10 +0,0 @@
-package main
-
-import (
-	"log"
-	"testing"
-)
-
-func TestJanDanPic(t *testing.T) {
-	log.Println(jandanpic())
-}
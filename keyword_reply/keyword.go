@@ -0,0 +1,127 @@
+package keywordreply
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doylecnn/qqbot/jandan"
+	mylog "github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+var (
+	db             *sqlx.DB
+	groupcdseconds time.Duration
+
+	groupLastActive = struct {
+		times map[int64]time.Time
+		mux   sync.Mutex
+	}{times: make(map[int64]time.Time)}
+)
+
+// Plugin 关键词自动回复，放在最后注册，其他模块没有拦下的群消息才会走到这里
+type Plugin struct{}
+
+func (Plugin) Name() string { return "keyword" }
+
+func (Plugin) Description() string { return "关键词自动回复，回复内容在 replies 表里" }
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "关键词回复", Usage: "（自动）", Description: "群里说到设置过的关键词时随机回复一句", GroupOnly: true},
+	}
+}
+
+func (Plugin) Init(config *toml.Tree, database *sqlx.DB) error {
+	db = database
+	if config == nil {
+		return nil
+	}
+	if cd, ok := config.Get("robirt.groupcdtime").(string); ok {
+		var err error
+		if groupcdseconds, err = time.ParseDuration(cd); err != nil {
+			mylog.Log.WithFields(logrus.Fields{
+				"event": "Start",
+				"err":   err,
+			}).Warningln("ParseDuration error")
+		}
+	}
+	return nil
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnMessage(zero.OnlyGroup).Handle(onGroupMessage)
+}
+
+func (Plugin) Shutdown() {}
+
+// cooling 更新群的活跃时间，返回 true 表示不回复
+func cooling(groupID int64) bool {
+	groupLastActive.mux.Lock()
+	defer groupLastActive.mux.Unlock()
+	if time.Until(groupLastActive.times[groupID].Add(groupcdseconds)).Seconds() <= 0 {
+		return true
+	}
+	groupLastActive.times[groupID] = time.Now()
+	return false
+}
+
+func onGroupMessage(ctx *zero.Ctx) {
+	var msg = ctx.MessageString()
+
+	if cooling(ctx.Event.GroupID) {
+		return
+	}
+
+	if msg == "&#91;视频&#93;你的QQ暂不支持查看视频短片, 请升级到最新版本后查看。" ||
+		msg == "&#91;闪照&#93;请使用新版手机QQ查看闪照。" ||
+		strings.Contains(msg, "[CQ::rich,text=") {
+		return
+	}
+
+	if strings.Contains(msg, "[CQ:image,file=") ||
+		strings.Contains(msg, "[CQ:at,qq=") {
+		return
+	}
+
+	if len([]rune(msg)) < 2 {
+		return
+	}
+
+	ns, err := db.PrepareNamed(`SELECT distinct reply FROM replies where group_number=:groupnum and length(keyword)>1 and partial_ratio(keyword,:msg)>50`)
+	if err != nil {
+		mylog.Log.WithFields(logrus.Fields{
+			"event": "onGroupMsg",
+			"call":  "PrepareNamedContext",
+			"err":   err,
+		}).Debugln("PrepareNamedContext error")
+		return
+	}
+	replies := []string{}
+	err = ns.Select(&replies, map[string]interface{}{"msg": msg, "groupnum": ctx.Event.GroupID})
+	if err != nil {
+		mylog.Log.WithFields(logrus.Fields{
+			"event": "onGroupMsg",
+			"call":  "Select",
+			"err":   err,
+		}).Warningln("when select get error")
+	}
+	if len(replies) > 0 {
+		p := rand.Int31n(6)
+		// 本群关了无聊图就不混着发了
+		if (p == 4 || (zero.SuperUserPermission(ctx) && p > 3)) && plugin.Enabled("jandan", ctx.Event.GroupID) {
+			if err := jandan.Send(ctx); err == nil {
+				return
+			}
+		}
+		replyMessage := replies[rand.Intn(len(replies))]
+		ctx.Send(message.Text(replyMessage))
+	}
+}
@@ -0,0 +1,437 @@
+// Package moderation 群管：按违禁词规则警告、撤回、禁言，违规太多次踢出，
+// 违规次数和处理记录都存在数据库里，群管理员和超级用户不受规则限制
+package moderation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	groupsettings "github.com/doylecnn/qqbot/group_settings"
+	"github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	// kickAfterKey 群设置里违规几次踢出，0 表示不踢
+	kickAfterKey = "moderation.kick_after"
+	maxKickAfter = 100
+	maxMinutes   = 30 * 24 * 60
+	logLimit     = 10
+	maxLogLimit  = 50
+	usage        = "用法：/mod [list|add 类型 违禁词 [warn|recall|mute 分钟]|del 编号|log [条数]|strikes @某人|pardon @某人|kick 次数]"
+)
+
+var (
+	db *sqlx.DB
+	// kickAfter 违规几次踢出，各群可以用 /mod kick 修改
+	kickAfter = 0
+	// strikeExpire 距离上次违规超过这么久，违规次数从头算，0 表示一直累计
+	strikeExpire = 30 * 24 * time.Hour
+	// fuzzyRatio 模糊匹配的相似度，0 到 100
+	fuzzyRatio = 75
+	// muteMinutes mute 规则没写时长时禁言几分钟
+	muteMinutes = 10
+)
+
+// Plugin 违禁词、禁言、撤回
+type Plugin struct{}
+
+func (Plugin) Name() string { return "moderation" }
+
+func (Plugin) Description() string {
+	return "群管：违禁词警告、撤回、禁言，违规多次踢出，bot 需要是群管理员"
+}
+
+func (Plugin) Init(config *toml.Tree, database *sqlx.DB) error {
+	db = database
+	rules.mux.Lock()
+	rules.byGroup = make(map[int64][]rule)
+	rules.mux.Unlock()
+	if config == nil {
+		return nil
+	}
+	if v, ok := config.Get("moderation.kick_after").(int64); ok {
+		if v < 0 || v > maxKickAfter {
+			return fmt.Errorf("moderation.kick_after 要在 0 到 %d 之间", maxKickAfter)
+		}
+		kickAfter = int(v)
+	}
+	if s, ok := config.Get("moderation.strike_expire").(string); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("moderation.strike_expire：%w", err)
+		}
+		strikeExpire = d
+	}
+	if v, ok := config.Get("moderation.fuzzy_ratio").(int64); ok {
+		if v < 1 || v > 100 {
+			return fmt.Errorf("moderation.fuzzy_ratio 要在 1 到 100 之间")
+		}
+		fuzzyRatio = int(v)
+	}
+	if v, ok := config.Get("moderation.mute_minutes").(int64); ok {
+		if v < 1 || v > maxMinutes {
+			return fmt.Errorf("moderation.mute_minutes 要在 1 到 %d 之间", maxMinutes)
+		}
+		muteMinutes = int(v)
+	}
+	return nil
+}
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "违禁词", Usage: "（自动）", Description: "群友的消息命中违禁词时按规则警告、撤回或禁言，违规太多次会被踢出", GroupOnly: true},
+		{Name: "mod", Usage: "/mod [list]", Description: "查看本群的违禁词规则", Permission: plugin.Admin, GroupOnly: true},
+		{Name: "mod add", Usage: "/mod add plain|regex|fuzzy 违禁词 [warn|recall|mute 分钟]", Description: "添加违禁词规则，plain 包含、regex 正则、fuzzy 模糊匹配，默认只警告", Examples: []string{"/mod add plain 广告", "/mod add regex 加.?群 recall", "/mod add fuzzy 代开发票 mute 60"}, Permission: plugin.Admin, GroupOnly: true},
+		{Name: "mod del", Usage: "/mod del 编号", Description: "删除违禁词规则", Permission: plugin.Admin, GroupOnly: true},
+		{Name: "mod log", Usage: "/mod log [条数]", Description: "查看最近的处理记录", Permission: plugin.Admin, GroupOnly: true},
+		{Name: "mod strikes", Usage: "/mod strikes @某人|QQ号", Description: "查看某人的违规次数", Permission: plugin.Admin, GroupOnly: true},
+		{Name: "mod pardon", Usage: "/mod pardon @某人|QQ号", Description: "清除某人的违规次数", Permission: plugin.Admin, GroupOnly: true},
+		{Name: "mod kick", Usage: "/mod kick 次数", Description: "违规几次踢出本群，0 表示不踢", Permission: plugin.Admin, GroupOnly: true},
+	}
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnCommand("mod", zero.OnlyGroup, zero.AdminPermission).Handle(Command)
+	engine.OnMessage(zero.OnlyGroup).Handle(onGroupMessage)
+}
+
+func (Plugin) Shutdown() {}
+
+func groupKickAfter(groupID int64) int {
+	if v, err := strconv.Atoi(groupsettings.Get(groupID, kickAfterKey, "")); err == nil {
+		return v
+	}
+	return kickAfter
+}
+
+func name(ctx *zero.Ctx, qq int64) string {
+	if n := ctx.CardOrNickName(qq); n != "" {
+		return n
+	}
+	return strconv.FormatInt(qq, 10)
+}
+
+func logError(groupID int64, call string, err error) {
+	log.Log.WithFields(logrus.Fields{
+		"event":     "Moderation",
+		"call":      call,
+		"err":       err,
+		"QQGroupId": groupID,
+	}).Warningln("群管操作失败")
+}
+
+// onGroupMessage 命中规则的消息按最重的规则处理，拦下不再给其他模块
+func onGroupMessage(ctx *zero.Ctx) {
+	if db == nil || zero.AdminPermission(ctx) {
+		return
+	}
+	text := strings.TrimSpace(ctx.ExtractPlainText())
+	if text == "" {
+		return
+	}
+	groupID := ctx.Event.GroupID
+	rs, err := groupRules(groupID)
+	if err != nil {
+		logError(groupID, "groupRules", err)
+		return
+	}
+	r, hit := strictest(rs, text)
+	if !hit {
+		return
+	}
+	defer ctx.Block()
+	enforce(ctx, r, text, time.Now())
+}
+
+// enforce 记一次违规，按规则处理，累计次数够了就踢出
+func enforce(ctx *zero.Ctx, r rule, text string, now time.Time) {
+	groupID, qq := ctx.Event.GroupID, ctx.Event.UserID
+	n, err := addStrike(groupID, qq, now)
+	if err != nil {
+		logError(groupID, "addStrike", err)
+	}
+	who := name(ctx, qq)
+	msgID, _ := ctx.Event.MessageID.(int64)
+	if r.Action == "recall" || r.Action == "mute" {
+		ctx.DeleteMessage(message.NewMessageIDFromInteger(msgID))
+	}
+	if r.Action == "mute" {
+		ctx.SetGroupBan(groupID, qq, int64(r.Minutes)*60)
+	}
+	action := r.Action
+	if limit := groupKickAfter(groupID); limit > 0 && n >= limit {
+		action = "kick"
+		ctx.SetGroupKick(groupID, qq, false)
+		if err := clearStrikes(groupID, qq); err != nil {
+			logError(groupID, "clearStrikes", err)
+		}
+	}
+	if err := writeLog(entry{Group: groupID, QQ: qq, RuleID: r.ID, Action: action, Message: text, Time: now.Unix()}); err != nil {
+		logError(groupID, "writeLog", err)
+	}
+	log.Log.WithFields(logrus.Fields{
+		"event":     "Moderation",
+		"Rule":      r.ID,
+		"Action":    action,
+		"QQGroupId": groupID,
+		"QQ":        qq,
+	}).Infoln("违禁词")
+
+	switch action {
+	case "warn":
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("请注意言辞，这是第 %d 次违规", n))))
+	case "recall":
+		ctx.Send(message.Text(fmt.Sprintf("%s 的消息违反了本群规则，已撤回（第 %d 次违规）", who, n)))
+	case "mute":
+		ctx.Send(message.Text(fmt.Sprintf("%s 的消息违反了本群规则，已撤回并禁言 %d 分钟（第 %d 次违规）", who, r.Minutes, n)))
+	case "kick":
+		ctx.Send(message.Text(fmt.Sprintf("%s 违规 %d 次，已移出本群", who, n)))
+	}
+}
+
+func reply(ctx *zero.Ctx, text string) {
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(text)))
+}
+
+// Command /mod 管理违禁词规则、查看处理记录
+func Command(ctx *zero.Ctx) {
+	defer ctx.Block()
+	if db == nil {
+		return
+	}
+	args, _ := ctx.State["args"].(string)
+	fields := strings.Fields(args)
+	sub := "list"
+	if len(fields) > 0 {
+		sub = strings.ToLower(fields[0])
+		fields = fields[1:]
+	}
+	var err error
+	switch sub {
+	case "list":
+		err = listCommand(ctx)
+	case "add":
+		err = addCommand(ctx, fields)
+	case "del":
+		err = delCommand(ctx, fields)
+	case "log":
+		err = logCommand(ctx, fields)
+	case "strikes":
+		err = strikesCommand(ctx, fields)
+	case "pardon":
+		err = pardonCommand(ctx, fields)
+	case "kick":
+		err = kickCommand(ctx, fields)
+	default:
+		reply(ctx, usage)
+		return
+	}
+	if err != nil {
+		logError(ctx.Event.GroupID, sub, err)
+		reply(ctx, "操作失败了，稍后再试试")
+	}
+}
+
+func listCommand(ctx *zero.Ctx) error {
+	rs, err := groupRules(ctx.Event.GroupID)
+	if err != nil {
+		return err
+	}
+	if len(rs) == 0 {
+		reply(ctx, "本群还没有违禁词规则")
+		return nil
+	}
+	lines := make([]string, len(rs))
+	for i, r := range rs {
+		lines[i] = r.String()
+	}
+	text := "本群的违禁词规则：\n" + strings.Join(lines, "\n")
+	if limit := groupKickAfter(ctx.Event.GroupID); limit > 0 {
+		text += fmt.Sprintf("\n违规 %d 次踢出", limit)
+	}
+	reply(ctx, text)
+	return nil
+}
+
+// addCommand /mod add 类型 违禁词 [warn|recall|mute 分钟]
+func addCommand(ctx *zero.Ctx, fields []string) error {
+	if len(fields) < 2 || len(fields) > 4 {
+		reply(ctx, "用法：/mod add plain|regex|fuzzy 违禁词 [warn|recall|mute 分钟]")
+		return nil
+	}
+	r := rule{Group: ctx.Event.GroupID, Type: strings.ToLower(fields[0]), Pattern: fields[1], Action: "warn"}
+	if len(fields) > 2 {
+		r.Action = strings.ToLower(fields[2])
+	}
+	if r.Action == "mute" {
+		r.Minutes = muteMinutes
+		if len(fields) > 3 {
+			m, err := strconv.Atoi(fields[3])
+			if err != nil || m < 1 || m > maxMinutes {
+				reply(ctx, fmt.Sprintf("禁言时长要在 1 到 %d 分钟之间", maxMinutes))
+				return nil
+			}
+			r.Minutes = m
+		}
+	} else if len(fields) > 3 {
+		reply(ctx, "只有 mute 可以写时长")
+		return nil
+	}
+	if err := r.compile(); err != nil {
+		reply(ctx, err.Error())
+		return nil
+	}
+	id, err := addRule(r, ctx.Event.UserID, time.Now())
+	if err != nil {
+		return err
+	}
+	r.ID = id
+	reply(ctx, "已添加 "+r.String())
+	return nil
+}
+
+func delCommand(ctx *zero.Ctx, fields []string) error {
+	if len(fields) != 1 {
+		reply(ctx, "用法：/mod del 编号")
+		return nil
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(fields[0], "#"), 10, 64)
+	if err != nil {
+		reply(ctx, "用法：/mod del 编号")
+		return nil
+	}
+	deleted, err := deleteRule(ctx.Event.GroupID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		reply(ctx, fmt.Sprintf("本群没有 #%d 这条规则", id))
+		return nil
+	}
+	reply(ctx, fmt.Sprintf("已删除 #%d", id))
+	return nil
+}
+
+func formatTime(t int64, now time.Time) string {
+	tm := time.Unix(t, 0)
+	if tm.Year() != now.Year() {
+		return tm.Format("2006-01-02 15:04")
+	}
+	return tm.Format("01-02 15:04")
+}
+
+func logCommand(ctx *zero.Ctx, fields []string) error {
+	limit := logLimit
+	if len(fields) > 0 {
+		n, err := strconv.Atoi(fields[0])
+		if err != nil || n < 1 || n > maxLogLimit {
+			reply(ctx, fmt.Sprintf("条数要在 1 到 %d 之间", maxLogLimit))
+			return nil
+		}
+		limit = n
+	}
+	entries, err := recentLog(ctx.Event.GroupID, limit)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		reply(ctx, "本群还没有处理记录")
+		return nil
+	}
+	now := time.Now()
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		line := fmt.Sprintf("%s %s %s", formatTime(e.Time, now), name(ctx, e.QQ), actionNames[e.Action])
+		if e.Operator != 0 {
+			line += "（" + name(ctx, e.Operator) + "）"
+		}
+		if e.RuleID != 0 {
+			line += fmt.Sprintf(" 规则#%d：%s", e.RuleID, e.Message)
+		}
+		lines[i] = line
+	}
+	reply(ctx, "最近的处理记录：\n"+strings.Join(lines, "\n"))
+	return nil
+}
+
+// target 指令里 @ 的人，没有 @ 就用写的 QQ 号
+func target(ctx *zero.Ctx, fields []string) (int64, bool) {
+	for _, seg := range ctx.Event.Message {
+		if seg.Type != "at" {
+			continue
+		}
+		if qq, err := strconv.ParseInt(seg.Data["qq"], 10, 64); err == nil {
+			return qq, true
+		}
+	}
+	if len(fields) == 1 {
+		if qq, err := strconv.ParseInt(fields[0], 10, 64); err == nil && qq > 0 {
+			return qq, true
+		}
+	}
+	return 0, false
+}
+
+func strikesCommand(ctx *zero.Ctx, fields []string) error {
+	qq, ok := target(ctx, fields)
+	if !ok {
+		reply(ctx, "用法：/mod strikes @某人|QQ号")
+		return nil
+	}
+	n, err := strikes(ctx.Event.GroupID, qq, time.Now())
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("%s 目前违规 %d 次", name(ctx, qq), n)
+	if limit := groupKickAfter(ctx.Event.GroupID); limit > 0 {
+		text += fmt.Sprintf("，%d 次踢出", limit)
+	}
+	reply(ctx, text)
+	return nil
+}
+
+func pardonCommand(ctx *zero.Ctx, fields []string) error {
+	qq, ok := target(ctx, fields)
+	if !ok {
+		reply(ctx, "用法：/mod pardon @某人|QQ号")
+		return nil
+	}
+	groupID := ctx.Event.GroupID
+	if err := clearStrikes(groupID, qq); err != nil {
+		return err
+	}
+	if err := writeLog(entry{Group: groupID, QQ: qq, Action: "pardon", Operator: ctx.Event.UserID, Time: time.Now().Unix()}); err != nil {
+		logError(groupID, "writeLog", err)
+	}
+	reply(ctx, "已清除 "+name(ctx, qq)+" 的违规次数")
+	return nil
+}
+
+func kickCommand(ctx *zero.Ctx, fields []string) error {
+	if len(fields) != 1 {
+		reply(ctx, "用法：/mod kick 次数")
+		return nil
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n < 0 || n > maxKickAfter {
+		reply(ctx, fmt.Sprintf("次数要在 0 到 %d 之间", maxKickAfter))
+		return nil
+	}
+	if err := groupsettings.Set(ctx.Event.GroupID, kickAfterKey, strconv.Itoa(n)); err != nil {
+		return err
+	}
+	if n == 0 {
+		reply(ctx, "好的，违规多少次都不踢出")
+	} else {
+		reply(ctx, fmt.Sprintf("好的，违规 %d 次踢出本群", n))
+	}
+	return nil
+}
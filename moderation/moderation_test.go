@@ -0,0 +1,134 @@
+package moderation
+
+import (
+	"testing"
+	"time"
+
+	testdb "github.com/doylecnn/qqbot/test_db"
+)
+
+func useTestDB(t *testing.T) {
+	db = testdb.New(t)
+	t.Cleanup(func() {
+		db = nil
+		rules.mux.Lock()
+		rules.byGroup = make(map[int64][]rule)
+		rules.mux.Unlock()
+	})
+}
+
+func TestRuleMatch(t *testing.T) {
+	tests := []struct {
+		rule rule
+		text string
+		want bool
+	}{
+		{rule{Type: plainRule, Pattern: "广告"}, "收广告位", true},
+		{rule{Type: plainRule, Pattern: "VPN"}, "有没有好用的vpn", true},
+		{rule{Type: plainRule, Pattern: "广告"}, "广 告", false},
+		{rule{Type: regexRule, Pattern: `加.?群`}, "快来加我群", true},
+		{rule{Type: regexRule, Pattern: `^\d{6,}$`}, "群号 123456", false},
+		{rule{Type: fuzzyRule, Pattern: "代开发票"}, "代开法票哦", true},
+		{rule{Type: fuzzyRule, Pattern: "代开发票"}, "代 开 发 票", true},
+		{rule{Type: fuzzyRule, Pattern: "代开发票"}, "今天天气不错", false},
+		// 消息比违禁词短不算
+		{rule{Type: fuzzyRule, Pattern: "代开发票"}, "发票", false},
+	}
+	for _, tt := range tests {
+		tt.rule.Action = "warn"
+		if err := tt.rule.compile(); err != nil {
+			t.Fatalf("compile(%q): %v", tt.rule.Pattern, err)
+		}
+		if got := tt.rule.match(tt.text); got != tt.want {
+			t.Errorf("[%s] %q match %q = %v, want %v", tt.rule.Type, tt.rule.Pattern, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	for _, r := range []rule{
+		{Type: "glob", Pattern: "广告", Action: "warn"},
+		{Type: regexRule, Pattern: "(", Action: "warn"},
+		{Type: fuzzyRule, Pattern: "广", Action: "warn"},
+		{Type: plainRule, Pattern: "广告", Action: "ban"},
+	} {
+		if err := r.compile(); err == nil {
+			t.Errorf("compile(%+v) = nil, want error", r)
+		}
+	}
+}
+
+func TestStrictest(t *testing.T) {
+	rs := []rule{
+		{ID: 1, Type: plainRule, Pattern: "广告", Action: "warn"},
+		{ID: 2, Type: plainRule, Pattern: "加群", Action: "mute", Minutes: 10},
+		{ID: 3, Type: plainRule, Pattern: "广告", Action: "recall"},
+		{ID: 4, Type: plainRule, Pattern: "群", Action: "mute", Minutes: 60},
+	}
+	if r, ok := strictest(rs, "看广告"); !ok || r.ID != 3 {
+		t.Errorf("strictest(看广告) = #%d %v, want #3", r.ID, ok)
+	}
+	if r, ok := strictest(rs, "广告加群"); !ok || r.ID != 4 {
+		t.Errorf("strictest(广告加群) = #%d %v, want #4", r.ID, ok)
+	}
+	if _, ok := strictest(rs, "你好"); ok {
+		t.Error("strictest(你好) hit")
+	}
+}
+
+func TestStrikes(t *testing.T) {
+	useTestDB(t)
+	defer func(d time.Duration) { strikeExpire = d }(strikeExpire)
+	strikeExpire = time.Hour
+	now := time.Now()
+	for i, want := range []int{1, 2, 3} {
+		if n, err := addStrike(1, 100, now.Add(time.Duration(i)*time.Minute)); err != nil || n != want {
+			t.Fatalf("addStrike #%d = %d, %v, want %d", i+1, n, err, want)
+		}
+	}
+	if n, _ := addStrike(2, 100, now); n != 1 {
+		t.Errorf("addStrike in another group = %d, want 1", n)
+	}
+	// 过期后从头算
+	later := now.Add(3 * time.Hour)
+	if n, _ := strikes(1, 100, later); n != 0 {
+		t.Errorf("strikes after expire = %d, want 0", n)
+	}
+	if n, _ := addStrike(1, 100, later); n != 1 {
+		t.Errorf("addStrike after expire = %d, want 1", n)
+	}
+	if err := clearStrikes(1, 100); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := strikes(1, 100, later); n != 0 {
+		t.Errorf("strikes after clear = %d, want 0", n)
+	}
+}
+
+func TestGroupRules(t *testing.T) {
+	useTestDB(t)
+	now := time.Now()
+	id, err := addRule(rule{Group: 1, Type: regexRule, Pattern: "加.?群", Action: "recall"}, 100, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 数据库里坏掉的规则直接跳过
+	db.MustExec(`INSERT INTO moderation_rules(group_number, type, pattern, action, minutes, qq_number, time) VALUES (1, 'regex', '(', 'warn', 0, 100, 0)`)
+	forgetRules(1)
+	rs, err := groupRules(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 || rs[0].ID != id || !rs[0].match("加我群") {
+		t.Fatalf("groupRules = %+v", rs)
+	}
+	if deleted, err := deleteRule(2, id); err != nil || deleted {
+		t.Errorf("deleteRule in another group = %v, %v", deleted, err)
+	}
+	if deleted, err := deleteRule(1, id); err != nil || !deleted {
+		t.Errorf("deleteRule = %v, %v", deleted, err)
+	}
+	if rs, _ := groupRules(1); len(rs) != 0 {
+		t.Errorf("groupRules after delete = %+v", rs)
+	}
+}
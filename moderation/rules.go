@@ -0,0 +1,224 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	fuzzy "github.com/doylecnn/go-fuzzywuzzy"
+)
+
+// 规则类型
+const (
+	plainRule = "plain"
+	regexRule = "regex"
+	fuzzyRule = "fuzzy"
+)
+
+// actionLevels 规则的处理方式，数字越大越重，一条消息命中多条规则时按最重的处理
+var actionLevels = map[string]int{"warn": 1, "recall": 2, "mute": 3}
+
+// actionNames 处理记录里的动作，kick 和 pardon 不是规则能选的
+var actionNames = map[string]string{
+	"warn":   "警告",
+	"recall": "撤回",
+	"mute":   "禁言",
+	"kick":   "踢出",
+	"pardon": "清除违规",
+}
+
+const maxPatternLength = 100
+
+// rule 一条违禁词规则，Minutes 只对 mute 有用
+type rule struct {
+	ID      int64  `db:"id"`
+	Group   int64  `db:"group_number"`
+	Type    string `db:"type"`
+	Pattern string `db:"pattern"`
+	Action  string `db:"action"`
+	Minutes int    `db:"minutes"`
+
+	re *regexp.Regexp
+}
+
+// compile 检查规则，正则规则顺便编译好
+func (r *rule) compile() error {
+	if r.Pattern == "" || len([]rune(r.Pattern)) > maxPatternLength {
+		return fmt.Errorf("违禁词不能为空，也不能超过 %d 个字", maxPatternLength)
+	}
+	switch r.Type {
+	case plainRule:
+	case regexRule:
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("正则表达式有误：%w", err)
+		}
+		r.re = re
+	case fuzzyRule:
+		if len([]rune(r.Pattern)) < 2 {
+			return fmt.Errorf("模糊匹配的词至少要两个字")
+		}
+	default:
+		return fmt.Errorf("规则类型只能是 plain、regex 或 fuzzy")
+	}
+	if _, exists := actionLevels[r.Action]; !exists {
+		return fmt.Errorf("处理方式只能是 warn、recall 或 mute")
+	}
+	return nil
+}
+
+// squeeze 去掉空白和标点，对付“代 开 发 票”这种
+func squeeze(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// match 消息是否命中规则：plain 不分大小写包含，regex 正则匹配，
+// fuzzy 去掉空白标点后用 PartialRatio 找相似的片段，消息比违禁词还短时不算
+func (r rule) match(text string) bool {
+	switch r.Type {
+	case plainRule:
+		return strings.Contains(strings.ToLower(text), strings.ToLower(r.Pattern))
+	case regexRule:
+		return r.re != nil && r.re.MatchString(text)
+	case fuzzyRule:
+		text = strings.ToLower(squeeze(text))
+		return len([]rune(text)) >= len([]rune(r.Pattern)) && fuzzy.PartialRatio(strings.ToLower(r.Pattern), text) >= fuzzyRatio
+	}
+	return false
+}
+
+func (r rule) String() string {
+	text := fmt.Sprintf("#%d [%s] %s → %s", r.ID, r.Type, r.Pattern, actionNames[r.Action])
+	if r.Action == "mute" {
+		text += fmt.Sprintf(" %d 分钟", r.Minutes)
+	}
+	return text
+}
+
+// strictest 命中的规则里处理最重的，一样重时取先加的
+func strictest(rules []rule, text string) (hit rule, ok bool) {
+	for _, r := range rules {
+		if !r.match(text) {
+			continue
+		}
+		if !ok || actionLevels[r.Action] > actionLevels[hit.Action] ||
+			(r.Action == "mute" && hit.Action == "mute" && r.Minutes > hit.Minutes) {
+			hit, ok = r, true
+		}
+	}
+	return
+}
+
+// rules 各群的规则缓存，增删规则后清掉
+var rules = struct {
+	byGroup map[int64][]rule
+	mux     sync.Mutex
+}{byGroup: make(map[int64][]rule)}
+
+func groupRules(groupID int64) ([]rule, error) {
+	rules.mux.Lock()
+	defer rules.mux.Unlock()
+	if rs, exists := rules.byGroup[groupID]; exists {
+		return rs, nil
+	}
+	var rs []rule
+	if err := db.Select(&rs, `SELECT id, group_number, type, pattern, action, minutes FROM moderation_rules WHERE group_number=? ORDER BY id`, groupID); err != nil {
+		return nil, err
+	}
+	valid := rs[:0]
+	for _, r := range rs {
+		if r.compile() == nil {
+			valid = append(valid, r)
+		}
+	}
+	rules.byGroup[groupID] = valid
+	return valid, nil
+}
+
+func forgetRules(groupID int64) {
+	rules.mux.Lock()
+	defer rules.mux.Unlock()
+	delete(rules.byGroup, groupID)
+}
+
+func addRule(r rule, operator int64, now time.Time) (int64, error) {
+	result, err := db.Exec(`INSERT INTO moderation_rules(group_number, type, pattern, action, minutes, qq_number, time) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		r.Group, r.Type, r.Pattern, r.Action, r.Minutes, operator, now.Unix())
+	if err != nil {
+		return 0, err
+	}
+	forgetRules(r.Group)
+	return result.LastInsertId()
+}
+
+func deleteRule(groupID, id int64) (bool, error) {
+	result, err := db.Exec(`DELETE FROM moderation_rules WHERE group_number=? AND id=?`, groupID, id)
+	if err != nil {
+		return false, err
+	}
+	forgetRules(groupID)
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// addStrike 记一次违规，返回累计次数；上次违规已经过了 strikeExpire 就从头算
+func addStrike(groupID, qq int64, now time.Time) (n int, err error) {
+	expired := int64(0)
+	if strikeExpire > 0 {
+		expired = now.Add(-strikeExpire).Unix()
+	}
+	if _, err = db.Exec(`INSERT INTO moderation_strikes(group_number, qq_number, strikes, time) VALUES (?, ?, 1, ?)
+	ON CONFLICT(group_number, qq_number) DO UPDATE SET strikes=CASE WHEN time<? THEN 1 ELSE strikes+1 END, time=excluded.time`,
+		groupID, qq, now.Unix(), expired); err != nil {
+		return
+	}
+	err = db.Get(&n, `SELECT strikes FROM moderation_strikes WHERE group_number=? AND qq_number=?`, groupID, qq)
+	return
+}
+
+// strikes 当前累计的违规次数，已经过期的算 0
+func strikes(groupID, qq int64, now time.Time) (n int, err error) {
+	expired := int64(0)
+	if strikeExpire > 0 {
+		expired = now.Add(-strikeExpire).Unix()
+	}
+	err = db.Get(&n, `SELECT COALESCE(SUM(strikes), 0) FROM moderation_strikes WHERE group_number=? AND qq_number=? AND time>=?`, groupID, qq, expired)
+	return
+}
+
+func clearStrikes(groupID, qq int64) error {
+	_, err := db.Exec(`DELETE FROM moderation_strikes WHERE group_number=? AND qq_number=?`, groupID, qq)
+	return err
+}
+
+// entry 一条处理记录，Operator 为 0 表示 bot 自动处理
+type entry struct {
+	ID       int64  `db:"id"`
+	Group    int64  `db:"group_number"`
+	QQ       int64  `db:"qq_number"`
+	RuleID   int64  `db:"rule_id"`
+	Action   string `db:"action"`
+	Message  string `db:"message"`
+	Operator int64  `db:"operator"`
+	Time     int64  `db:"time"`
+}
+
+func writeLog(e entry) error {
+	_, err := db.NamedExec(`INSERT INTO moderation_log(group_number, qq_number, rule_id, action, message, operator, time)
+	VALUES (:group_number, :qq_number, :rule_id, :action, :message, :operator, :time)`, e)
+	return err
+}
+
+func recentLog(groupID int64, limit int) (entries []entry, err error) {
+	err = db.Select(&entries, `SELECT id, group_number, qq_number, rule_id, action, message, operator, time
+	FROM moderation_log WHERE group_number=? ORDER BY id DESC LIMIT ?`, groupID, limit)
+	return
+}
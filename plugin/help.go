@@ -0,0 +1,218 @@
+package plugin
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/render"
+	"github.com/fogleman/gg"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// Permission 使用指令需要的权限
+type Permission int
+
+const (
+	Everyone Permission = iota
+	Admin
+	SuperUser
+)
+
+// Command 一个指令或者消息格式的说明，/help 用
+type Command struct {
+	// Name /help 后面跟的名字，指令不带 /
+	Name        string
+	Usage       string
+	Description string
+	Examples    []string
+	Permission  Permission
+	GroupOnly   bool
+	PrivateOnly bool
+}
+
+// Documented 提供指令说明的模块会出现在 /help 里
+type Documented interface {
+	Commands() []Command
+}
+
+// builtinCommands 模块管理自己的指令，不受开关影响
+var builtinCommands = []Command{
+	{Name: "help", Usage: "/help [指令]", Description: "查看指令列表或者某个指令的详细说明，/help image 发图片", Examples: []string{"/help", "/help roll"}},
+	{Name: "plugins", Usage: "/plugins", Description: "列出所有模块和在本群的状态", Permission: Admin},
+	{Name: "enable", Usage: "/enable 模块名", Description: "在本群开启模块", Examples: []string{"/enable taunt"}, Permission: Admin, GroupOnly: true},
+	{Name: "disable", Usage: "/disable 模块名", Description: "在本群关闭模块", Examples: []string{"/disable taunt"}, Permission: Admin, GroupOnly: true},
+	{Name: "settings", Usage: "/settings", Description: "查看本群的模块开关和其他设置", Permission: Admin, GroupOnly: true},
+}
+
+// helpSection 一个模块可以看到的指令
+type helpSection struct {
+	Title    string
+	Commands []Command
+}
+
+func callerPermission(ctx *zero.Ctx) Permission {
+	switch {
+	case zero.SuperUserPermission(ctx):
+		return SuperUser
+	case GroupAdmin(ctx):
+		return Admin
+	}
+	return Everyone
+}
+
+// visible 指令对这个人、在这个聊天里能不能用
+func (c Command) visible(permission Permission, groupID int64) bool {
+	if c.Permission > permission {
+		return false
+	}
+	if groupID == 0 {
+		return !c.GroupOnly
+	}
+	return !c.PrivateOnly
+}
+
+// helpSections 按模块分组，去掉没权限、本群关掉的模块和不能在这里用的指令
+func helpSections(permission Permission, groupID int64) (sections []helpSection) {
+	registry.mux.RLock()
+	plugins := registry.plugins
+	registry.mux.RUnlock()
+	add := func(title string, commands []Command) {
+		section := helpSection{Title: title}
+		for _, c := range commands {
+			if c.visible(permission, groupID) {
+				section.Commands = append(section.Commands, c)
+			}
+		}
+		if len(section.Commands) > 0 {
+			sections = append(sections, section)
+		}
+	}
+	for _, e := range plugins {
+		documented, ok := e.plugin.(Documented)
+		if !ok || !Enabled(e.plugin.Name(), groupID) {
+			continue
+		}
+		add(e.plugin.Description(), documented.Commands())
+	}
+	add("其他", builtinCommands)
+	return
+}
+
+func findCommand(sections []helpSection, name string) (Command, bool) {
+	name = strings.ToLower(strings.TrimPrefix(name, "/"))
+	for _, section := range sections {
+		for _, c := range section.Commands {
+			if strings.ToLower(c.Name) == name {
+				return c, true
+			}
+		}
+	}
+	return Command{}, false
+}
+
+func helpLines(sections []helpSection) (lines []string) {
+	for _, section := range sections {
+		lines = append(lines, section.Title)
+		for _, c := range section.Commands {
+			lines = append(lines, fmt.Sprintf("  %s  %s", c.Usage, c.Description))
+		}
+	}
+	return
+}
+
+func helpText(sections []helpSection) string {
+	return "指令列表（/help 指令 查看详细说明）：\n" + strings.Join(helpLines(sections), "\n")
+}
+
+func commandText(c Command) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "用法：%s\n%s", c.Usage, c.Description)
+	if len(c.Examples) > 0 {
+		sb.WriteString("\n例如：" + strings.Join(c.Examples, "、"))
+	}
+	switch c.Permission {
+	case Admin:
+		sb.WriteString("\n需要群管理员权限")
+	case SuperUser:
+		sb.WriteString("\n需要超级用户权限")
+	}
+	if c.GroupOnly {
+		sb.WriteString("\n只能在群里用")
+	} else if c.PrivateOnly {
+		sb.WriteString("\n只能在私聊里用")
+	}
+	return sb.String()
+}
+
+// drawHelp 把指令列表画成图，模块名加粗一点、指令缩进
+func drawHelp(sections []helpSection) (image.Image, error) {
+	const (
+		fontSize   = 24
+		lineHeight = 38
+		padding    = 24
+	)
+	face, err := render.LoadFontFace(render.HanFont, nil, fontSize)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+	lines := helpLines(sections)
+	measure := gg.NewContext(1, 1)
+	measure.SetFontFace(face)
+	width := 0.0
+	for _, line := range lines {
+		if w, _ := measure.MeasureString(line); w > width {
+			width = w
+		}
+	}
+	dc := gg.NewContext(int(width)+padding*2, len(lines)*lineHeight+padding*2)
+	dc.SetHexColor("#ffffff")
+	dc.Clear()
+	dc.SetFontFace(face)
+	for i, line := range lines {
+		if strings.HasPrefix(line, " ") {
+			dc.SetHexColor("#5d6572")
+		} else {
+			dc.SetHexColor("#1d9c9c")
+		}
+		dc.DrawStringAnchored(line, padding, float64(padding+i*lineHeight+lineHeight/2), 0, 0.5)
+	}
+	return dc.Image(), nil
+}
+
+// HelpCommand 指令列表：/help [指令|image]，按权限和本群开关过滤
+func HelpCommand(ctx *zero.Ctx) {
+	args, _ := ctx.State["args"].(string)
+	args = strings.TrimSpace(args)
+	sections := helpSections(callerPermission(ctx), ctx.Event.GroupID)
+	switch {
+	case args == "":
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(helpText(sections))))
+	case strings.ToLower(args) == "image":
+		img, err := drawHelp(sections)
+		var seg message.MessageSegment
+		if err == nil {
+			seg, err = render.EncodePNG(img)
+		}
+		if err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event": "Help",
+				"err":   err,
+			}).Warningln("画帮助图片失败，改发文字")
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(helpText(sections))))
+			return
+		}
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, seg))
+	default:
+		c, exists := findCommand(sections, args)
+		if !exists {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("没有这个指令，/help 查看指令列表")))
+			return
+		}
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(commandText(c))))
+	}
+}
@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/doylecnn/qqbot/render"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"golang.org/x/image/font/gofont/gomedium"
+)
+
+type documentedPlugin struct {
+	testPlugin
+	commands []Command
+}
+
+func (p documentedPlugin) Commands() []Command { return p.commands }
+
+func (p documentedPlugin) Init(config *toml.Tree, db *sqlx.DB) error { return nil }
+
+func (p documentedPlugin) Register(engine *zero.Engine) {}
+
+func TestHelpSections(t *testing.T) {
+	var shutdown []string
+	Register(documentedPlugin{
+		testPlugin: testPlugin{name: "doc", shutdown: &shutdown},
+		commands: []Command{
+			{Name: "everyone", Usage: "/everyone"},
+			{Name: "admin", Usage: "/admin", Permission: Admin},
+			{Name: "group", Usage: "/group", GroupOnly: true},
+			{Name: "private", Usage: "/private", PrivateOnly: true},
+		},
+	})
+	config, _ := toml.Load(`
+[plugins.group_disabled]
+"2" = ["doc"]
+`)
+	Load(config, nil)
+
+	names := func(sections []helpSection) (result []string) {
+		for _, s := range sections {
+			if s.Title != "测试" {
+				continue
+			}
+			for _, c := range s.Commands {
+				result = append(result, c.Name)
+			}
+		}
+		return
+	}
+	for _, c := range []struct {
+		permission Permission
+		groupID    int64
+		want       string
+	}{
+		{Everyone, 1, "everyone,group"},
+		{Admin, 1, "everyone,admin,group"},
+		{Everyone, 0, "everyone,private"},
+		{SuperUser, 2, ""},
+	} {
+		if got := strings.Join(names(helpSections(c.permission, c.groupID)), ","); got != c.want {
+			t.Errorf("helpSections(%d, %d) = %s, want %s", c.permission, c.groupID, got, c.want)
+		}
+	}
+
+	sections := helpSections(Everyone, 1)
+	if _, exists := findCommand(sections, "/Group"); !exists {
+		t.Error("findCommand should ignore / and case")
+	}
+	if _, exists := findCommand(sections, "admin"); exists {
+		t.Error("findCommand found a command the caller can't see")
+	}
+	if _, exists := findCommand(sections, "help"); !exists {
+		t.Error("builtin commands missing")
+	}
+}
+
+func TestCommandText(t *testing.T) {
+	text := commandText(Command{Usage: "/x 参数", Description: "说明", Examples: []string{"/x 1", "/x 2"}, Permission: Admin, GroupOnly: true})
+	want := "用法：/x 参数\n说明\n例如：/x 1、/x 2\n需要群管理员权限\n只能在群里用"
+	if text != want {
+		t.Errorf("commandText = %q, want %q", text, want)
+	}
+}
+
+func TestDrawHelp(t *testing.T) {
+	// 测试环境不一定有中文字体，换成内置的 Go 字体，只检查图片大小
+	fontFile := filepath.Join(t.TempDir(), "go.ttf")
+	if err := os.WriteFile(fontFile, gomedium.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(path string) { render.HanFont = path }(render.HanFont)
+	render.HanFont = fontFile
+
+	sections := []helpSection{{Title: "a", Commands: []Command{{Usage: "/a", Description: "b"}, {Usage: "/c", Description: "d"}}}}
+	img, err := drawHelp(sections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := img.Bounds().Dy(); h != 3*38+2*24 {
+		t.Errorf("height = %d", h)
+	}
+}
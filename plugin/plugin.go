@@ -0,0 +1,306 @@
+// Package plugin 功能模块的注册和开关。
+// 每个功能实现 Plugin 接口，有自己的 zero.Engine，按配置在全局或者某些群里关闭：
+//
+//	[plugins]
+//	disabled = ["frp"]
+//	default_disabled = ["keyword"]
+//	[plugins.group_disabled]
+//	"123456" = ["dice", "taunt"]
+//
+// disabled 的模块完全不加载；default_disabled 和 group_disabled 只是默认值，
+// 群管理员可以用 /enable、/disable 修改，保存在 group_settings 里
+package plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	groupsettings "github.com/doylecnn/qqbot/group_settings"
+	"github.com/doylecnn/qqbot/log"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// Plugin 一个功能模块
+type Plugin interface {
+	// Name 英文短名，用在配置和指令里
+	Name() string
+	Description() string
+	// Init 读取配置、准备数据，返回错误时这个模块不会注册
+	Init(config *toml.Tree, db *sqlx.DB) error
+	// Register 在 engine 上注册消息处理器，engine 会按群过滤关掉的模块
+	Register(engine *zero.Engine)
+	// Shutdown 退出前调用
+	Shutdown()
+}
+
+type status int
+
+const (
+	statusEnabled status = iota
+	statusDisabled
+	statusFailed
+)
+
+type entry struct {
+	plugin Plugin
+	status status
+	err    error
+}
+
+var registry struct {
+	plugins []*entry
+	// defaultDisabled 在所有群里默认关闭的模块
+	defaultDisabled map[string]bool
+	// groupDisabled 群号 -> 在这个群默认关闭的模块
+	groupDisabled map[int64]map[string]bool
+	mux           sync.RWMutex
+}
+
+// settingKey 模块开关在 group_settings 里的键
+func settingKey(name string) string {
+	return "plugin." + name
+}
+
+func (e *entry) setStatus(s status, err error) {
+	registry.mux.Lock()
+	defer registry.mux.Unlock()
+	e.status, e.err = s, err
+}
+
+// Register 按顺序登记模块，消息处理器也按这个顺序匹配
+func Register(plugins ...Plugin) {
+	registry.mux.Lock()
+	defer registry.mux.Unlock()
+	for _, p := range plugins {
+		registry.plugins = append(registry.plugins, &entry{plugin: p})
+	}
+}
+
+func nameSet(config *toml.Tree, key string) map[string]bool {
+	set := make(map[string]bool)
+	if config == nil {
+		return set
+	}
+	if names, ok := config.Get(key).([]interface{}); ok {
+		for _, name := range names {
+			set[fmt.Sprint(name)] = true
+		}
+	}
+	return set
+}
+
+// Load 读取开关配置，初始化并注册所有没有关掉的模块，群设置也在这里初始化
+func Load(config *toml.Tree, db *sqlx.DB) {
+	groupsettings.Init(db)
+	registry.mux.Lock()
+	disabled := nameSet(config, "plugins.disabled")
+	registry.defaultDisabled = nameSet(config, "plugins.default_disabled")
+	registry.groupDisabled = make(map[int64]map[string]bool)
+	if config != nil {
+		if groups, ok := config.Get("plugins.group_disabled").(*toml.Tree); ok {
+			for _, key := range groups.Keys() {
+				groupID, err := strconv.ParseInt(key, 10, 64)
+				names, ok := groups.Get(key).([]interface{})
+				if err != nil || !ok {
+					log.Log.WithFields(logrus.Fields{
+						"event": "Plugin Load",
+						"Group": key,
+					}).Warningln("plugins.group_disabled 配置格式不对")
+					continue
+				}
+				registry.groupDisabled[groupID] = make(map[string]bool)
+				for _, name := range names {
+					registry.groupDisabled[groupID][fmt.Sprint(name)] = true
+				}
+			}
+		}
+	}
+	plugins := registry.plugins
+	registry.mux.Unlock()
+
+	for _, e := range plugins {
+		name := e.plugin.Name()
+		if disabled[name] {
+			e.setStatus(statusDisabled, nil)
+			continue
+		}
+		if err := e.plugin.Init(config, db); err != nil {
+			e.setStatus(statusFailed, err)
+			log.Log.WithFields(logrus.Fields{
+				"event":  "Plugin Load",
+				"Plugin": name,
+				"err":    err,
+			}).Warningln("模块初始化失败")
+			continue
+		}
+		engine := zero.New()
+		engine.UsePreHandler(func(ctx *zero.Ctx) bool {
+			return Enabled(name, ctx.Event.GroupID)
+		})
+		e.plugin.Register(engine)
+	}
+	log.Log.WithFields(logrus.Fields{
+		"event": "Plugin Load",
+		"Count": len(plugins),
+	}).Infoln("加载模块")
+}
+
+func find(name string) *entry {
+	for _, e := range registry.plugins {
+		if e.plugin.Name() == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// Enabled 模块在这个群里有没有开，私聊时 groupID 为 0，只看全局开关
+func Enabled(name string, groupID int64) bool {
+	registry.mux.RLock()
+	defer registry.mux.RUnlock()
+	if e := find(name); e != nil && e.status != statusEnabled {
+		return false
+	}
+	if groupID == 0 {
+		return true
+	}
+	if v, exists := groupsettings.Lookup(groupID, settingKey(name)); exists {
+		return v == "on"
+	}
+	return !registry.defaultDisabled[name] && !registry.groupDisabled[groupID][name]
+}
+
+// GroupAdmin 群管理员或者超级用户。私聊时发送者没有群身份，zero.AdminPermission 对谁都成立，不能直接用
+func GroupAdmin(ctx *zero.Ctx) bool {
+	return zero.SuperUserPermission(ctx) || (ctx.Event.GroupID != 0 && zero.AdminPermission(ctx))
+}
+
+// Shutdown 倒序调用各模块的 Shutdown
+func Shutdown() {
+	registry.mux.RLock()
+	plugins := registry.plugins
+	registry.mux.RUnlock()
+	for i := len(plugins) - 1; i >= 0; i-- {
+		if plugins[i].status == statusEnabled {
+			plugins[i].plugin.Shutdown()
+		}
+	}
+}
+
+// statusText 模块在这个群的状态
+func statusText(e *entry, groupID int64) string {
+	switch e.status {
+	case statusDisabled:
+		return "全局关闭"
+	case statusFailed:
+		return "加载失败：" + e.err.Error()
+	}
+	if !Enabled(e.plugin.Name(), groupID) {
+		return "本群关闭"
+	}
+	return "开启"
+}
+
+// ListCommand 列出所有模块和在本群的状态：/plugins，只有管理员可以用
+func ListCommand(ctx *zero.Ctx) {
+	registry.mux.RLock()
+	plugins := registry.plugins
+	registry.mux.RUnlock()
+	var sb strings.Builder
+	sb.WriteString("模块：")
+	for _, e := range plugins {
+		fmt.Fprintf(&sb, "\n%s（%s）：%s", e.plugin.Name(), statusText(e, ctx.Event.GroupID), e.plugin.Description())
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(sb.String())))
+}
+
+func setEnabled(ctx *zero.Ctx, enabled bool) {
+	name, _ := ctx.State["args"].(string)
+	name = strings.TrimSpace(name)
+	registry.mux.RLock()
+	e := find(name)
+	var names []string
+	for _, p := range registry.plugins {
+		names = append(names, p.plugin.Name())
+	}
+	registry.mux.RUnlock()
+	if e == nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("没有这个模块，可以用的有："+strings.Join(names, "、"))))
+		return
+	}
+	if enabled && e.status != statusEnabled {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(name+"："+statusText(e, ctx.Event.GroupID)+"，只能改配置文件")))
+		return
+	}
+	value := "off"
+	if enabled {
+		value = "on"
+	}
+	if err := groupsettings.Set(ctx.Event.GroupID, settingKey(name), value); err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event":     "Plugin Toggle",
+			"err":       err,
+			"QQGroupId": ctx.Event.GroupID,
+		}).Warningln("保存模块开关失败")
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("修改失败了，稍后再试试")))
+		return
+	}
+	if enabled {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("本群已开启 "+name)))
+	} else {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("本群已关闭 "+name)))
+	}
+}
+
+// EnableCommand 在本群开启模块：/enable 模块名
+func EnableCommand(ctx *zero.Ctx) {
+	setEnabled(ctx, true)
+}
+
+// DisableCommand 在本群关闭模块：/disable 模块名
+func DisableCommand(ctx *zero.Ctx) {
+	setEnabled(ctx, false)
+}
+
+// SettingsCommand 查看本群的模块开关和其他设置：/settings
+func SettingsCommand(ctx *zero.Ctx) {
+	groupID := ctx.Event.GroupID
+	registry.mux.RLock()
+	plugins := registry.plugins
+	registry.mux.RUnlock()
+	var sb strings.Builder
+	sb.WriteString("本群设置：")
+	for _, e := range plugins {
+		name := e.plugin.Name()
+		source := "默认"
+		if _, exists := groupsettings.Lookup(groupID, settingKey(name)); exists {
+			source = "本群设置"
+		}
+		fmt.Fprintf(&sb, "\n%s：%s（%s）", name, statusText(e, groupID), source)
+	}
+	for _, key := range groupsettings.Keys(groupID) {
+		if strings.HasPrefix(key, "plugin.") {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%s = %s", key, groupsettings.Get(groupID, key, ""))
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(sb.String())))
+}
+
+// RegisterCommands 注册模块管理自己的指令，这些指令不受开关影响
+func RegisterCommands() {
+	zero.OnCommand("test").Handle(func(ctx *zero.Ctx) {
+		ctx.Send(message.Text("success"))
+	})
+	zero.OnCommand("plugins", GroupAdmin).Handle(ListCommand)
+	zero.OnCommand("help").Handle(HelpCommand)
+	zero.OnCommand("enable", zero.OnlyGroup, zero.AdminPermission).Handle(EnableCommand)
+	zero.OnCommand("disable", zero.OnlyGroup, zero.AdminPermission).Handle(DisableCommand)
+	zero.OnCommand("settings", zero.OnlyGroup, zero.AdminPermission).Handle(SettingsCommand)
+}
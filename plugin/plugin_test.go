@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	groupsettings "github.com/doylecnn/qqbot/group_settings"
+	testdb "github.com/doylecnn/qqbot/test_db"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	zero "github.com/wdvxdr1123/ZeroBot"
+)
+
+type testPlugin struct {
+	name       string
+	initErr    error
+	registered *bool
+	shutdown   *[]string
+}
+
+func (p testPlugin) Name() string        { return p.name }
+func (p testPlugin) Description() string { return "测试" }
+
+func (p testPlugin) Init(config *toml.Tree, db *sqlx.DB) error { return p.initErr }
+
+func (p testPlugin) Register(engine *zero.Engine) { *p.registered = true }
+
+func (p testPlugin) Shutdown() { *p.shutdown = append(*p.shutdown, p.name) }
+
+func TestLoad(t *testing.T) {
+	config, err := toml.Load(`
+[plugins]
+disabled = ["off"]
+default_disabled = ["b"]
+[plugins.group_disabled]
+"1" = ["a"]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shutdown []string
+	registered := make(map[string]*bool)
+	for _, name := range []string{"a", "off", "broken", "b"} {
+		registered[name] = new(bool)
+	}
+	Register(
+		testPlugin{name: "a", registered: registered["a"], shutdown: &shutdown},
+		testPlugin{name: "off", registered: registered["off"], shutdown: &shutdown},
+		testPlugin{name: "broken", initErr: errors.New("坏了"), registered: registered["broken"], shutdown: &shutdown},
+		testPlugin{name: "b", registered: registered["b"], shutdown: &shutdown},
+	)
+	Load(config, nil)
+
+	for name, want := range map[string]bool{"a": true, "off": false, "broken": false, "b": true} {
+		if *registered[name] != want {
+			t.Errorf("%s registered = %v, want %v", name, *registered[name], want)
+		}
+	}
+	for _, c := range []struct {
+		name    string
+		groupID int64
+		want    bool
+	}{
+		{"a", 0, true},
+		{"a", 1, false},
+		{"a", 2, true},
+		{"b", 0, true},
+		{"b", 1, false},
+		{"off", 2, false},
+		{"broken", 2, false},
+	} {
+		if got := Enabled(c.name, c.groupID); got != c.want {
+			t.Errorf("Enabled(%s, %d) = %v, want %v", c.name, c.groupID, got, c.want)
+		}
+	}
+
+	Shutdown()
+	if len(shutdown) != 2 || shutdown[0] != "b" || shutdown[1] != "a" {
+		t.Errorf("shutdown order = %v", shutdown)
+	}
+}
+
+func TestGroupOverride(t *testing.T) {
+	database := testdb.New(t)
+	config, err := toml.Load(`
+[plugins]
+default_disabled = ["y"]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shutdown []string
+	Register(
+		testPlugin{name: "x", registered: new(bool), shutdown: &shutdown},
+		testPlugin{name: "y", registered: new(bool), shutdown: &shutdown},
+	)
+	Load(config, database)
+	defer groupsettings.Init(nil)
+
+	if !Enabled("x", 1) || Enabled("y", 1) {
+		t.Fatal("defaults from config not applied")
+	}
+	if err := groupsettings.Set(1, settingKey("x"), "off"); err != nil {
+		t.Fatal(err)
+	}
+	if err := groupsettings.Set(1, settingKey("y"), "on"); err != nil {
+		t.Fatal(err)
+	}
+	if Enabled("x", 1) || !Enabled("y", 1) {
+		t.Error("group settings should override config defaults")
+	}
+	if !Enabled("x", 2) || Enabled("y", 2) {
+		t.Error("other groups should keep the defaults")
+	}
+}
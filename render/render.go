@@ -0,0 +1,72 @@
+// Package render 画图共用的字体加载和图片编码
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/pelletier/go-toml"
+	"github.com/wdvxdr1123/ZeroBot/message"
+	"golang.org/x/image/font"
+)
+
+// HanFont 带汉字的字体文件，配置文件里的 render.han_font 可以修改
+var HanFont = "C:\\Windows\\Fonts\\msyhbd.ttc"
+
+// LatinFont 画拼音和字母用的字体文件，配置文件里的 render.latin_font 可以修改，为空时用内置的 Go 字体
+var LatinFont string
+
+// Init 读取字体配置
+func Init(config *toml.Tree) {
+	if config == nil {
+		return
+	}
+	if path, ok := config.Get("render.han_font").(string); ok && path != "" {
+		HanFont = path
+	}
+	if path, ok := config.Get("render.latin_font").(string); ok {
+		LatinFont = path
+	}
+}
+
+var parsedFonts sync.Map
+
+// LoadFontFace 加载字体，path 为空时用 fallback，解析过的字体会缓存起来
+func LoadFontFace(path string, fallback []byte, points float64) (font.Face, error) {
+	var f *truetype.Font
+	key := path
+	if key == "" {
+		key = fmt.Sprintf("builtin:%p", fallback)
+	}
+	if v, ok := parsedFonts.Load(key); ok {
+		f = v.(*truetype.Font)
+	} else {
+		fontBytes := fallback
+		if path != "" {
+			var err error
+			if fontBytes, err = os.ReadFile(path); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if f, err = truetype.Parse(fontBytes); err != nil {
+			return nil, err
+		}
+		parsedFonts.Store(key, f)
+	}
+	return truetype.NewFace(f, &truetype.Options{Size: points}), nil
+}
+
+// EncodePNG 编码成可以直接发送的图片消息
+func EncodePNG(img image.Image) (message.MessageSegment, error) {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return message.MessageSegment{}, err
+	}
+	return message.ImageBytes(buf.Bytes()), nil
+}
@@ -0,0 +1,225 @@
+// Package repeat 复读：好几个人接连发同一句话时跟一次，复读太长时打断
+package repeat
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	groupsettings "github.com/doylecnn/qqbot/group_settings"
+	"github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// settings 一个群的复读设置
+type settings struct {
+	// Threshold 几个不同的人发了同一句话才算复读
+	Threshold int
+	// Chance 跟着复读的概率，百分比，每轮复读只判断一次
+	Chance int
+	// BreakAt 同一句话发到这么多次就打断，0 表示不打断
+	BreakAt int
+}
+
+// setting 可以用 /repeat 修改的设置：群设置里的键和取值范围
+type setting struct {
+	key      string
+	min, max int
+	field    func(s *settings) *int
+}
+
+var settingNames = map[string]setting{
+	"threshold": {"repeat.threshold", 2, 10, func(s *settings) *int { return &s.Threshold }},
+	"chance":    {"repeat.chance", 0, 100, func(s *settings) *int { return &s.Chance }},
+	"break":     {"repeat.break_at", 0, 50, func(s *settings) *int { return &s.BreakAt }},
+}
+
+var (
+	defaults  = settings{Threshold: 3, Chance: 50, BreakAt: 0}
+	breakText = "打断复读！"
+	// cooldown 跟读或者打断之后这么久不再插话
+	cooldown time.Duration
+	chains   = newTracker()
+)
+
+// groupSettings 群设置里没有的用配置文件里的默认值
+func groupSettings(groupID int64) settings {
+	s := defaults
+	for _, def := range settingNames {
+		if v, err := strconv.Atoi(groupsettings.Get(groupID, def.key, "")); err == nil {
+			*def.field(&s) = v
+		}
+	}
+	return s
+}
+
+// chain 一个群里正在进行的复读
+type chain struct {
+	content string
+	users   map[int64]bool
+	count   int
+	// decided 已经决定过要不要跟，broken 已经打断过
+	decided, broken bool
+}
+
+type action int
+
+const (
+	none action = iota
+	join
+	interrupt
+)
+
+type tracker struct {
+	chains     map[int64]*chain
+	lastAction map[int64]time.Time
+	mux        sync.Mutex
+}
+
+func newTracker() *tracker {
+	return &tracker{chains: make(map[int64]*chain), lastAction: make(map[int64]time.Time)}
+}
+
+// observe 记下一条消息，返回 bot 该做什么；roll 返回 [0, 100) 的随机数
+func (t *tracker) observe(groupID, userID int64, content string, s settings, now time.Time, roll func() int) action {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	c, exists := t.chains[groupID]
+	if !exists || c.content != content {
+		c = &chain{content: content, users: make(map[int64]bool)}
+		t.chains[groupID] = c
+	}
+	c.users[userID] = true
+	c.count++
+	if now.Before(t.lastAction[groupID].Add(cooldown)) {
+		return none
+	}
+	if s.BreakAt > 0 && c.count >= s.BreakAt && !c.broken {
+		c.broken, c.decided = true, true
+		t.lastAction[groupID] = now
+		return interrupt
+	}
+	if len(c.users) >= s.Threshold && !c.decided {
+		c.decided = true
+		if roll() < s.Chance {
+			t.lastAction[groupID] = now
+			return join
+		}
+	}
+	return none
+}
+
+// Plugin 复读
+type Plugin struct{}
+
+func (Plugin) Name() string { return "repeat" }
+
+func (Plugin) Description() string {
+	return "复读：跟着群友复读一次，复读太长时打断"
+}
+
+func (Plugin) Init(config *toml.Tree, db *sqlx.DB) error {
+	chains = newTracker()
+	if config == nil {
+		return nil
+	}
+	if cd, ok := config.Get("repeat.cooldown").(string); ok {
+		d, err := time.ParseDuration(cd)
+		if err != nil {
+			return fmt.Errorf("repeat.cooldown：%w", err)
+		}
+		cooldown = d
+	}
+	for name, def := range settingNames {
+		if v, ok := config.Get("repeat." + name).(int64); ok {
+			if int(v) < def.min || int(v) > def.max {
+				return fmt.Errorf("repeat.%s 要在 %d 到 %d 之间", name, def.min, def.max)
+			}
+			*def.field(&defaults) = int(v)
+		}
+	}
+	if text, ok := config.Get("repeat.break_text").(string); ok && text != "" {
+		breakText = text
+	}
+	return nil
+}
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "复读", Usage: "（自动）", Description: "好几个人发同一句话时 bot 可能会跟一次，复读太长会被打断", GroupOnly: true},
+		{Name: "repeat", Usage: "/repeat [threshold 人数|chance 百分比|break 次数]", Description: "查看或者修改本群的复读设置，break 0 表示不打断", Examples: []string{"/repeat", "/repeat chance 30", "/repeat break 8"}, Permission: plugin.Admin, GroupOnly: true},
+	}
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnCommand("repeat", zero.OnlyGroup, zero.AdminPermission).Handle(Command)
+	engine.OnMessage(zero.OnlyGroup).Handle(onGroupMessage)
+}
+
+func (Plugin) Shutdown() {}
+
+func onGroupMessage(ctx *zero.Ctx) {
+	content := ctx.MessageString()
+	if content == "" || strings.HasPrefix(content, "/") {
+		return
+	}
+	groupID := ctx.Event.GroupID
+	switch chains.observe(groupID, ctx.Event.UserID, content, groupSettings(groupID), time.Now(), func() int { return rand.Intn(100) }) {
+	case join:
+		ctx.Send(ctx.Event.Message)
+		ctx.Block()
+	case interrupt:
+		ctx.Send(message.Text(breakText))
+		ctx.Block()
+	}
+}
+
+func settingsText(s settings) string {
+	text := fmt.Sprintf("复读设置：%d 个人发同一句话时有 %d%% 的概率跟一次", s.Threshold, s.Chance)
+	if s.BreakAt > 0 {
+		return text + fmt.Sprintf("，发到 %d 次打断", s.BreakAt)
+	}
+	return text + "，不打断"
+}
+
+// Command 查看或修改本群的复读设置：/repeat [threshold|chance|break 数字]
+func Command(ctx *zero.Ctx) {
+	defer ctx.Block()
+	fields := []string{}
+	if args, ok := ctx.State["args"].(string); ok {
+		fields = strings.Fields(strings.ToLower(args))
+	}
+	groupID := ctx.Event.GroupID
+	if len(fields) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(settingsText(groupSettings(groupID)))))
+		return
+	}
+	def, exists := settingNames[fields[0]]
+	if !exists || len(fields) != 2 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("用法：/repeat [threshold 人数|chance 百分比|break 次数]")))
+		return
+	}
+	v, err := strconv.Atoi(fields[1])
+	if err != nil || v < def.min || v > def.max {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("%s 要在 %d 到 %d 之间", fields[0], def.min, def.max))))
+		return
+	}
+	if err := groupsettings.Set(groupID, def.key, strconv.Itoa(v)); err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event":     "Repeat Settings",
+			"err":       err,
+			"QQGroupId": groupID,
+		}).Warningln("保存复读设置失败")
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("修改失败了，稍后再试试")))
+		return
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(settingsText(groupSettings(groupID)))))
+}
@@ -0,0 +1,61 @@
+package repeat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestObserve(t *testing.T) {
+	defer func(d time.Duration) { cooldown = d }(cooldown)
+	cooldown = time.Minute
+	s := settings{Threshold: 3, Chance: 50, BreakAt: 5}
+	always := func() int { return 0 }
+	never := func() int { return 99 }
+	now := time.Now()
+
+	tr := newTracker()
+	steps := []struct {
+		user    int64
+		content string
+		roll    func() int
+		want    action
+	}{
+		{1, "a", always, none},
+		// 同一个人重复不算
+		{1, "a", always, none},
+		{2, "a", always, none},
+		{3, "a", always, join},
+		// 跟过一次就不再跟
+		{4, "a", always, none},
+		// 冷却中不打断
+		{5, "a", always, none},
+	}
+	for i, step := range steps {
+		if got := tr.observe(1, step.user, step.content, s, now, step.roll); got != step.want {
+			t.Errorf("step %d: observe = %d, want %d", i, got, step.want)
+		}
+	}
+	// 冷却过了，复读还在继续就打断
+	now = now.Add(2 * time.Minute)
+	if got := tr.observe(1, 6, "a", s, now, always); got != interrupt {
+		t.Errorf("after cooldown: observe = %d, want interrupt", got)
+	}
+	if got := tr.observe(1, 7, "a", s, now.Add(2*time.Minute), always); got != none {
+		t.Errorf("broken chain: observe = %d, want none", got)
+	}
+
+	// 换了一句话重新计数；没抽中这轮就不跟了
+	now = now.Add(10 * time.Minute)
+	for _, user := range []int64{1, 2, 3} {
+		if got := tr.observe(1, user, "b", s, now, never); got != none {
+			t.Errorf("never: observe = %d", got)
+		}
+	}
+	if got := tr.observe(1, 4, "b", s, now, always); got != none {
+		t.Errorf("decided chain: observe = %d", got)
+	}
+	// 各群分开算
+	if got := tr.observe(2, 1, "b", s, now, always); got != none {
+		t.Errorf("group 2: observe = %d", got)
+	}
+}
@@ -0,0 +1,371 @@
+// Package replylearn 从聊天记录里学关键词回复：某句话之后很快有人接了同一句话、
+// 反复出现的就当作一对候选，放进 learn_queue 等管理员审核，批准后写进 replies 表
+package replylearn
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	fuzzy "github.com/doylecnn/go-fuzzywuzzy"
+	"github.com/doylecnn/qqbot/log"
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	// similarRatio 关键词相似度达到这个值就算同一类
+	similarRatio = 80
+	// lookback 只看最近这么久的消息
+	lookback = 30 * 24 * time.Hour
+	// pairsLimit 每个群最多拿这么多对来聚类，避免自连接太慢
+	pairsLimit = 2000
+	listLimit  = 10
+)
+
+// options 挖掘参数，在配置文件的 [learn] 里修改
+type options struct {
+	// Window 回复要在这么多秒之内
+	Window time.Duration
+	// MinSupport 一类问答至少出现这么多次才提出来
+	MinSupport int
+	// Interval 后台多久挖一次，0 表示只能手动 /learn-queue mine
+	Interval time.Duration
+}
+
+var (
+	db   *sqlx.DB
+	opts = options{Window: 30 * time.Second, MinSupport: 3, Interval: 6 * time.Hour}
+	stop chan struct{}
+	// mineMux 同一时间只挖一个群
+	mineMux sync.Mutex
+)
+
+// Plugin 自动学习关键词回复，建议在配置里默认关闭，需要的群再 /enable learn
+type Plugin struct{}
+
+func (Plugin) Name() string { return "learn" }
+
+func (Plugin) Description() string {
+	return "从聊天记录里学关键词回复，管理员审核：/learn-queue"
+}
+
+func (Plugin) Init(config *toml.Tree, database *sqlx.DB) error {
+	db = database
+	if config != nil {
+		for key, target := range map[string]*time.Duration{"learn.window": &opts.Window, "learn.interval": &opts.Interval} {
+			if s, ok := config.Get(key).(string); ok {
+				d, err := time.ParseDuration(s)
+				if err != nil {
+					return fmt.Errorf("%s：%w", key, err)
+				}
+				*target = d
+			}
+		}
+		if n, ok := config.Get("learn.min_support").(int64); ok && n > 0 {
+			opts.MinSupport = int(n)
+		}
+	}
+	if db != nil && opts.Interval > 0 {
+		stop = make(chan struct{})
+		go mineLoop(opts.Interval, stop)
+	}
+	return nil
+}
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "learn-queue", Usage: "/learn-queue [approve|reject 编号...|mine]", Description: "查看从聊天记录里学到的候选回复，批准后加入关键词回复；mine 立刻从本群记录里找一次", Examples: []string{"/learn-queue", "/learn-queue approve 3 5"}, Permission: plugin.Admin, GroupOnly: true},
+	}
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnCommand("learn-queue", zero.OnlyGroup, zero.AdminPermission).Handle(QueueCommand)
+}
+
+func (Plugin) Shutdown() {
+	if stop != nil {
+		close(stop)
+		stop = nil
+	}
+}
+
+// candidate 一对候选问答
+type candidate struct {
+	Keyword string `db:"keyword"`
+	Reply   string `db:"reply"`
+	// Count 这一对原样出现的次数，Support 算上相似关键词的次数
+	Count   int `db:"n"`
+	Support int `db:"support"`
+}
+
+// mine 找出本群反复出现的问答：相邻两条消息、不同人、间隔不超过 Window；
+// 回复相同、关键词 partial_ratio 相似的算一类，每类留出现最多的关键词
+func mine(groupID int64, now time.Time) (result []candidate, err error) {
+	candidates := []candidate{}
+	err = db.Select(&candidates, `WITH adjacent AS (
+		SELECT message AS keyword, qq_number, time,
+			LEAD(message) OVER w AS reply, LEAD(qq_number) OVER w AS reply_qq, LEAD(time) OVER w AS reply_time
+		FROM group_messages WHERE group_number=? AND time>=?
+		WINDOW w AS (ORDER BY id)
+	), pairs AS (
+		SELECT keyword, reply, COUNT(*) AS n FROM adjacent
+		WHERE reply IS NOT NULL AND reply_qq!=qq_number AND reply_time-time<=?
+			AND length(keyword) BETWEEN 2 AND 20 AND length(reply) BETWEEN 1 AND 50
+			AND keyword NOT LIKE '/%' AND reply NOT LIKE '/%'
+			AND keyword NOT LIKE '%[CQ:%' AND reply NOT LIKE '%[CQ:%'
+			AND keyword!=reply
+		GROUP BY keyword, reply ORDER BY n DESC LIMIT ?
+	)
+	SELECT a.keyword, a.reply, a.n, SUM(b.n) AS support FROM pairs a
+	JOIN pairs b ON a.reply=b.reply AND partial_ratio(a.keyword, b.keyword)>=?
+	GROUP BY a.keyword, a.reply HAVING support>=?`,
+		groupID, now.Add(-lookback).Unix(), int64(opts.Window/time.Second), pairsLimit, similarRatio, opts.MinSupport)
+	if err != nil {
+		return
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Support != candidates[j].Support {
+			return candidates[i].Support > candidates[j].Support
+		}
+		if candidates[i].Count != candidates[j].Count {
+			return candidates[i].Count > candidates[j].Count
+		}
+		return candidates[i].Keyword < candidates[j].Keyword
+	})
+	for _, c := range candidates {
+		duplicate := false
+		for _, r := range result {
+			if r.Reply == c.Reply && fuzzy.PartialRatio(r.Keyword, c.Keyword) >= similarRatio {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			result = append(result, c)
+		}
+	}
+	return
+}
+
+// enqueue 挖出来的候选放进队列，已经有的回复和审核过的不再提
+func enqueue(groupID int64, candidates []candidate, now time.Time) (added int, err error) {
+	for _, c := range candidates {
+		var exists int
+		if err = db.Get(&exists, `SELECT COUNT(*) FROM replies WHERE group_number=? AND keyword=? AND reply=?`, groupID, c.Keyword, c.Reply); err != nil {
+			return
+		}
+		if exists > 0 {
+			continue
+		}
+		res, err := db.Exec(`INSERT OR IGNORE INTO learn_queue(group_number, keyword, reply, support, time, status) VALUES (?, ?, ?, ?, ?, 'pending')`,
+			groupID, c.Keyword, c.Reply, c.Support, now.Unix())
+		if err != nil {
+			return added, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added++
+		}
+	}
+	return
+}
+
+func mineGroup(groupID int64) (int, error) {
+	mineMux.Lock()
+	defer mineMux.Unlock()
+	now := time.Now()
+	candidates, err := mine(groupID, now)
+	if err != nil {
+		return 0, err
+	}
+	return enqueue(groupID, candidates, now)
+}
+
+// mineAll 挖所有开了这个模块、最近有消息的群
+func mineAll() {
+	groups := []int64{}
+	if err := db.Select(&groups, `SELECT DISTINCT group_number FROM group_messages WHERE time>=?`, time.Now().Add(-lookback).Unix()); err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Reply Learn",
+			"call":  "Select",
+			"err":   err,
+		}).Warningln("读取群列表失败")
+		return
+	}
+	for _, groupID := range groups {
+		if !plugin.Enabled("learn", groupID) {
+			continue
+		}
+		added, err := mineGroup(groupID)
+		if err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event":     "Reply Learn",
+				"err":       err,
+				"QQGroupId": groupID,
+			}).Warningln("学习回复失败")
+			continue
+		}
+		if added > 0 {
+			log.Log.WithFields(logrus.Fields{
+				"event":     "Reply Learn",
+				"Added":     added,
+				"QQGroupId": groupID,
+			}).Infoln("学到新的候选回复")
+		}
+	}
+}
+
+func mineLoop(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			mineAll()
+		case <-stop:
+			return
+		}
+	}
+}
+
+type queued struct {
+	ID      int64  `db:"id"`
+	Group   int64  `db:"group_number"`
+	Keyword string `db:"keyword"`
+	Reply   string `db:"reply"`
+	Support int    `db:"support"`
+	Time    int64  `db:"time"`
+	Status  string `db:"status"`
+}
+
+// approve 批准后写进 replies，group_id 是 groups 表里的编号，没有登记过的群为 0
+func approve(groupID, id int64) (q queued, err error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	if err = tx.Get(&q, `SELECT * FROM learn_queue WHERE id=? AND group_number=? AND status='pending'`, id, groupID); err != nil {
+		return
+	}
+	if _, err = tx.Exec(`INSERT INTO replies(keyword, reply, group_id, group_number) VALUES (?, ?, COALESCE((SELECT id FROM groups WHERE number=?), 0), ?)`,
+		q.Keyword, q.Reply, groupID, groupID); err != nil {
+		return
+	}
+	if _, err = tx.Exec(`UPDATE learn_queue SET status='approved' WHERE id=?`, id); err != nil {
+		return
+	}
+	err = tx.Commit()
+	return
+}
+
+func reject(groupID, id int64) (q queued, err error) {
+	if err = db.Get(&q, `SELECT * FROM learn_queue WHERE id=? AND group_number=? AND status='pending'`, id, groupID); err != nil {
+		return
+	}
+	_, err = db.Exec(`UPDATE learn_queue SET status='rejected' WHERE id=?`, id)
+	return
+}
+
+func listQueue(ctx *zero.Ctx) {
+	items := []queued{}
+	if err := db.Select(&items, `SELECT * FROM learn_queue WHERE group_number=? AND status='pending' ORDER BY support DESC, id LIMIT ?`, ctx.Event.GroupID, listLimit); err != nil {
+		log.Log.WithFields(logrus.Fields{
+			"event": "Reply Learn",
+			"call":  "Select",
+			"err":   err,
+		}).Warningln("读取学习队列失败")
+		return
+	}
+	if len(items) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("没有待审核的回复，/learn-queue mine 从聊天记录里找一次")))
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString("待审核的回复：")
+	for _, q := range items {
+		fmt.Fprintf(&sb, "\n#%d %s → %s（%d 次）", q.ID, q.Keyword, q.Reply, q.Support)
+	}
+	sb.WriteString("\n/learn-queue approve|reject 编号...")
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(sb.String())))
+}
+
+// QueueCommand /learn-queue [approve|reject 编号...|mine]，只处理本群的队列
+func QueueCommand(ctx *zero.Ctx) {
+	defer ctx.Block()
+	if db == nil {
+		return
+	}
+	fields := []string{}
+	if args, ok := ctx.State["args"].(string); ok {
+		fields = strings.Fields(strings.ToLower(args))
+	}
+	if len(fields) == 0 {
+		listQueue(ctx)
+		return
+	}
+	groupID := ctx.Event.GroupID
+	switch fields[0] {
+	case "mine":
+		added, err := mineGroup(groupID)
+		if err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event":     "Reply Learn",
+				"err":       err,
+				"QQGroupId": groupID,
+			}).Warningln("学习回复失败")
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("学习失败了，稍后再试试")))
+			return
+		}
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("找到 %d 条新的候选回复", added))))
+		return
+	case "approve", "reject":
+	default:
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("/learn-queue [approve|reject 编号...|mine]")))
+		return
+	}
+	if len(fields) < 2 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("/learn-queue "+fields[0]+" 编号...")))
+		return
+	}
+	var lines []string
+	for _, f := range fields[1:] {
+		id, err := strconv.ParseInt(strings.TrimPrefix(f, "#"), 10, 64)
+		if err != nil {
+			lines = append(lines, f+"：编号不对")
+			continue
+		}
+		var q queued
+		if fields[0] == "approve" {
+			q, err = approve(groupID, id)
+		} else {
+			q, err = reject(groupID, id)
+		}
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Log.WithFields(logrus.Fields{
+					"event":     "Reply Learn",
+					"err":       err,
+					"QQGroupId": groupID,
+				}).Warningln("审核回复失败")
+			}
+			lines = append(lines, fmt.Sprintf("#%d：没有这个待审核的回复", id))
+			continue
+		}
+		if fields[0] == "approve" {
+			lines = append(lines, fmt.Sprintf("#%d %s → %s：已加入", id, q.Keyword, q.Reply))
+		} else {
+			lines = append(lines, fmt.Sprintf("#%d %s → %s：已拒绝", id, q.Keyword, q.Reply))
+		}
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(strings.Join(lines, "\n"))))
+}
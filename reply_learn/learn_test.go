@@ -0,0 +1,77 @@
+package replylearn
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	testdb "github.com/doylecnn/qqbot/test_db"
+)
+
+func useTestDB(t *testing.T) {
+	db = testdb.New(t)
+	t.Cleanup(func() { db = nil })
+}
+
+type line struct {
+	QQ   int64
+	Text string
+	// At 相对开始时间的秒数
+	At int
+}
+
+// say 按顺序插入消息
+func say(start time.Time, groupID int64, lines ...line) {
+	for _, l := range lines {
+		db.MustExec(`INSERT INTO group_messages(msg_id, group_id, group_number, qq_number, message, time) VALUES (0, 0, ?, ?, ?, ?)`,
+			groupID, l.QQ, l.Text, start.Add(time.Duration(l.At)*time.Second).Unix())
+	}
+}
+
+func TestMine(t *testing.T) {
+	useTestDB(t)
+	start := time.Now().Add(-time.Hour)
+	say(start, 1,
+		line{1, "早上好", 0}, line{2, "早", 5},
+		line{3, "早上好", 100}, line{1, "早", 110},
+		line{2, "大家早上好", 200}, line{3, "早", 203},
+		// 超过 30 秒不算
+		line{1, "早上好", 300}, line{2, "早", 400},
+		// 自己接自己不算
+		line{1, "吃了吗", 500}, line{1, "吃了", 501},
+		line{2, "吃了吗", 600}, line{3, "吃了", 601},
+		// 指令不算
+		line{1, "/handle", 700}, line{2, "早", 701},
+	)
+	say(start, 2, line{1, "早上好", 0}, line{2, "早", 1})
+
+	candidates, err := mine(1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []candidate{{"早上好", "早", 2, 3}}; !reflect.DeepEqual(candidates, want) {
+		t.Fatalf("mine = %+v, want %+v", candidates, want)
+	}
+
+	if added, err := enqueue(1, candidates, time.Now()); err != nil || added != 1 {
+		t.Fatalf("enqueue = %d, %v", added, err)
+	}
+	// 已经在队列里的不再加
+	if added, _ := enqueue(1, candidates, time.Now()); added != 0 {
+		t.Errorf("enqueue again added %d", added)
+	}
+	if _, err := approve(2, 1); err == nil {
+		t.Error("approved another group's item")
+	}
+	q, err := approve(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply string
+	if err := db.Get(&reply, `SELECT reply FROM replies WHERE group_number=1 AND keyword=?`, q.Keyword); err != nil || reply != "早" {
+		t.Errorf("replies row = %q, %v", reply, err)
+	}
+	if _, err := reject(1, 1); err == nil {
+		t.Error("rejected an approved item")
+	}
+}
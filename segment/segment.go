@@ -0,0 +1,78 @@
+// Package segment 简单的中文分词：按词典正向最大匹配，词典里没有的汉字单独成词，连续的字母数字算一个词
+package segment
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Segmenter 分词器，建好之后只读，可以并发使用
+type Segmenter struct {
+	words  map[string]bool
+	maxLen int
+}
+
+// New 用词表建分词器，单字词会被忽略
+func New(words []string) *Segmenter {
+	s := &Segmenter{words: make(map[string]bool, len(words))}
+	for _, w := range words {
+		n := len([]rune(w))
+		if n < 2 {
+			continue
+		}
+		s.words[w] = true
+		if n > s.maxLen {
+			s.maxLen = n
+		}
+	}
+	return s
+}
+
+func isHan(r rune) bool {
+	return unicode.Is(unicode.Han, r)
+}
+
+func isWordChar(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// Cut 切分一段文字，标点和空白会被丢掉，字母统一转成小写
+func (s *Segmenter) Cut(text string) (tokens []string) {
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case isHan(r):
+			n := s.match(runes[i:])
+			tokens = append(tokens, string(runes[i:i+n]))
+			i += n
+		case isWordChar(r):
+			j := i + 1
+			for j < len(runes) && isWordChar(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, strings.ToLower(string(runes[i:j])))
+			i = j
+		default:
+			i++
+		}
+	}
+	return
+}
+
+// match 从开头匹配词典里最长的词，返回长度，匹配不到就是 1
+func (s *Segmenter) match(runes []rune) int {
+	n := s.maxLen
+	if n > len(runes) {
+		n = len(runes)
+	}
+	for ; n > 1; n-- {
+		if !isHan(runes[n-1]) {
+			continue
+		}
+		if s.words[string(runes[:n])] {
+			return n
+		}
+	}
+	return 1
+}
@@ -0,0 +1,22 @@
+package segment
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCut(t *testing.T) {
+	s := New([]string{"今天", "天气", "天气预报", "不错", "好"})
+	for text, want := range map[string][]string{
+		"今天天气不错":      {"今天", "天气", "不错"},
+		"看天气预报":       {"看", "天气预报"},
+		"今天，天气 OK 吗？": {"今天", "天气", "ok", "吗"},
+		"打 Go123 比赛":  {"打", "go123", "比", "赛"},
+		"天气好[图片]":     {"天气", "好", "图", "片"},
+		"":            nil,
+	} {
+		if got := s.Cut(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("Cut(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Package sendlimit 限制 bot 往外发消息的速度：任意一分钟内最多发 per_minute 条，
+// 发得太快 QQ 号会被风控。排队超过 max_wait 的消息直接丢掉
+package sendlimit
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/doylecnn/qqbot/log"
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+)
+
+const defaultMaxWait = 30 * time.Second
+
+// ErrTooMany 排队太久，这条消息不发了
+var ErrTooMany = errors.New("发送太频繁，消息已丢弃")
+
+// sendActions 算作发消息的 API
+var sendActions = map[string]bool{
+	"send_msg":                 true,
+	"send_group_msg":           true,
+	"send_private_msg":         true,
+	"send_group_forward_msg":   true,
+	"send_private_forward_msg": true,
+}
+
+// Limiter 滑动窗口限速，perMinute 为 0 表示不限
+type Limiter struct {
+	perMinute int
+	maxWait   time.Duration
+	// sent 最近 perMinute 条消息发出（或者排到）的时间，从早到晚
+	sent []time.Time
+	mux  sync.Mutex
+}
+
+func NewLimiter(perMinute int, maxWait time.Duration) *Limiter {
+	return &Limiter{perMinute: perMinute, maxWait: maxWait}
+}
+
+// reserve 占一个发送的位置，返回还要等多久；要等超过 maxWait 时不占位置，返回 false
+func (l *Limiter) reserve(now time.Time) (time.Duration, bool) {
+	if l.perMinute <= 0 {
+		return 0, true
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	at := now
+	if len(l.sent) >= l.perMinute {
+		if t := l.sent[len(l.sent)-l.perMinute].Add(time.Minute); t.After(at) {
+			at = t
+		}
+	}
+	wait := at.Sub(now)
+	if l.maxWait > 0 && wait > l.maxWait {
+		return wait, false
+	}
+	l.sent = append(l.sent, at)
+	if len(l.sent) > l.perMinute {
+		l.sent = append(l.sent[:0], l.sent[len(l.sent)-l.perMinute:]...)
+	}
+	return wait, true
+}
+
+// Wait 等到可以发下一条，排不上时返回 ErrTooMany
+func (l *Limiter) Wait() error {
+	wait, ok := l.reserve(time.Now())
+	if !ok {
+		return ErrTooMany
+	}
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	return nil
+}
+
+var limiter = NewLimiter(0, defaultMaxWait)
+
+// Init 读 send_limit.per_minute 和 send_limit.max_wait，没有配置时不限速
+func Init(config *toml.Tree) {
+	if config == nil {
+		return
+	}
+	perMinute, maxWait := 0, defaultMaxWait
+	if v, ok := config.Get("send_limit.per_minute").(int64); ok && v > 0 {
+		perMinute = int(v)
+	}
+	if s, ok := config.Get("send_limit.max_wait").(string); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event": "Send Limit",
+				"err":   err,
+			}).Warningln("send_limit.max_wait 格式不对，用默认值")
+		} else {
+			maxWait = d
+		}
+	}
+	limiter = NewLimiter(perMinute, maxWait)
+}
+
+// Wrap 包一层 Driver，经过它的发消息 API 都要排队
+func Wrap(driver zero.Driver) zero.Driver {
+	return limitedDriver{driver}
+}
+
+type limitedDriver struct {
+	zero.Driver
+}
+
+func (d limitedDriver) Listen(handler func([]byte, zero.APICaller)) {
+	d.Driver.Listen(func(payload []byte, caller zero.APICaller) {
+		handler(payload, limitedCaller{caller})
+	})
+}
+
+type limitedCaller struct {
+	zero.APICaller
+}
+
+func (c limitedCaller) CallApi(req zero.APIRequest) (zero.APIResponse, error) {
+	if sendActions[req.Action] {
+		if err := limiter.Wait(); err != nil {
+			log.Log.WithFields(logrus.Fields{
+				"event":  "Send Limit",
+				"Action": req.Action,
+			}).Warningln(err)
+			return zero.APIResponse{}, err
+		}
+	}
+	return c.APICaller.CallApi(req)
+}
@@ -0,0 +1,71 @@
+package sendlimit
+
+import (
+	"testing"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+)
+
+func TestReserve(t *testing.T) {
+	l := NewLimiter(3, 40*time.Second)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if wait, ok := l.reserve(start.Add(time.Duration(i) * time.Second)); !ok || wait != 0 {
+			t.Fatalf("reserve #%d = %v, %v, want 0, true", i+1, wait, ok)
+		}
+	}
+	// 第 4 条要等到第 1 条满一分钟
+	if wait, ok := l.reserve(start.Add(30 * time.Second)); !ok || wait != 30*time.Second {
+		t.Errorf("reserve #4 = %v, %v, want 30s, true", wait, ok)
+	}
+	// 排队的也占位置：第 5 条要等到第 2 条满一分钟，超过 maxWait 就不发
+	if wait, ok := l.reserve(start.Add(10 * time.Second)); ok {
+		t.Errorf("reserve #5 = %v, %v, want false", wait, ok)
+	}
+	if wait, ok := l.reserve(start.Add(30 * time.Second)); !ok || wait != 31*time.Second {
+		t.Errorf("reserve #5 again = %v, %v, want 31s, true", wait, ok)
+	}
+	if wait, ok := l.reserve(start.Add(5 * time.Minute)); !ok || wait != 0 {
+		t.Errorf("reserve after a while = %v, %v, want 0, true", wait, ok)
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	l := NewLimiter(0, time.Second)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		if wait, ok := l.reserve(now); !ok || wait != 0 {
+			t.Fatalf("reserve #%d = %v, %v", i+1, wait, ok)
+		}
+	}
+}
+
+type countingCaller struct {
+	actions []string
+}
+
+func (c *countingCaller) CallApi(req zero.APIRequest) (zero.APIResponse, error) {
+	c.actions = append(c.actions, req.Action)
+	return zero.APIResponse{}, nil
+}
+
+func TestCallerDropsSends(t *testing.T) {
+	defer func(l *Limiter) { limiter = l }(limiter)
+	limiter = NewLimiter(1, time.Millisecond)
+	inner := &countingCaller{}
+	caller := limitedCaller{inner}
+	if _, err := caller.CallApi(zero.APIRequest{Action: "send_group_msg"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := caller.CallApi(zero.APIRequest{Action: "send_msg"}); err != ErrTooMany {
+		t.Errorf("second send: err = %v, want ErrTooMany", err)
+	}
+	// 其他 API 不限
+	if _, err := caller.CallApi(zero.APIRequest{Action: "delete_msg"}); err != nil {
+		t.Errorf("delete_msg: err = %v", err)
+	}
+	if want := []string{"send_group_msg", "delete_msg"}; len(inner.actions) != 2 || inner.actions[0] != want[0] || inner.actions[1] != want[1] {
+		t.Errorf("calls = %v, want %v", inner.actions, want)
+	}
+}
@@ -0,0 +1,47 @@
+package taunt
+
+import (
+	"fmt"
+
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// Plugin 接话
+type Plugin struct{}
+
+func (Plugin) Name() string { return "taunt" }
+
+func (Plugin) Description() string { return "接话：sb某某、lj某某" }
+
+func (Plugin) Init(config *toml.Tree, db *sqlx.DB) error { return nil }
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "sb", Usage: "sb某某", Description: "帮你附和一句，也可以用 傻逼、伞兵", Examples: []string{"sb老王"}},
+		{Name: "lj", Usage: "lj某某", Description: "帮你附和一句，也可以用 垃圾、辣鸡", Examples: []string{"垃圾小明"}},
+	}
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnRegex(`^([sS沙鲨傻][bBdD逼雕]|伞兵)(\p{Han}+|\x{1F427}+)`).Handle(func(ctx *zero.Ctx) {
+		if v, ok := ctx.State["regex_matched"]; ok {
+			a := v.([]string)
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("%s确实大%s", a[2], a[1]))))
+			ctx.Block()
+		}
+	})
+
+	engine.OnRegex(`^([lL垃辣][jJgG圾鸡])(\p{Han}+|\x{1F427}+)`).Handle(func(ctx *zero.Ctx) {
+		if v, ok := ctx.State["regex_matched"]; ok {
+			a := v.([]string)
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("%s确实太%s了", a[2], a[1]))))
+			ctx.Block()
+		}
+	})
+}
+
+func (Plugin) Shutdown() {}
@@ -0,0 +1,51 @@
+// Package testdb 测试用的内存数据库，表直接按仓库根目录的 db.schema 建，和正式环境一致
+package testdb
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	fuzzy "github.com/doylecnn/go-fuzzywuzzy"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+)
+
+var registerDriver sync.Once
+
+// schemaPath 仓库根目录的 db.schema，按这个文件所在的位置找，哪个包的测试用都一样
+func schemaPath() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "db.schema")
+}
+
+// New 打开一个建好所有表的内存数据库，测试结束时关掉。和 main 里的 openDB 一样注册了 partial_ratio
+func New(t testing.TB) *sqlx.DB {
+	t.Helper()
+	registerDriver.Do(func() {
+		sql.Register("sqlite3_test", &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				return conn.RegisterFunc("partial_ratio", fuzzy.PartialRatio, true)
+			},
+		})
+	})
+	origin, err := sql.Open("sqlite3_test", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	database := sqlx.NewDb(origin, "sqlite3")
+	t.Cleanup(func() { database.Close() })
+	// 内存数据库每个连接都是独立的
+	database.SetMaxOpenConns(1)
+	schema, err := os.ReadFile(schemaPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = database.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
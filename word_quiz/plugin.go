@@ -0,0 +1,29 @@
+package wordquiz
+
+import (
+	"github.com/doylecnn/qqbot/plugin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pelletier/go-toml"
+	zero "github.com/wdvxdr1123/ZeroBot"
+)
+
+// Plugin 猜词
+type Plugin struct{}
+
+func (Plugin) Name() string { return "quiz" }
+
+func (Plugin) Description() string { return "猜词：/quiz" }
+
+func (Plugin) Init(config *toml.Tree, db *sqlx.DB) error { return nil }
+
+func (Plugin) Commands() []plugin.Command {
+	return []plugin.Command{
+		{Name: "quiz", Usage: "/quiz [initials|pinyin|scramble] [长度]", Description: "猜词，看首字母、拼音或者打乱的字猜词语，/quiz skip 跳过，/quiz stop 结束", Examples: []string{"/quiz", "/quiz pinyin 4"}},
+	}
+}
+
+func (Plugin) Register(engine *zero.Engine) {
+	engine.OnCommand("quiz").Handle(Command)
+}
+
+func (Plugin) Shutdown() {}
@@ -0,0 +1,277 @@
+package wordquiz
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	gamesession "github.com/doylecnn/qqbot/game_session"
+	hanyuwordle "github.com/doylecnn/qqbot/hanyu_wordle"
+	"github.com/doylecnn/qqbot/log"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	// questionTimeout 每道题多久没人答对就公布答案
+	questionTimeout = 60 * time.Second
+	rounds          = 5
+)
+
+const gameName = "猜词"
+
+type question struct {
+	Word   hanyuwordle.Word
+	Prompt string
+	// accept 算答对的词，缩写和拼音题里同缩写、同音的词也算
+	accept map[string]bool
+}
+
+// mode 一种出题方式
+type mode struct {
+	Name string
+	Ask  string
+	// key 同一个 key 的词都算答对，建索引用，乱序题不需要
+	key  func(w hanyuwordle.Word, pinYin [][4]string) string
+	make func(w hanyuwordle.Word, index answerIndex) (question, bool)
+}
+
+var modes = map[string]mode{
+	"initials": {Name: "猜缩写", Ask: "按拼音首字母猜词", key: initialsKey, make: initialsQuestion},
+	"pinyin":   {Name: "看拼音写词", Ask: "按拼音写出词", key: pinyinKey, make: pinyinQuestion},
+	"scramble": {Name: "乱序", Ask: "把打乱的字排回原来的词", make: scrambleQuestion},
+}
+
+var modeAliases = map[string]string{
+	"缩写": "initials",
+	"拼音": "pinyin",
+	"乱序": "scramble",
+}
+
+// answerIndex 按 key 归类的词，开局时对整个词池转一次拼音，出题时直接查同缩写、同音的词
+type answerIndex map[string][]string
+
+func newAnswerIndex(pool []hanyuwordle.Word, key func(w hanyuwordle.Word, pinYin [][4]string) string) answerIndex {
+	index := make(answerIndex)
+	if key == nil {
+		return index
+	}
+	for _, w := range pool {
+		py := hanyuwordle.PinYin(w.Text)
+		if len(py) != len([]rune(w.Text)) {
+			continue
+		}
+		k := key(w, py)
+		index[k] = append(index[k], w.Text)
+	}
+	return index
+}
+
+// initials 拼音首字母，零声母的字取韵母的首字母
+func initials(pinYin [][4]string) string {
+	var sb strings.Builder
+	for _, p := range pinYin {
+		if p[1] != "" {
+			sb.WriteString(p[1][:1])
+		} else {
+			sb.WriteString(p[2][:1])
+		}
+	}
+	return strings.ToUpper(sb.String())
+}
+
+// initialsKey 缩写题只算同一类里缩写相同的词
+func initialsKey(w hanyuwordle.Word, pinYin [][4]string) string {
+	return w.Type + " " + initials(pinYin)
+}
+
+func pinyinKey(w hanyuwordle.Word, pinYin [][4]string) string {
+	return hanyuwordle.TonePinYin(pinYin)
+}
+
+func initialsQuestion(w hanyuwordle.Word, index answerIndex) (question, bool) {
+	py := hanyuwordle.PinYin(w.Text)
+	if len(py) != len([]rune(w.Text)) {
+		return question{}, false
+	}
+	q := question{Word: w, Prompt: fmt.Sprintf("%s（%s）", initials(py), w.Type), accept: map[string]bool{w.Text: true}}
+	for _, text := range index[initialsKey(w, py)] {
+		q.accept[text] = true
+	}
+	return q, true
+}
+
+func pinyinQuestion(w hanyuwordle.Word, index answerIndex) (question, bool) {
+	py := hanyuwordle.PinYin(w.Text)
+	if len(py) != len([]rune(w.Text)) {
+		return question{}, false
+	}
+	prompt := pinyinKey(w, py)
+	q := question{Word: w, Prompt: fmt.Sprintf("%s（%s）", prompt, w.Type), accept: map[string]bool{w.Text: true}}
+	for _, text := range index[prompt] {
+		q.accept[text] = true
+	}
+	return q, true
+}
+
+func scrambleQuestion(w hanyuwordle.Word, index answerIndex) (question, bool) {
+	runes := []rune(w.Text)
+	shuffled := string(runes)
+	for i := 0; i < 10 && shuffled == w.Text; i++ {
+		rand.Shuffle(len(runes), func(i, j int) { runes[i], runes[j] = runes[j], runes[i] })
+		shuffled = string(runes)
+	}
+	if shuffled == w.Text {
+		return question{}, false
+	}
+	return question{Word: w, Prompt: fmt.Sprintf("%s（%s）", shuffled, w.Type), accept: map[string]bool{w.Text: true}}, true
+}
+
+type quiz struct {
+	Mode     mode
+	Length   int
+	Round    int
+	pool     []hanyuwordle.Word
+	index    answerIndex
+	question question
+}
+
+// next 出下一题，题出完了返回 false
+func (q *quiz) next(ctx *zero.Ctx) bool {
+	if q.Round >= rounds {
+		return false
+	}
+	for i := 0; i < 20; i++ {
+		w := q.pool[rand.Intn(len(q.pool))]
+		if question, ok := q.Mode.make(w, q.index); ok {
+			q.Round++
+			q.question = question
+			ctx.Send(message.Text(fmt.Sprintf("第 %d/%d 题，%s：%s", q.Round, rounds, q.Mode.Ask, question.Prompt)))
+			return true
+		}
+	}
+	return false
+}
+
+func (q *quiz) Start(ctx *zero.Ctx, s *gamesession.Session) {
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("%s开始！一共 %d 题，每题 %s，直接发词作答，/quiz skip 跳过，/quiz stop 结束", q.Mode.Name, rounds, questionTimeout))))
+	if !q.next(ctx) {
+		ctx.Send(message.Text("出题失败了……"))
+		s.End()
+	}
+}
+
+func (q *quiz) Input(ctx *zero.Ctx, s *gamesession.Session) bool {
+	text := strings.TrimSpace(ctx.MessageString())
+	if !q.question.accept[text] {
+		return false
+	}
+	name := ctx.CardOrNickName(ctx.Event.UserID)
+	s.AddScore(ctx.Event.UserID, name, 1)
+	reply := fmt.Sprintf("%s 答对了！", name)
+	if text != q.question.Word.Text {
+		reply += "原题是：" + q.question.Word.Text
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(reply)))
+	q.advance(ctx, s)
+	return true
+}
+
+func (q *quiz) Timeout(ctx *zero.Ctx, s *gamesession.Session) bool {
+	ctx.Send(message.Text(fmt.Sprintf("时间到，答案是：%s", q.question.Word.Text)))
+	q.advance(ctx, s)
+	return !s.Ended()
+}
+
+func (q *quiz) Stop(ctx *zero.Ctx, s *gamesession.Session) bool {
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(fmt.Sprintf("%s结束，这题的答案是：%s\n%s", q.Mode.Name, q.question.Word.Text, s.Scoreboard()))))
+	return true
+}
+
+// quizOf 当前聊天正在进行的猜词
+func quizOf(ctx *zero.Ctx) (*gamesession.Session, *quiz, bool) {
+	s, exists := gamesession.Sessions.Get(ctx)
+	if !exists {
+		return nil, nil, false
+	}
+	q, ok := s.Game.(*quiz)
+	return s, q, ok
+}
+
+// advance 进入下一题，题出完了就结束并公布成绩
+func (q *quiz) advance(ctx *zero.Ctx, s *gamesession.Session) {
+	if q.next(ctx) {
+		return
+	}
+	s.End()
+	ctx.Send(message.Text(fmt.Sprintf("%s结束\n%s", q.Mode.Name, s.Scoreboard())))
+}
+
+// Command 猜词小游戏：/quiz [initials|pinyin|scramble] [长度]，/quiz skip 跳过，/quiz stop 结束
+func Command(ctx *zero.Ctx) {
+	defer ctx.Block()
+	fields := []string{}
+	if args, ok := ctx.State["args"].(string); ok {
+		fields = strings.Fields(strings.ToLower(args))
+	}
+	if len(fields) > 0 {
+		switch fields[0] {
+		case "stop", "结束":
+			if _, _, exists := quizOf(ctx); exists {
+				gamesession.Sessions.Stop(ctx)
+			}
+			return
+		case "skip", "跳过":
+			if s, q, exists := quizOf(ctx); exists {
+				s.Do(func() {
+					ctx.Send(message.Text(fmt.Sprintf("跳过，答案是：%s", q.question.Word.Text)))
+					q.advance(ctx, s)
+				})
+			}
+			return
+		}
+	}
+	modeName := ""
+	length := 4
+	for _, f := range fields {
+		if alias, exists := modeAliases[f]; exists {
+			f = alias
+		}
+		if _, exists := modes[f]; exists {
+			modeName = f
+		} else if l, err := strconv.Atoi(f); err == nil && l >= 2 && l <= 9 {
+			length = l
+		} else {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("用法：/quiz [缩写|拼音|乱序] [长度]，不写就随便出\n/quiz skip 跳过，/quiz stop 结束")))
+			return
+		}
+	}
+	if modeName == "" {
+		names := []string{"initials", "pinyin", "scramble"}
+		modeName = names[rand.Intn(len(names))]
+	}
+	pool := hanyuwordle.Candidates(ctx.Event.GroupID, length)
+	if len(pool) == 0 {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("非常不巧，词典里没有这个长度的词……")))
+		return
+	}
+	// 索引在这里建好，出题在会话的事件循环里，不能每题都把整个词池转一遍拼音
+	q := &quiz{Mode: modes[modeName], Length: length, pool: pool, index: newAnswerIndex(pool, modes[modeName].key)}
+	if s, err := gamesession.Sessions.Start(ctx, gameName, q, questionTimeout); err != nil {
+		if s != nil && s.Name == gameName {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("已经在猜词啦")))
+		} else {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err.Error())))
+		}
+		return
+	}
+	log.Log.WithFields(logrus.Fields{
+		"event":     "Word Quiz Start",
+		"Mode":      modeName,
+		"Length":    length,
+		"QQGroupId": ctx.Event.GroupID,
+	}).Infoln("猜词游戏开始")
+}
@@ -0,0 +1,36 @@
+package wordquiz
+
+import (
+	"testing"
+
+	hanyuwordle "github.com/doylecnn/qqbot/hanyu_wordle"
+)
+
+func TestInitials(t *testing.T) {
+	cases := map[string]string{
+		"中国人民": "ZGRM",
+		"银行":   "YH",
+		"爱情":   "AQ",
+	}
+	for word, want := range cases {
+		if got := initials(hanyuwordle.PinYin(word)); got != want {
+			t.Errorf("initials(%s) = %s, want %s", word, got, want)
+		}
+	}
+}
+
+func TestQuestions(t *testing.T) {
+	pool := []hanyuwordle.Word{{Text: "银行", Type: "财经"}, {Text: "音乐", Type: "财经"}, {Text: "银河", Type: "财经"}}
+	q, ok := initialsQuestion(pool[0], newAnswerIndex(pool, initialsKey))
+	if !ok || q.Prompt != "YH（财经）" || !q.accept["银河"] || q.accept["音乐"] {
+		t.Errorf("initialsQuestion = %+v", q)
+	}
+	q, ok = pinyinQuestion(pool[1], newAnswerIndex(pool, pinyinKey))
+	if !ok || q.Prompt != "yīn yuè（财经）" || len(q.accept) != 1 {
+		t.Errorf("pinyinQuestion = %+v", q)
+	}
+	q, ok = scrambleQuestion(pool[0], newAnswerIndex(pool, nil))
+	if !ok || q.Prompt != "行银（财经）" || !q.accept["银行"] {
+		t.Errorf("scrambleQuestion = %+v", q)
+	}
+}